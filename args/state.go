@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/migsc/cmdeagle/envvar"
+	"github.com/migsc/cmdeagle/interpolation"
+	"github.com/migsc/cmdeagle/params"
 	"github.com/migsc/cmdeagle/types"
 
 	"github.com/charmbracelet/log"
@@ -25,6 +27,8 @@ type ArgStateEntry struct {
 	Def      *types.ArgDefinition
 	Val      any
 	RawVal   string
+	// Where the value came from: params.SourceCLI, SourceEnv or SourceDefault
+	Source string
 	// TODO: Thought about adding multiple error handling and that might help. Not implementing for now.
 	Err error
 }
@@ -58,6 +62,12 @@ func CreateArgsStore(cobraCommand *cobra.Command, argsConfigDef *[]types.ArgDefi
 		// Determine the raw and converted values
 		var val, rawVal any
 		var err error
+		source := params.SourceDefault
+
+		envVal, hasEnvVal := "", false
+		if def.Env != "" {
+			envVal, hasEnvVal = envvar.Lookup(def.Env)
+		}
 
 		log.Debug("Creating entry", "index", index, "def", def, "args", args)
 		if index < len(args) {
@@ -65,6 +75,12 @@ func CreateArgsStore(cobraCommand *cobra.Command, argsConfigDef *[]types.ArgDefi
 			// Handle provided argument
 			rawVal = args[index]
 			val, err = argType.Convert(args[index])
+			source = params.SourceCLI
+		} else if hasEnvVal {
+			log.Debug("Handling environment variable", "index", index, "env", def.Env)
+			rawVal = envVal
+			val, err = argType.Convert(envVal)
+			source = params.SourceEnv
 		} else {
 			log.Debug("Handling default value", "index", index, "def", def, "default", def.Default)
 			if def.Default != nil {
@@ -78,14 +94,20 @@ func CreateArgsStore(cobraCommand *cobra.Command, argsConfigDef *[]types.ArgDefi
 			}
 
 			if def.Required {
-				err = fmt.Errorf("missing required argument: %s", def.Name)
+				err = params.NewParamError("required", def.Name, nil, nil)
 			}
 		}
+		// Including a declared default, but not the zero value of arguments without one
+		if def.Secret && (source != params.SourceDefault || def.Default != nil) {
+			params.AddSecret(fmt.Sprint(rawVal))
+		}
+
 		// Create entry
 		entry := &ArgStateEntry{
 			Position: index,
 			Def:      &def,
 			RawVal:   fmt.Sprint(rawVal),
+			Source:   source,
 			Val:      val,
 			Err:      err,
 		}
@@ -167,15 +189,22 @@ func (store *ArgsStateStore) SetVal(key string, val any) any {
 	return store.Entries[key].Val
 }
 
-func (store *ArgsStateStore) Interpolate(script string) string {
-	log.Debug("Interpolating", "script", script)
+// GetContext returns the argument values that scripts can reference as `{{args.*}}`.
+func (store *ArgsStateStore) GetContext() interpolation.Context {
+	ctx := interpolation.NewContext()
+
 	for key, entry := range store.Entries {
-		log.Debug("Interpolating", "key", key, "val", entry.Val)
-		placeholder := fmt.Sprintf("{{args.%s}}", key)
-		script = strings.ReplaceAll(script, placeholder, fmt.Sprint(entry.Val))
+		ctx.Set("args."+key, entry.Val)
 	}
+	ctx.Set("args.list", store.toJSON(false)["list"])
+	ctx.Set("args.json", store.ToJSONString())
 
-	return script
+	return ctx
+}
+
+func (store *ArgsStateStore) Interpolate(script string) (string, error) {
+	log.Debug("Interpolating", "script", script)
+	return interpolation.Render(script, store.GetContext())
 }
 
 func (store *ArgsStateStore) GetEnvVariables() []types.EnvVar {
@@ -188,14 +217,26 @@ func (store *ArgsStateStore) GetEnvVariables() []types.EnvVar {
 	return envVars
 }
 
+// ToJSON returns the values of the arguments, with the values of secret ones masked.
 func (store *ArgsStateStore) ToJSON() map[string]any {
+	return store.toJSON(true)
+}
+
+func (store *ArgsStateStore) toJSON(redact bool) map[string]any {
 	result := make(map[string]any)
 
+	value := func(entry *ArgStateEntry) any {
+		if redact && entry.Def != nil && entry.Def.Secret {
+			return params.Redacted
+		}
+		return entry.Val
+	}
+
 	// Add positional arguments as a list
 	list := make([]any, 0)
 	for i := 0; i < len(store.RawList); i++ {
 		if entry := store.GetAt(i); entry != nil {
-			list = append(list, entry.Val)
+			list = append(list, value(entry))
 		} else {
 			list = append(list, store.GetRawValAt(i))
 		}
@@ -206,13 +247,24 @@ func (store *ArgsStateStore) ToJSON() map[string]any {
 	for key, entry := range store.Entries {
 		// Only include named arguments
 		if !strings.HasPrefix(key, "list[") {
-			result[key] = entry.Val
+			result[key] = value(entry)
 		}
 	}
 
 	return result
 }
 
+// Secrets returns the values of the secret arguments.
+func (store *ArgsStateStore) Secrets() map[string]any {
+	secrets := map[string]any{}
+	for key, entry := range store.Entries {
+		if entry.Def != nil && entry.Def.Secret && !strings.HasPrefix(key, "list[") {
+			secrets[key] = entry.Val
+		}
+	}
+	return secrets
+}
+
 func (store *ArgsStateStore) ToJSONString() string {
 	jsonBytes, err := json.Marshal(store.ToJSON())
 	if err != nil {
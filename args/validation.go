@@ -33,6 +33,9 @@ func ValidateArgs(cobraCmd *cobra.Command, argsConfigDef *[]types.ArgDefinition,
 		}
 
 		log.Debug("Validating args", "entry", entry)
+		if entry.Def != nil && entry.Def.Required {
+			params.RecordCheck(entry.Def.Name, "required", entry.Val, entry.Err)
+		}
 		if entry.Err != nil {
 			return entry.Err
 		}
@@ -41,18 +44,18 @@ func ValidateArgs(cobraCmd *cobra.Command, argsConfigDef *[]types.ArgDefinition,
 		if entry.Def != nil {
 			constraints := entry.Def.Constraints
 			log.Debug("Validating args", "constraints", constraints)
-			err := params.ValidateConstraint(&constraints, entry.Val)
+			err := params.ValidateParamConstraint(entry.Def.Name, &constraints, entry.Val)
 			if err != nil {
-				return fmt.Errorf("validation failed for argument %s: %v", entry.Def.Name, err)
+				return err
 			}
 		}
 
 		// Validate dependencies
 		if entry.Def != nil && entry.Def.DependsOn != nil {
 			for _, dependency := range entry.Def.DependsOn {
-				err := params.ValidateConstraint(dependency.When, store.GetVal(dependency.Name))
+				err := params.ValidateParamConstraint(dependency.Name, dependency.When, store.GetVal(dependency.Name))
 				if err != nil {
-					return fmt.Errorf("dependency validation failed for argument %s: %v", entry.Def.Name, err)
+					return params.NewDependencyError(entry.Def.Name, dependency.Name, err)
 				}
 			}
 		}
@@ -60,9 +63,14 @@ func ValidateArgs(cobraCmd *cobra.Command, argsConfigDef *[]types.ArgDefinition,
 		// Validate conflicts
 		if entry.Def != nil && entry.Def.ConflictsWith != nil {
 			for _, conflict := range entry.Def.ConflictsWith {
+				var err error
 				conflictVal := store.GetVal(conflict)
 				if conflictVal != nil && conflictVal != "" {
-					return fmt.Errorf("argument %s conflicts with %s", entry.Def.Name, conflict)
+					err = params.NewParamError("conflicts-with", entry.Def.Name, entry.Val, conflict)
+				}
+				params.RecordCheck(entry.Def.Name, "conflicts-with", entry.Val, err)
+				if err != nil {
+					return err
 				}
 			}
 		}
@@ -85,7 +93,11 @@ func ValidateArgs(cobraCmd *cobra.Command, argsConfigDef *[]types.ArgDefinition,
 			log.Debug("Validating pattern for argument", "pattern", pattern, "value", entry.Val, "match", match, "err", err, "found", found)
 
 			if !match {
-				return fmt.Errorf("pattern validation failed for argument %s: %v", entry.Def.Name, entry.Val)
+				err = params.NewParamError("pattern", entry.Def.Name, entry.Val, entry.Def.Pattern)
+			}
+			params.RecordCheck(entry.Def.Name, "pattern", entry.Val, err)
+			if err != nil {
+				return err
 			}
 		}
 	}
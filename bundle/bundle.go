@@ -1,10 +1,19 @@
 package bundle
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"embed"
+	"encoding/json"
+	"io"
+	"io/fs"
 	"runtime"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/migsc/cmdeagle/executable"
 	"github.com/migsc/cmdeagle/file"
 	"github.com/migsc/cmdeagle/types"
 
@@ -106,38 +115,9 @@ func SetupMainFile(path string) (string, error) {
 	return mainFilePath, nil
 }
 
-type Bundle struct {
-	DirPath string
-	DirName string
-	Files   map[string]*BundleFile
-}
-
-// func CreateBundle(config *config.CmdeagleConfig) (*Bundle, error) {
-// 	var bundle = Bundle{
-// 		DirPath: config.DataDir,
-// 		DirName: config.Name,
-// 		Files:   make(map[string]*BundleFile),
-// 	}
-
-// 	return &bundle, nil
-// }
-
-// type BundleFile struct {
-// 	path     string
-// 	info     os.FileInfo
-// 	children []*BundleFile
-// 	parents  []*BundleFile
-// }
-
-// func GetDestDir(config *schema.CmdeagleConfig) (string, error) {
-// 	if config.DataDir == "" {
-// 		return "", fmt.Errorf("Directory path was not provided for data/bundle directory.")
-// 	}
-
-// 	return filepath.Join(config.DataDir, config.Name), nil
-// }
-
-func CopyIncludedFiles(config *types.CmdeagleConfig, command *types.CommandDefinition, namespace []string, targetDirPath string) error {
+// CopyIncludedFiles copies the files a command includes into the staging directory, under the command's
+// namespace, and returns where they ended up relative to the staging directory.
+func CopyIncludedFiles(config *types.CmdeagleConfig, command *types.CommandDefinition, namespace []string, targetDirPath string) ([]string, error) {
 	log.Debug("Copying included files",
 		"command", command.Name,
 		"namespace", namespace,
@@ -145,7 +125,7 @@ func CopyIncludedFiles(config *types.CmdeagleConfig, command *types.CommandDefin
 	)
 
 	if len(command.Includes) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	log.Info("processing includes",
@@ -155,27 +135,36 @@ func CopyIncludedFiles(config *types.CmdeagleConfig, command *types.CommandDefin
 
 	currentDir, err := os.Getwd()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	stagingDirPath := targetDirPath
 	for _, ns := range namespace {
 		targetDirPath = filepath.Join(targetDirPath, ns)
 	}
 
-	for _, includePath := range command.Includes {
+	stagedPaths := []string{}
+	for _, include := range command.Includes {
 		log.Info("including bundle",
-			"from", includePath,
+			"from", include.Path,
 			"to", targetDirPath,
 		)
-		if err := copyIncludedFile(filepath.Join(currentDir, includePath), targetDirPath); err != nil {
-			return err
+		includedFilePath := filepath.Join(currentDir, include.Path)
+		if err := copyIncludedFile(includedFilePath, targetDirPath, include.Executable); err != nil {
+			return nil, err
+		}
+
+		stagedPath, err := filepath.Rel(stagingDirPath, filepath.Join(targetDirPath, filepath.Base(includedFilePath)))
+		if err != nil {
+			return nil, err
 		}
+		stagedPaths = append(stagedPaths, stagedPath)
 	}
 
-	return nil
+	return stagedPaths, nil
 }
 
-func copyIncludedFile(includedFilePath string, targetDir string) error {
+func copyIncludedFile(includedFilePath string, targetDir string, executable bool) error {
 	log.Info("including bundle",
 		"from", includedFilePath,
 		"to", targetDir,
@@ -186,39 +175,282 @@ func copyIncludedFile(includedFilePath string, targetDir string) error {
 		return fmt.Errorf("could not expand the path: %s\n%v", includedFilePath, err)
 	}
 
-	// Get the source file's info to check permissions
-	// fileInfo, err := os.Stat(expandedPath)
-	if err != nil {
-		return fmt.Errorf("could not stat file: %s\n%v", expandedPath, err)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return fmt.Errorf("could not create directory: %s\n%v", targetDir, err)
 	}
 
 	// Use cp with -p flag to preserve mode, ownership, timestamps
 	cmd := exec.Command("cp", "-pr", expandedPath, targetDir)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	if executable {
+		return makeExecutable(filepath.Join(targetDir, filepath.Base(expandedPath)))
+	}
+
+	return nil
+}
+
+// WriteFilesManifest records the modes and hashes of the files staged so far, which are the config and the
+// included files, so the CLI can install them with the same modes and tell when they were changed since.
+// It also lists the files each command includes, given where CopyIncludedFiles staged them by command path,
+// so the CLI only extracts those of the commands that run.
+func WriteFilesManifest(stagingDirPath string, commandIncludes map[string][]string) error {
+	manifest := executable.FilesManifest{Modes: map[string]string{}, Hashes: map[string]string{}, Commands: map[string][]string{}}
+
+	err := filepath.WalkDir(stagingDirPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(stagingDirPath, path)
+		if err != nil {
+			return err
+		}
+		manifest.Modes[filepath.ToSlash(relPath)] = fmt.Sprintf("%04o", info.Mode().Perm())
+
+		hash, err := executable.HashFile(path)
+		if err != nil {
+			return err
+		}
+		manifest.Hashes[filepath.ToSlash(relPath)] = hash
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record file modes: %w", err)
+	}
+
+	for commandPath, stagedPaths := range commandIncludes {
+		files, err := listEmbeddedFiles(stagingDirPath, stagedPaths)
+		if err != nil {
+			return fmt.Errorf("failed to list the files of command %q: %w", commandPath, err)
+		}
+		manifest.Commands[commandPath] = files
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(stagingDirPath, executable.FilesManifestName), content, 0644)
+}
+
+// CompressIncludedFiles moves the included files listed in the files manifest of the staging directory into
+// a gzip-compressed tar archive, and records the archive and the sizes of its files in the manifest. It
+// returns the size of the files, and that of the archive.
+func CompressIncludedFiles(stagingDirPath string) (int64, int64, error) {
+	manifestPath := filepath.Join(stagingDirPath, executable.FilesManifestName)
+	content, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	manifest := executable.FilesManifest{}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return 0, 0, fmt.Errorf("invalid %s: %w", executable.FilesManifestName, err)
+	}
+
+	seen := map[string]bool{}
+	paths := []string{}
+	for _, files := range manifest.Commands {
+		for _, path := range files {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+
+	archivePath := filepath.Join(stagingDirPath, executable.ArchiveFileName)
+	manifest.Archive = executable.ArchiveFileName
+	manifest.Sizes = map[string]int64{}
+	if err := writeArchive(stagingDirPath, archivePath, paths, manifest.Sizes); err != nil {
+		return 0, 0, fmt.Errorf("failed to compress included files: %w", err)
+	}
+
+	var size int64
+	for _, path := range paths {
+		size += manifest.Sizes[path]
+		if err := removeStagedFile(stagingDirPath, path); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return 0, 0, err
+	}
 
-	// TODO: This wasn't working as expected. We should revisit this.
-	// If the file is executable for user, group, or others, throw an error
-	// if fileInfo.Mode()&0111 != 0 {
-	// 	return fmt.Errorf("cannot include executable file in the bundle: %s", expandedPath)
-	// 	// Previous implementation where we wanted to allow executable files in the bundle
-	// 	// cmd2 := exec.Command("chmod", "+x", filepath.Join(targetDir, filepath.Base(expandedPath)))
-	// 	// cmd2.Stdout = os.Stdout
-	// 	// cmd2.Stderr = os.Stderr
-	// 	// log.Info("copying executable file",
-	// 	// 	"file", includedFilePath,
-	// 	// 	"mode", fileInfo.Mode().String(),
-	// 	// )
-	// 	// err = cmd.Run()
-	// 	// if err != nil {
-	// 	// 	return err
-	// 	// }
-	// 	// return cmd2.Run() // TODO: This is not working. Could we move it to the binary directory and then run it from there?
-	// } else {
-	// 	return cmd.Run()
-	// }
-
-	return cmd.Run()
+	content, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := os.WriteFile(manifestPath, content, 0644); err != nil {
+		return 0, 0, err
+	}
+
+	return size, info.Size(), nil
+}
+
+// writeArchive writes the given files of the staging directory into a gzip-compressed tar archive, and
+// records their sizes. The archive leaves out times and owners, so the same files make the same archive.
+func writeArchive(stagingDirPath string, archivePath string, paths []string, sizes map[string]int64) error {
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	compressed, err := gzip.NewWriterLevel(archive, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	writer := tar.NewWriter(compressed)
+
+	for _, path := range paths {
+		if err := addToArchive(writer, filepath.Join(stagingDirPath, filepath.FromSlash(path)), path, sizes); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := compressed.Close(); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func addToArchive(writer *tar.Writer, filePath string, path string, sizes map[string]int64) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     info.Size(),
+		ModTime:  time.Unix(0, 0),
+		Format:   tar.FormatPAX,
+	}
+	if err := writer.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, file); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", path, err)
+	}
+
+	sizes[path] = info.Size()
+	return nil
+}
+
+// removeStagedFile removes a file from the staging directory, along with the directories it leaves empty.
+func removeStagedFile(stagingDirPath string, path string) error {
+	filePath := filepath.Join(stagingDirPath, filepath.FromSlash(path))
+	if err := os.Remove(filePath); err != nil {
+		return err
+	}
+
+	for dir := filepath.Dir(filePath); dir != stagingDirPath; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// FormatSize returns a size in bytes the way people read it, such as `12.5 MB`.
+func FormatSize(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, prefix := float64(size)/unit, 0
+	for value >= unit && prefix < len("MGTPE") {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "kMGTPE"[prefix])
+}
+
+// listEmbeddedFiles returns the regular files at or under the given paths of the staging directory that end
+// up embedded in the CLI, which leaves out the ones `go:embed` skips in directories: those whose names
+// start with a dot or an underscore.
+func listEmbeddedFiles(stagingDirPath string, stagedPaths []string) ([]string, error) {
+	files := []string{}
+	for _, stagedPath := range stagedPaths {
+		err := filepath.WalkDir(filepath.Join(stagingDirPath, stagedPath), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			relPath, err := filepath.Rel(stagingDirPath, path)
+			if err != nil {
+				return err
+			}
+			relPath = filepath.ToSlash(relPath)
+			if strings.Contains(relPath, "/") && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			if d.Type().IsRegular() {
+				files = append(files, relPath)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// makeExecutable lets everyone who can read a file, or the files of a directory, execute it as well.
+func makeExecutable(path string) error {
+	return filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// The read bits shifted onto the execute bits
+		mode := info.Mode().Perm()
+		if err := os.Chmod(path, mode|(mode&0444)>>2); err != nil {
+			return fmt.Errorf("could not make %s executable: %w", path, err)
+		}
+		return nil
+	})
 }
 
 // type FileManifest struct {
@@ -1,76 +1,218 @@
 package bundle
 
 import (
+	"bytes"
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
 	"io/fs"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/migsc/cmdeagle/args"
 	"github.com/migsc/cmdeagle/config"
+	"github.com/migsc/cmdeagle/control"
+	"github.com/migsc/cmdeagle/envvar"
 	"github.com/migsc/cmdeagle/executable"
+	"github.com/migsc/cmdeagle/explain"
 	"github.com/migsc/cmdeagle/flags"
+	"github.com/migsc/cmdeagle/output"
+	"github.com/migsc/cmdeagle/params"
+	"github.com/migsc/cmdeagle/shell"
+	"github.com/migsc/cmdeagle/steps"
 	"github.com/migsc/cmdeagle/types"
+	"github.com/migsc/cmdeagle/update"
 
 	"github.com/charmbracelet/log"
 	"github.com/spf13/cobra"
 )
 
 //go:embed *
-var bundleFS embed.FS
+var embeddedFS embed.FS
+
+// bundleFS holds the files of the bundle, which are read from their archive when they were compressed
+var bundleFS fs.FS
 
 // var config schema.CmdeagleConfig
 var rootCmd *cobra.Command
 
 var cobraCommands = make(map[string]*cobra.Command)
 
+// registeredCommand ties a cobra command to the definition it was created from, so that hooks declared on
+// a parent command can run with the params of the command being executed.
+type registeredCommand struct {
+	def        *types.CommandDefinition
+	dir        string
+	runOptions executable.RunOptions
+	flagStore  *flags.FlagsStateStore
+	// Set while the command runs through a `call`, whose arguments all follow `--`
+	called bool
+	// Counts the calls made by the command or its subcommands that are running, for which its persistent
+	// hooks ran already
+	callers int
+	// Set once the command's arguments have been parsed
+	paramsStore *config.ParamsStateStore
+}
+
+var registeredCommands = make(map[*cobra.Command]*registeredCommand)
+
+// Set by the `--dry-run` and `--explain` flags every generated CLI has
+var dryRun, explainMode bool
+
+// Set by the `--timeout` and `--retries` flags, which override the config when given
+var timeoutOverride time.Duration
+var retriesOverride int
+
+// Set by the `--jobs` flag, which overrides the `jobs` setting of commands with steps
+var jobsOverride int
+
+// Set by `--output`, how commands with an `output` setting render what their start script printed
+var outputFormat string
+
+// Set by `--verify`, which checks the bundled files a command uses against their hashes
+var verifyBundle bool
+
+// isDryRun reports whether commands should describe what they would do instead of doing it.
+func isDryRun() bool {
+	return dryRun || explainMode
+}
+
+func (registered *registeredCommand) getParamsStore() (*config.ParamsStateStore, error) {
+	if registered.paramsStore == nil {
+		// The command failed before its arguments could be parsed, e.g. because of an unknown flag
+		paramsStore := config.CreateEmptyParamsStore()
+		if err := setCLIParams(paramsStore, rootCmd.Name()); err != nil {
+			return nil, err
+		}
+		registered.paramsStore = paramsStore
+	}
+
+	return registered.paramsStore, nil
+}
+
 var LOG_LEVEL = log.InfoLevel
 
+// BUNDLE_HASH will be replaced during build with a hash of the embedded files
+var BUNDLE_HASH = ""
+
+// BUILD_TIME and CMDEAGLE_VERSION will be replaced during build with when and by which cmdeagle the CLI was built
+var BUILD_TIME = ""
+var CMDEAGLE_VERSION = ""
+
+// dataDirPath is where the bundle of this version of the CLI is extracted, and where scripts run
+var dataDirPath string
+
 func init() {
 	// DEBUG_MODE will be replaced during build
 	log.SetLevel(LOG_LEVEL)
 	log.SetFormatter(log.TextFormatter)
+	// Secret args and flags never show up in logs
+	log.SetOutput(params.RedactWriter(os.Stderr))
 	cobra.EnableTraverseRunHooks = true
 }
 
 func main_template() {
-	if err := execute(); err != nil {
-		log.Fatal("execution failed", "error", err)
-		os.Exit(1)
+	err := execute()
+	if err != nil && !executable.IsSilent(err) {
+		fmt.Fprintln(os.Stderr, "Error:", params.Redact(err.Error()))
 	}
+
+	os.Exit(executable.GetExitCode(err))
 }
 
 func execute() error {
+	return executeBundle(embeddedFS)
+}
+
+// executeBundle runs the CLI of a bundle, which is the embedded one except in tests.
+func executeBundle(embedded fs.FS) error {
 	log.Debug("Executing...")
 
 	var err error
 	var cmdConfig *types.CmdeagleConfig
 
+	bundleFS, err = executable.OpenBundle(embedded)
+	if err != nil {
+		return executable.NewExitError(executable.ExitCodeInternal, fmt.Errorf("Failed to open embedded bundle: %w", err))
+	}
+
 	_, cmdConfig, err = config.LoadFromBundle(bundleFS)
 	if err != nil {
-		return fmt.Errorf("Failed to load configuration from embedded bundle: %w", err)
+		return executable.NewExitError(executable.ExitCodeInternal, fmt.Errorf("Failed to load configuration from embedded bundle: %w", err))
+	}
+
+	// Updates on Windows leave the previous executable next to this one, which can only be removed now
+	if cmdConfig.Update != nil {
+		if updater, err := newUpdater(cmdConfig); err == nil {
+			update.RemoveReplacedExecutable(updater.Executable)
+		}
+	}
+
+	cleanupBundle, err := setupDataDir(cmdConfig)
+	if err != nil {
+		return executable.NewExitError(executable.ExitCodeInternal, fmt.Errorf("Failed to setup data directory: %w", err))
+	}
+	defer cleanupBundle()
+
+	localesDir := ""
+	if cmdConfig.Locales != "" {
+		localesDir = path.Clean(cmdConfig.Locales)
+	}
+
+	locale := params.DetectLocale()
+	log.Debug("Loading validation messages", "locale", locale, "locales", localesDir)
+	if err := params.Messages.LoadLocale(locale, bundleFS, localesDir); err != nil {
+		return executable.NewExitError(executable.ExitCodeInternal, fmt.Errorf("Failed to load validation messages for locale %s: %w", locale, err))
 	}
 
 	rootCommandDef := &types.CommandDefinition{
-		Name:        cmdConfig.Name,
-		Description: cmdConfig.Description,
-		Aliases:     []string{},
-		Args:        cmdConfig.Args,
-		Flags:       cmdConfig.Flags,
-		Requires:    cmdConfig.Requires,
-		Includes:    cmdConfig.Includes,
-		Build:       cmdConfig.Build,
-		Validate:    cmdConfig.Validate,
-		Start:       cmdConfig.Start,
+		Name:            cmdConfig.Name,
+		Description:     cmdConfig.Description,
+		Aliases:         []string{},
+		Args:            cmdConfig.Args,
+		Flags:           cmdConfig.Flags,
+		Requires:        cmdConfig.Requires,
+		Includes:        cmdConfig.Includes,
+		Build:           cmdConfig.Build,
+		Validate:        cmdConfig.Validate,
+		Start:           cmdConfig.Start,
+		Shell:           cmdConfig.Shell,
+		Run:             cmdConfig.Run,
+		Argv:            cmdConfig.Argv,
+		Call:            cmdConfig.Call,
+		Steps:           cmdConfig.Steps,
+		Jobs:            cmdConfig.Jobs,
+		ContinueOnError: cmdConfig.ContinueOnError,
+		StepOutput:      cmdConfig.StepOutput,
+		Env:             cmdConfig.Env,
+		EnvFiles:        cmdConfig.EnvFiles,
+		RequiredEnv:     cmdConfig.RequiredEnv,
+		InheritEnv:      cmdConfig.InheritEnv,
+		AllowEnv:        cmdConfig.AllowEnv,
+		KillTimeout:     cmdConfig.KillTimeout,
+		Timeout:         cmdConfig.Timeout,
+		Retry:           cmdConfig.Retry,
+		Interactive:     cmdConfig.Interactive,
+		Exec:            cmdConfig.Exec,
+		PassArgs:        cmdConfig.PassArgs,
+		Output:          cmdConfig.Output,
+		Columns:         cmdConfig.Columns,
+		Hooks:           cmdConfig.Hooks,
 	}
 
 	// Set up the root command
 	rootCmd, err = registerCommandDef(cmdConfig, rootCommandDef, nil, []string{})
+	if err != nil {
+		return executable.NewExitError(executable.ExitCodeInternal, fmt.Errorf("failed to setup root command: %w", err))
+	}
 
 	// Enhanced metadata display
 	rootCmd.Version = cmdConfig.Version
@@ -88,16 +230,33 @@ License: %s`, cmdConfig.Description, cmdConfig.Version, cmdConfig.Author, cmdCon
 		DisableDefaultCmd: !cmdConfig.Completion,
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to setup root command: %w", err)
-	}
+	// Errors are reported by main_template, which also picks the exit code
+	rootCmd.SilenceErrors = true
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return executable.NewExitError(executable.ExitCodeUsage, err)
+	})
 
-	rootCmd.Version = cmdConfig.Version
+	// A command that declares a flag with the same name shadows these
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Show what the command would run, without running anything")
+	rootCmd.PersistentFlags().BoolVar(&explainMode, "explain", false, "Like --dry-run, and also show where each value came from and which checks were evaluated")
+	rootCmd.PersistentFlags().DurationVar(&timeoutOverride, "timeout", 0, "Stop the command if it runs longer than this, e.g. 5m (0 for no limit)")
+	rootCmd.PersistentFlags().IntVar(&retriesOverride, "retries", 0, "Run the command again up to this many times if it fails")
+	rootCmd.PersistentFlags().IntVar(&jobsOverride, "jobs", 0, "How many steps may run at the same time (0 for the number of CPUs)")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", "", "How to show the data a command prints: table, json, yaml, csv or template=<go-template> (default table)")
+	rootCmd.PersistentFlags().BoolVar(&verifyBundle, "verify", false, "Check every bundled file the command uses against its hash, not just its size and time")
+	for _, name := range []string{"dry-run", "explain", "timeout", "retries", "jobs", "output", "verify"} {
+		rootCmd.PersistentFlags().SetAnnotation(name, flags.InternalAnnotation, []string{"true"})
+	}
 
 	// Set up all other subcommands
 	visitor := &RunnerCommandVisitor{config: cmdConfig}
 	if err := config.WalkCommands(&cmdConfig.Commands, nil, visitor, []string{}); err != nil {
-		return fmt.Errorf("failed to process commands: %w", err)
+		return executable.NewExitError(executable.ExitCodeInternal, fmt.Errorf("failed to process commands: %w", err))
+	}
+
+	// Commands of the config take precedence over the built-in ones
+	if _, exists := cobraCommands[cmdConfig.Self.CommandName()]; cmdConfig.Self.Enabled() && !exists {
+		rootCmd.AddCommand(newSelfCmd(cmdConfig))
 	}
 
 	log.Debug("Inspecting embedded bundle filesystem...")
@@ -122,11 +281,6 @@ License: %s`, cmdConfig.Description, cmdConfig.Version, cmdConfig.Author, cmdCon
 	// 	return fmt.Errorf("failed to walk embedded filesystem: %w", err)
 	// }
 
-	log.Debug("Setting up data directory")
-	if err := setupDataDirectory(bundleFS, cmdConfig.Name); err != nil {
-		log.Fatalf("Failed to setup data directory: %v", err)
-	}
-
 	// log.Debug("Command tree structure:")
 	// var printCommandTree func(cmd *cobra.Command, level int)
 	// printCommandTree = func(cmd *cobra.Command, level int) {
@@ -140,7 +294,41 @@ License: %s`, cmdConfig.Description, cmdConfig.Version, cmdConfig.Author, cmdCon
 
 	log.Debug("Done")
 
-	return rootCmd.Execute()
+	updateNotice := checkForUpdate(cmdConfig)
+
+	executedCmd, err := rootCmd.ExecuteC()
+	err = runFinalHooks(executedCmd, err)
+	removeTempFiles()
+	showUpdateNotice(updateNotice, cmdConfig)
+	return err
+}
+
+// setupDataDir extracts the bundle where the `extraction` setting says, and sets dataDirPath to it. Bundles
+// that can't be used from the data directory are extracted into a temporary directory instead. It returns
+// a function that removes the bundle when it only lasts as long as the CLI runs.
+func setupDataDir(cmdConfig *types.CmdeagleConfig) (func(), error) {
+	appDataDirPath := executable.GetAppDataDir(cmdConfig.Name)
+
+	if cmdConfig.Extraction != executable.ExtractionMemory {
+		reason, err := executable.NeedsTemporaryBundle(bundleFS, appDataDirPath, cmdConfig.Version, BUNDLE_HASH)
+		if err != nil {
+			return nil, err
+		}
+		if reason == "" {
+			log.Debug("Setting up data directory")
+			dataDirPath, err = executable.InstallBundle(bundleFS, appDataDirPath, cmdConfig.Version, BUNDLE_HASH, map[string]string{"app": cmdConfig.Name})
+			return func() {}, err
+		}
+		log.Debug("Extracting the bundle into a temporary directory instead", "reason", reason)
+	}
+
+	log.Debug("Extracting the bundle into a temporary directory")
+	dir, cleanup, err := executable.InstallTemporaryBundle(bundleFS, cmdConfig.Name)
+	if err != nil {
+		return nil, err
+	}
+	dataDirPath = dir
+	return cleanup, nil
 }
 
 // RunnerCommandVisitor handles the command processing during runtime
@@ -187,7 +375,7 @@ func registerSubCommandDef(cmdConfig *types.CmdeagleConfig, commandDef *types.Co
 }
 
 func registerCommandDef(cmdConfig *types.CmdeagleConfig, commandDef *types.CommandDefinition, parent *types.CommandDefinition, path []string) (*cobra.Command, error) {
-	appDataDirPath := executable.GetAppDataDir(cmdConfig.Name)
+	appDataDirPath := dataDirPath
 	commandPath := filepath.Join(appDataDirPath, filepath.Join(path...))
 
 	// TODO: This is how we want to organize our logic now. we set up with cobra's lifecycle hooks and then we
@@ -211,42 +399,51 @@ func registerCommandDef(cmdConfig *types.CmdeagleConfig, commandDef *types.Comma
 		cobraCmd.Aliases = commandDef.Aliases
 	}
 
+	killTimeout, err := config.ParseKillTimeout(commandDef.KillTimeout)
+	if err != nil {
+		return nil, err
+	}
+	runOptions := executable.RunOptions{KillTimeout: killTimeout}
+
+	timeout, err := config.ParseTimeout(commandDef.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	retryPolicy, err := config.ParseRetry(commandDef.Retry)
+	if err != nil {
+		return nil, err
+	}
+
+	registered := &registeredCommand{def: commandDef, dir: appDataDirPath, runOptions: runOptions}
+	registeredCommands[cobraCmd] = registered
+
 	// Create flag store
 	flagStore := flags.CreateFlagsStore(cobraCmd, commandDef)
 	log.Debug("Created flagStore", "path", commandPath, "flagStore", flagStore)
+	registered.flagStore = flagStore
 
 	// 1. Global setup for the entire top-level command.
 	cobraCmd.PersistentPreRunE = func(cobraCmd *cobra.Command, args []string) error {
 		log.Debug("PersistentPreRunE / Triggering hook", "path", commandPath)
-		log.Debug("Requires", "path", commandPath, "requires", commandDef.Requires)
-		if commandDef.Requires != nil {
-			for name, versionDeclared := range commandDef.Requires {
-				path, exists := executable.CheckDependencyExists(name)
-
-				if !exists {
-					return fmt.Errorf("dependency %s not found. You need to install it to run this command.", name)
-				}
-
-				if versionDeclared == "*" {
-					continue
-				}
-
-				versionFound, err := executable.GetVersion(path, []string{})
-				if err != nil {
-					return fmt.Errorf("failed to get version for dependency %s: %w", name, err)
-				}
-
-				log.Debug("Dependency version", "name", name, "versionFound", versionFound, "versionDeclared", versionDeclared)
-
-				matchesRequirement, reason := executable.CheckVersionCompatibility(versionFound, versionDeclared)
-				if !matchesRequirement {
-					return fmt.Errorf("dependency %s version %s does not meet the required version %s: %s", name, versionFound, versionDeclared, reason)
-				}
+		if registeredCommands[cobraCmd] == nil {
+			// Built-in commands, such as `completion` and `self`, don't need what the CLI's commands require
+			return nil
+		}
+		if isDryRun() {
+			// Requirements are reported along with the rest of the dry run
+			return nil
+		}
 
+		log.Debug("Requires", "path", commandPath, "requires", commandDef.Requires)
+		for _, requirement := range resolveRequires(commandDef) {
+			if requirement.Err != nil {
+				return executable.NewExitError(executable.ExitCodeMissingRequirement, requirement.Err)
 			}
 		}
+
 		log.Debug("Triggering hook `PersistentPreRunE`", "path", commandPath)
-		return nil
+		return runHook(registered, "persistent-before", getHooks(commandDef).PersistentBefore, registeredCommands[cobraCmd])
 	}
 
 	// 2. Parse, validate and load arguments and flags..
@@ -256,56 +453,138 @@ func registerCommandDef(cmdConfig *types.CmdeagleConfig, commandDef *types.Comma
 
 	cobraCmd.Args = func(cobraCommand *cobra.Command, arguments []string) error {
 		log.Debug("Triggering hook `Args`", "path", commandPath)
-		argStore = args.CreateArgsStore(cobraCommand, &commandDef.Args, arguments)
-		log.Debug("Created argsStore", "path", commandPath, "argsStore", argStore)
+		if explainMode {
+			params.TraceChecks()
+		}
 
-		paramsStore = config.CreateParamsStore(argStore, flagStore)
-		log.Debug("Created paramsStore", "path", commandPath, "paramsStore", paramsStore)
+		// The command's files are extracted before anything of it runs, env files included
+		if !isDryRun() {
+			if err := executable.ExtractCommandFiles(bundleFS, appDataDirPath, getCommandPath(path...)); err != nil {
+				return executable.NewExitError(executable.ExitCodeInternal, fmt.Errorf("Failed to extract the files of the command: %w", err))
+			}
 
-		log.Debug("Validating args", "path", commandPath, "argsStore", argStore, "commandDef.Args", commandDef.Args)
-		err := args.ValidateArgs(cobraCommand, &commandDef.Args, argStore)
+			changed, err := executable.VerifyCommandFiles(bundleFS, appDataDirPath, getCommandPath(path...), verifyBundle)
+			if err != nil {
+				return executable.NewExitError(executable.ExitCodeInternal, fmt.Errorf("Failed to verify the files of the command: %w", err))
+			}
+			if len(changed) > 0 {
+				log.Warn(fmt.Sprintf("Bundled files were changed since they were installed, run `%s self repair` to restore them", rootCmd.Name()), "files", changed)
+			}
+		}
+
+		// Env files are loaded first, since args and flags can fall back to the variables they set
+		workingDir, err := os.Getwd()
 		if err != nil {
 			return err
 		}
+		fileVars, err := config.LoadEnvFiles(commandDef.EnvFiles, workingDir, appDataDirPath)
+		if err != nil {
+			return executable.NewExitError(executable.ExitCodeMissingRequirement, err)
+		}
+		envvar.SetFileVars(fileVars)
+
+		if err := flagStore.ApplyEnv(); err != nil {
+			return executable.NewExitError(executable.ExitCodeUsage, err)
+		}
 
-		log.Debug("Validating flags", "path", commandPath, "flagStore", flagStore, "commandDef.Flags", commandDef.Flags)
-		err = flags.ValidateFlags(cobraCommand, commandDef.Flags, flagStore)
+		// Arguments after `--` go to the start script untouched, rather than filling the declared ones
+		var rest []string
+		if dash := cobraCommand.ArgsLenAtDash(); dash >= 0 && !registered.called {
+			arguments, rest = arguments[:dash], arguments[dash:]
+		}
+
+		arguments, prompted, err := promptSecretArgs(commandDef.Args, arguments)
 		if err != nil {
 			return err
 		}
 
-		if commandDef.Validate != "" {
-			log.Debug("Running custom validation script", "path", commandPath, "commandDef.Validate", commandDef.Validate)
-			script := commandDef.Validate
+		argStore = args.CreateArgsStore(cobraCommand, &commandDef.Args, arguments)
+		log.Debug("Created argsStore", "path", commandPath, "argsStore", argStore)
+		for _, name := range prompted {
+			argStore.Get(name).Source = params.SourcePrompt
+		}
 
-			binDirPath, err := executable.GetDestDir()
-			if err != nil {
-				return fmt.Errorf("failed to get binary directory: %w", err)
+		var promptFlag func(name string) (string, error)
+		if executable.CanPrompt() {
+			promptFlag = func(name string) (string, error) {
+				return executable.ReadSecret(fmt.Sprintf("--%s: ", name))
+			}
+		}
+		if err := flagStore.ApplySecretInputs(promptFlag); err != nil {
+			return executable.NewExitError(executable.ExitCodeUsage, err)
+		}
+
+		paramsStore = config.CreateParamsStore(argStore, flagStore)
+		log.Debug("Created paramsStore", "path", commandPath, "paramsStore", paramsStore)
+		registered.paramsStore = paramsStore
+
+		paramsStore.ScriptArgs = rest
+		if commandDef.PassArgs {
+			paramsStore.ScriptArgs = append(append([]string{}, arguments...), rest...)
+		}
+
+		if err := setCLIParams(paramsStore, cmdConfig.Name); err != nil {
+			return err
+		}
+
+		log.Debug("Validating args", "path", commandPath, "argsStore", argStore, "commandDef.Args", commandDef.Args)
+		err = args.ValidateArgs(cobraCommand, &commandDef.Args, argStore)
+		if err == nil {
+			log.Debug("Validating flags", "path", commandPath, "flagStore", flagStore, "commandDef.Flags", commandDef.Flags)
+			err = flags.ValidateFlags(cobraCommand, commandDef.Flags, flagStore)
+		}
+		if err != nil {
+			if explainMode {
+				// Show the checks that led to the error
+				report := &explain.Report{Command: cobraCommand.CommandPath(), Dir: appDataDirPath}
+				explainParams(report, commandDef, paramsStore)
+				report.Write(os.Stderr)
 			}
-			paramsStore.Set("cli.bin_dir", binDirPath)
-			paramsStore.Set("cli.data_dir", appDataDirPath)
+			return executable.NewExitError(executable.ExitCodeUsage, err)
+		}
 
-			script = argStore.Interpolate(script)
-			script = flagStore.Interpolate(script)
-			script = paramsStore.Interpolate(script)
+		declaredVars, err := config.RenderEnv(commandDef.Env, paramsStore)
+		if err != nil {
+			return err
+		}
+		paramsStore.Environment = config.Environment{
+			Clean:    commandDef.InheritEnv != nil && !*commandDef.InheritEnv,
+			Allow:    commandDef.AllowEnv,
+			Files:    fileVars,
+			Declared: declaredVars,
+		}
 
-			log.Debug("Run / Running custom validation script", "path", commandPath, "script", script)
+		if missing := paramsStore.Environment.Missing(commandDef.RequiredEnv); len(missing) > 0 {
+			return executable.NewExitError(executable.ExitCodeMissingRequirement, fmt.Errorf(
+				"missing required environment variables: %s. Set them in your environment or in an env file", strings.Join(missing, ", ")))
+		}
 
-			execCmd := exec.Command("sh", "-c", script)
+		// A command that replaces the CLI's process can't have its files removed once it's done
+		if err := writeParamsFiles(paramsStore, commandDef.Exec && executable.ExecReplacesProcess); err != nil {
+			return err
+		}
 
-			// Copy the current environment and add new variables iteratively
-			envVars := append(paramsStore.GetEnvVariables(), append(argStore.GetEnvVariables(), flagStore.GetEnvVariables()...)...)
-			execCmd.Env = os.Environ() // Start with the current environment
-			for _, env := range envVars {
-				log.Debug("Run / Setting environment variable", "path", commandPath, "env", env.Name+"="+env.Value)
-				execCmd.Env = append(execCmd.Env, env.Name+"="+env.Value)
+		if isDryRun() {
+			// Outputs are only set once the scripts that set them have run
+			for cmd := cobraCommand; cmd != nil; cmd = cmd.Parent() {
+				for _, name := range config.ReferencedOutputs(registeredCommands[cmd].def) {
+					paramsStore.Set("outputs."+name, "<output "+name+">")
+				}
 			}
+		}
 
-			execCmd.Dir = appDataDirPath
-			execCmd.Stdout = os.Stdout
-			execCmd.Stderr = os.Stderr
+		if commandDef.Validate != "" && !isDryRun() {
+			log.Debug("Running custom validation script", "path", commandPath, "commandDef.Validate", commandDef.Validate)
+			execCmd, err := newScriptCmd(commandDef, "validate script", commandDef.Validate, paramsStore, appDataDirPath)
+			if err != nil {
+				return err
+			}
 
-			if err := execCmd.Run(); err != nil {
+			if err := executable.Run(execCmd, controlled(runOptions, paramsStore, "")); err != nil {
+				if executable.IsSilent(err) {
+					// The script exited with an error, and is expected to have explained why itself
+					return &executable.ExitError{Code: executable.ExitCodeValidation, Err: err, Silent: true}
+				}
 				return err
 			}
 		}
@@ -317,14 +596,14 @@ func registerCommandDef(cmdConfig *types.CmdeagleConfig, commandDef *types.Comma
 	// 3. Interpolate args and flags into the start script
 	cobraCmd.PreRunE = func(cobraCmd *cobra.Command, args []string) error {
 		log.Debug("Triggering hook `PreRunE`", "path", commandPath)
-		return nil
+		return runHook(registered, "before", getHooks(commandDef).Before, registered)
 	}
 
 	// 4. Run the start script
 	cobraCmd.RunE = func(cobraCmd *cobra.Command, args []string) error {
 		log.Debug("Run / Triggering hook", "path", commandPath)
 
-		if commandDef.Start == "" {
+		if !hasStart(commandDef) {
 			log.Debug("No start script defined for command", "path", commandPath, "commandDef.Start", commandDef.Start)
 			// If there's no start script, just show help
 			if commandDef.Start == "" || parent == nil {
@@ -333,38 +612,63 @@ func registerCommandDef(cmdConfig *types.CmdeagleConfig, commandDef *types.Comma
 			return nil
 		}
 
-		// Interpolate both args and flags into the start script
-		script := commandDef.Start
+		startOptions := executable.RunOptions{KillTimeout: killTimeout, Interactive: commandDef.Interactive, Timeout: timeout}
+		if rootCmd.PersistentFlags().Changed("timeout") {
+			startOptions.Timeout = timeoutOverride
+		}
 
-		// Interpolate args and flags
-		binDirPath, err := executable.GetDestDir()
-		if err != nil {
-			return fmt.Errorf("failed to get binary directory: %w", err)
-		}
-		paramsStore.Set("cli.bin_dir", binDirPath)
-		paramsStore.Set("cli.data_dir", appDataDirPath)
-		// TODO: Useful?
-		// cmdVisitor.paramStore.Set("LOG_LEVEL", "debug")
-		paramsStore.Set("cli.name", cmdConfig.Name)
-		// cmdVisitor.paramStore.Set("CMD_VERSION", cmdConfig.Version)
-		// cmdVisitor.paramStore.Set("CMD_DESCRIPTION", cmdConfig.Description)
-		// cmdVisitor.paramStore.Set("CMD_AUTHOR", cmdConfig.Author)
-		// cmdVisitor.paramStore.Set("CMD_LICENSE", cmdConfig.License)
-		script = argStore.Interpolate(script)
-		script = flagStore.Interpolate(script)
-		script = paramsStore.Interpolate(script)
+		if len(commandDef.Call) > 0 {
+			if isDryRun() {
+				// The called commands are run in dry-run mode as well, and describe themselves
+				report, err := newReport(cobraCmd, registered, nil)
+				if err != nil {
+					return err
+				}
+				if err := report.Write(os.Stdout); err != nil {
+					return err
+				}
+			}
+
+			log.Debug("Run / Calling commands", "path", commandPath)
+			return callCommands(cobraCmd, commandDef.Call, paramsStore)
+		}
+
+		if len(commandDef.Steps) > 0 {
+			if isDryRun() {
+				report, err := newReport(cobraCmd, registered, nil)
+				if err != nil {
+					return err
+				}
+				return report.Write(os.Stdout)
+			}
+
+			log.Debug("Run / Running steps", "path", commandPath)
+			return runSteps(commandDef, paramsStore, appDataDirPath, startOptions)
+		}
 
 		// 4. Run the command
-		log.Debug("Run / Running start script for", "path", commandPath, "script", script)
+		execCmd, err := newStartCmd(commandDef, paramsStore, appDataDirPath)
+		if err != nil {
+			return err
+		}
 
-		execCmd := exec.Command("sh", "-c", script)
+		// Start scripts with an `output` print data, which is rendered once they're done
+		var renderer *output.Renderer
+		if commandDef.Output != "" {
+			renderer, err = output.NewRenderer(outputFormat, commandDef.Columns, output.IsTerminal(os.Stdout))
+			if err != nil {
+				return executable.NewExitError(executable.ExitCodeUsage, err)
+			}
+		} else if rootCmd.PersistentFlags().Changed("output") {
+			log.Warn("--output only applies to commands that print data")
+		}
 
-		// Copy the current environment and add new variables iteratively
-		envVars := append(paramsStore.GetEnvVariables(), append(argStore.GetEnvVariables(), flagStore.GetEnvVariables()...)...)
-		execCmd.Env = os.Environ() // Start with the current environment
-		for _, env := range envVars {
-			log.Debug("Run / Setting environment variable", "path", commandPath, "env", env.Name+"="+env.Value)
-			execCmd.Env = append(execCmd.Env, env.Name+"="+env.Value)
+		if isDryRun() {
+			report, err := newReport(cobraCmd, registered, execCmd)
+			if err != nil {
+				return err
+			}
+			return report.Write(os.Stdout)
 		}
 
 		// We don't want to run the command in the command's directory, we want to run it in the root command's directory
@@ -372,22 +676,55 @@ func registerCommandDef(cmdConfig *types.CmdeagleConfig, commandDef *types.Comma
 		// We don't have a way to opt out of this yet, but we can change this later
 		// execCmd.Dir = commandPath
 		// execCmd.Dir = filepath.Join(runnerSrcDistDir, cmdConfig.Name)
-		execCmd.Dir = appDataDirPath
-		execCmd.Stdout = os.Stdout
-		execCmd.Stderr = os.Stderr
 
-		log.Debug("#########OUTPUT############")
-		if err := execCmd.Run(); err != nil {
-			return err
+		// Only the start script reads the CLI's stdin, so it can consume piped input and prompt the user
+		execCmd.Stdin = os.Stdin
+
+		if commandDef.Exec {
+			if rootCmd.PersistentFlags().Changed("timeout") || rootCmd.PersistentFlags().Changed("retries") {
+				log.Warn("--timeout and --retries don't apply to commands that replace the CLI's process")
+			}
+			log.Debug("Run / Replacing process with start script", "path", commandPath)
+			return executable.Exec(execCmd)
 		}
-		log.Debug("###########################")
 
-		return nil
+		policy := retryPolicy
+		if rootCmd.PersistentFlags().Changed("retries") {
+			policy.Attempts = retriesOverride + 1
+		}
+
+		for attempt := 1; ; attempt++ {
+			var captured bytes.Buffer
+			if renderer != nil {
+				execCmd.Stdout = &captured
+			}
+
+			err := executable.Run(execCmd, controlled(startOptions, paramsStore, ""))
+			if !policy.ShouldRetry(attempt, err) {
+				if renderer != nil {
+					return renderOutput(renderer, captured.Bytes(), err)
+				}
+				return err
+			}
+
+			delay := policy.Delay(attempt)
+			log.Warn("Command failed, retrying", "attempt", attempt, "attempts", policy.Attempts, "exit-code", executable.GetExitCode(err), "delay", delay)
+			if err := policy.Wait(attempt); err != nil {
+				return err
+			}
+
+			// The script is interpolated again so it can use the new `cli.attempt`
+			paramsStore.Set("cli.attempt", fmt.Sprint(attempt+1))
+			if execCmd, err = newStartCmd(commandDef, paramsStore, appDataDirPath); err != nil {
+				return err
+			}
+			execCmd.Stdin = os.Stdin
+		}
 	}
 
 	cobraCmd.PostRunE = func(cobraCmd *cobra.Command, args []string) error {
 		log.Debug("PostRunE / Triggering hook", "path", commandPath)
-		return nil
+		return runHook(registered, "after", getHooks(commandDef).After, registered)
 	}
 
 	// 1. Global teardown for the entire top-level command.
@@ -397,7 +734,7 @@ func registerCommandDef(cmdConfig *types.CmdeagleConfig, commandDef *types.Comma
 	// - Handle dependencies specified via `requires` settings
 	cobraCmd.PersistentPostRunE = func(cobraCmd *cobra.Command, args []string) error {
 		log.Debug("PersistentPostRunE / Triggering hook", "path", commandPath)
-		return nil
+		return runHook(registered, "persistent-after", getHooks(commandDef).PersistentAfter, registeredCommands[cobraCmd])
 	}
 
 	// Allow help to bypass SilenceUsage
@@ -409,90 +746,1056 @@ func registerCommandDef(cmdConfig *types.CmdeagleConfig, commandDef *types.Comma
 	return cobraCmd, nil
 }
 
-func setupDataDirectory(embeddedFS embed.FS, appName string) error {
-	// Get the app-specific data directory
-	appDataDir := executable.GetAppDataDir(appName)
+// setCLIParams exposes information about the CLI itself to scripts, as `{{cli.*}}` and `CLI_*` variables.
+func setCLIParams(paramsStore *config.ParamsStateStore, appName string) error {
+	binDirPath, err := executable.GetDestDir()
+	if err != nil {
+		return fmt.Errorf("failed to get binary directory: %w", err)
+	}
+
+	selfPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	paramsStore.Set("cli.bin_dir", binDirPath)
+	// Lets scripts invoke the CLI again, whatever it's installed as
+	paramsStore.Set("cli.self", selfPath)
+	paramsStore.Set("cli.data_dir", dataDirPath)
+	paramsStore.Set("cli.params_file", "")
+	paramsStore.Set("cli.secrets_file", "")
+	paramsStore.Set("cli.name", appName)
+	// Counts the runs of the start script when it's retried
+	paramsStore.Set("cli.attempt", "1")
+
+	return nil
+}
+
+func getHooks(commandDef *types.CommandDefinition) *types.HooksDefinition {
+	if commandDef.Hooks == nil {
+		return &types.HooksDefinition{}
+	}
+	return commandDef.Hooks
+}
 
-	// Check if manifest already exists
-	if _, err := os.Stat(filepath.Join(appDataDir, ".manifest.json")); err == nil {
-		log.Debug("Manifest already exists, skipping bundle extraction")
+// runHook runs a hook script declared on one command with the params of the command being executed, which
+// is either the same command or one of its descendants. Hooks only run for commands that do something:
+// a command without a start script just shows its help.
+func runHook(declaring *registeredCommand, name string, script string, executed *registeredCommand) error {
+	if script == "" || executed == nil || !hasStart(executed.def) || isDryRun() {
+		return nil
+	}
+	if strings.HasPrefix(name, "persistent-") && declaring.callers > 0 {
+		// They run once for the calling command, not again for each command it calls
 		return nil
 	}
 
-	// Create the directory if it doesn't exist
-	if err := os.MkdirAll(appDataDir, 0755); err != nil {
-		return fmt.Errorf("failed to create data directory: %w", err)
+	paramsStore, err := executed.getParamsStore()
+	if err != nil {
+		return err
 	}
 
-	// Initialize manifest to track all files
-	manifest := struct {
-		Files []string          `json:"files"`
-		Time  time.Time         `json:"created_at"`
-		Meta  map[string]string `json:"meta"`
-	}{
-		Files: []string{},
-		Time:  time.Now(),
-		Meta:  map[string]string{"app": appName},
+	log.Debug("Running hook", "hook", name, "command", declaring.def.Name)
+	execCmd, err := newScriptCmd(declaring.def, name+" hook", script, paramsStore, executed.dir)
+	if err != nil {
+		return err
 	}
+	execCmd.Stdin = os.Stdin
 
-	// Walk through embedded filesystem and copy files
-	err := fs.WalkDir(embeddedFS, ".", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
+	return executable.Run(execCmd, controlled(declaring.runOptions, paramsStore, ""))
+}
 
-		// Skip root directory
-		if path == "." {
-			return nil
-		}
+// runFinalHooks runs the `on-error` and `finally` hooks of the executed command and its parents, from the
+// innermost command outwards. They can't change the outcome of the command, except that a failing
+// `finally` hook fails a command that succeeded so far.
+func runFinalHooks(executedCmd *cobra.Command, err error) error {
+	executed := registeredCommands[executedCmd]
+	if executed == nil {
+		return err
+	}
 
-		targetPath := filepath.Join(appDataDir, path)
+	paramsStore, paramsErr := executed.getParamsStore()
+	if paramsErr != nil {
+		log.Warn("Skipping hooks", "error", paramsErr)
+		return err
+	}
 
-		// Create directories
-		if d.IsDir() {
-			if err := os.MkdirAll(targetPath, 0755); err != nil {
-				return fmt.Errorf("failed to create directory %s: %w", targetPath, err)
-			}
-			// // Print directory creation (preserving existing logging)
-			// indent := strings.Repeat("  ", len(strings.Split(path, "/")))
-			// fmt.Println(indent + "📁 " + d.Name())
-			return nil
+	errorMessage := ""
+	if err != nil {
+		errorMessage = err.Error()
+	}
+	paramsStore.Set("cli.exit_code", fmt.Sprint(executable.GetExitCode(err)))
+	paramsStore.Set("cli.error", errorMessage)
+
+	runFinalHook := func(cmd *cobra.Command, name string, script string) error {
+		hookErr := runHook(registeredCommands[cmd], name, script, executed)
+		if hookErr != nil {
+			log.Warn("Hook failed", "hook", name, "command", cmd.Name(), "error", hookErr)
 		}
+		return hookErr
+	}
 
-		// Read and write files
-		data, err := embeddedFS.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("failed to read embedded file %s: %w", path, err)
+	if err != nil {
+		for cmd := executedCmd; cmd != nil; cmd = cmd.Parent() {
+			hooks := getHooks(registeredCommands[cmd].def)
+			if cmd == executedCmd {
+				runFinalHook(cmd, "on-error", hooks.OnError)
+			}
+			runFinalHook(cmd, "persistent-on-error", hooks.PersistentOnError)
 		}
+	}
 
-		if err := os.WriteFile(targetPath, data, 0644); err != nil {
-			return fmt.Errorf("failed to write file %s: %w", targetPath, err)
+	for cmd := executedCmd; cmd != nil; cmd = cmd.Parent() {
+		hooks := getHooks(registeredCommands[cmd].def)
+		if cmd == executedCmd {
+			if hookErr := runFinalHook(cmd, "finally", hooks.Finally); hookErr != nil && err == nil {
+				err = hookErr
+			}
 		}
+		if hookErr := runFinalHook(cmd, "persistent-finally", hooks.PersistentFinally); hookErr != nil && err == nil {
+			err = hookErr
+		}
+	}
 
-		// Add to manifest
-		manifest.Files = append(manifest.Files, path)
+	return err
+}
 
-		// // Print file creation (preserving existing logging)
-		// indent := strings.Repeat("  ", len(strings.Split(path, "/")))
-		// fmt.Println(indent + "📄 " + d.Name())
+// resolveRequires looks up the executables a command requires, and checks their versions against the
+// declared constraints. Requirements that aren't met have an error explaining why.
+func resolveRequires(commandDef *types.CommandDefinition) []explain.Requirement {
+	names := make([]string, 0, len(commandDef.Requires))
+	for name := range commandDef.Requires {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-		return nil
-	})
+	requirements := []explain.Requirement{}
+	for _, name := range names {
+		versionDeclared := commandDef.Requires[name]
+		requirement := explain.Requirement{Name: name, Declared: versionDeclared}
 
-	if err != nil {
-		return fmt.Errorf("failed to copy embedded files: %w", err)
+		path, exists := executable.CheckDependencyExists(name)
+		requirement.Path = path
+
+		if !exists {
+			requirement.Err = fmt.Errorf("dependency %s not found. You need to install it to run this command.", name)
+		} else if versionDeclared != "*" {
+			versionFound, err := executable.GetVersion(path, []string{})
+			requirement.Version = versionFound
+
+			log.Debug("Dependency version", "name", name, "versionFound", versionFound, "versionDeclared", versionDeclared)
+
+			if err != nil {
+				requirement.Err = fmt.Errorf("failed to get version for dependency %s: %w", name, err)
+			} else if matchesRequirement, reason := executable.CheckVersionCompatibility(versionFound, versionDeclared); !matchesRequirement {
+				requirement.Err = fmt.Errorf("dependency %s version %s does not meet the required version %s: %s", name, versionFound, versionDeclared, reason)
+			}
+		}
+
+		requirements = append(requirements, requirement)
 	}
 
-	// Write manifest file
-	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	return requirements
+}
+
+// newReport describes what running the command would do, without running anything: the start script,
+// validate script and hooks as they would be interpolated, the requirements of the command and its
+// parents, and the variables scripts would get.
+func newReport(executedCmd *cobra.Command, executed *registeredCommand, startCmd *exec.Cmd) (*explain.Report, error) {
+	paramsStore, err := executed.getParamsStore()
 	if err != nil {
-		return fmt.Errorf("failed to create manifest: %w", err)
+		return nil, err
 	}
 
-	manifestPath := filepath.Join(appDataDir, ".manifest.json")
-	if err := os.WriteFile(manifestPath, manifestData, 0644); err != nil {
-		return fmt.Errorf("failed to write manifest: %w", err)
+	report := &explain.Report{
+		Command: executedCmd.CommandPath(),
+		Dir:     executed.dir,
+		Env:     redactSecretEnv(append(paramsStore.Environment.Vars(), paramsStore.GetEnvVariables()...), paramsStore),
 	}
 
-	return nil
+	// Cobra runs persistent pre-run hooks from the root down, and the others from the command up
+	chain := []*cobra.Command{}
+	for cmd := executedCmd; cmd != nil; cmd = cmd.Parent() {
+		chain = append([]*cobra.Command{cmd}, chain...)
+	}
+
+	for _, cmd := range chain {
+		report.Requires = append(report.Requires, resolveRequires(registeredCommands[cmd].def)...)
+	}
+
+	if executed.def.Validate != "" {
+		validateCmd, err := newScriptCmd(executed.def, "validate script", executed.def.Validate, paramsStore, executed.dir)
+		if err != nil {
+			return nil, err
+		}
+		script := describeCmd("Validate script", validateCmd, true)
+		report.Validate = &script
+	}
+
+	if startCmd != nil {
+		start := describeCmd("Start", startCmd, executed.def.Run == nil && len(executed.def.Argv) == 0)
+		report.Start = &start
+	}
+
+	for _, call := range executed.def.Call {
+		argv, err := getCallArgv(call, paramsStore)
+		if err != nil {
+			return nil, err
+		}
+		report.Calls = append(report.Calls, explain.Script{Name: "Call " + call.Command, Argv: append([]string{executedCmd.Root().Name()}, argv...)})
+	}
+
+	plan, err := steps.Plan(executed.def.Steps)
+	if err != nil {
+		return nil, err
+	}
+	for i, step := range plan {
+		stepDef := executed.def.Steps[i]
+		stepCmd, err := newScriptCmd(executed.def, "step "+step.Name, stepDef.Run, paramsStore, executed.dir)
+		if err != nil {
+			return nil, err
+		}
+
+		script := describeCmd("Step "+step.Name, stepCmd, true)
+		when := []string{}
+		if len(step.Needs) > 0 {
+			when = append(when, "needs "+strings.Join(step.Needs, ", "))
+		}
+		if stepDef.If != "" && config.UsesOutputs(steps.Condition(stepDef.If)) {
+			when = append(when, "if "+stepDef.If)
+		} else if stepDef.If != "" {
+			run, err := shouldRunStep(stepDef, paramsStore)
+			if err != nil {
+				return nil, err
+			}
+			if !run {
+				when = append(when, "skipped, "+stepDef.If+" is false")
+			}
+		}
+		script.When = strings.Join(when, "; ")
+		report.Steps = append(report.Steps, script)
+	}
+
+	// The outcome isn't known ahead of time
+	paramsStore.Set("cli.exit_code", "<exit code>")
+	paramsStore.Set("cli.error", "<error>")
+
+	type plannedHook struct {
+		cmd    *cobra.Command
+		name   string
+		script string
+		when   string
+	}
+	planned := []plannedHook{}
+
+	for _, cmd := range chain {
+		planned = append(planned, plannedHook{cmd, "persistent-before", getHooks(registeredCommands[cmd].def).PersistentBefore, "before start"})
+	}
+	planned = append(planned,
+		plannedHook{executedCmd, "before", getHooks(executed.def).Before, "before start"},
+		plannedHook{executedCmd, "after", getHooks(executed.def).After, "after start succeeds"},
+	)
+	for i := len(chain) - 1; i >= 0; i-- {
+		planned = append(planned, plannedHook{chain[i], "persistent-after", getHooks(registeredCommands[chain[i]].def).PersistentAfter, "after start succeeds"})
+	}
+	planned = append(planned, plannedHook{executedCmd, "on-error", getHooks(executed.def).OnError, "if the command fails"})
+	for i := len(chain) - 1; i >= 0; i-- {
+		planned = append(planned, plannedHook{chain[i], "persistent-on-error", getHooks(registeredCommands[chain[i]].def).PersistentOnError, "if the command fails"})
+	}
+	planned = append(planned, plannedHook{executedCmd, "finally", getHooks(executed.def).Finally, "always"})
+	for i := len(chain) - 1; i >= 0; i-- {
+		planned = append(planned, plannedHook{chain[i], "persistent-finally", getHooks(registeredCommands[chain[i]].def).PersistentFinally, "always"})
+	}
+
+	for _, hook := range planned {
+		if hook.script == "" {
+			continue
+		}
+
+		hookCmd, err := newScriptCmd(registeredCommands[hook.cmd].def, hook.name+" hook", hook.script, paramsStore, executed.dir)
+		if err != nil {
+			return nil, err
+		}
+
+		script := describeCmd(fmt.Sprintf("%s hook of %s", hook.name, hook.cmd.CommandPath()), hookCmd, true)
+		script.When = hook.when
+		report.Hooks = append(report.Hooks, script)
+	}
+
+	if explainMode {
+		explainParams(report, executed.def, paramsStore)
+	}
+
+	return report, nil
+}
+
+// describeCmd turns a prepared command into a script for a report. The script of an inline command is the
+// last argument.
+func describeCmd(name string, execCmd *exec.Cmd, inline bool) explain.Script {
+	script := explain.Script{Name: name, Argv: execCmd.Args}
+	if inline && len(execCmd.Args) > 0 {
+		script.Argv = execCmd.Args[:len(execCmd.Args)-1]
+		script.Script = execCmd.Args[len(execCmd.Args)-1]
+	}
+	return script
+}
+
+// explainParams adds where the value of every argument and flag came from to a report, along with the
+// checks evaluated so far.
+func explainParams(report *explain.Report, commandDef *types.CommandDefinition, paramsStore *config.ParamsStateStore) {
+	for _, argDef := range commandDef.Args {
+		entry := paramsStore.Args.Get(argDef.Name)
+		if entry == nil {
+			continue
+		}
+		value := entry.Val
+		if argDef.Secret {
+			value = params.Redacted
+		}
+		report.Params = append(report.Params, explain.Param{Name: argDef.Name, Kind: "arg", Value: value, Source: entry.Source, Env: argDef.Env})
+	}
+
+	for _, flagDef := range commandDef.Flags {
+		value := paramsStore.Flags.GetVal(flagDef.Name)
+		if flagDef.Secret {
+			value = params.Redacted
+		}
+		report.Params = append(report.Params, explain.Param{
+			Name:   flagDef.Name,
+			Kind:   "flag",
+			Value:  value,
+			Source: paramsStore.Flags.GetSource(flagDef.Name),
+			Env:    flagDef.Env,
+		})
+	}
+
+	// The values of secret params are masked in their checks as a whole, like in the params above
+	secretArgs, secretFlags := paramsStore.Args.Secrets(), paramsStore.Flags.Secrets()
+	report.Checks = make([]params.Check, 0, len(params.Checks))
+	for _, check := range params.Checks {
+		_, secretArg := secretArgs[check.Param]
+		_, secretFlag := secretFlags[check.Param]
+		if secretArg || secretFlag {
+			check.Value = params.Redacted
+		}
+		report.Checks = append(report.Checks, check)
+	}
+}
+
+// redactSecretEnv masks the variables that hold the values of secret args and flags, including the
+// positional ones like `ARGS_LIST_0`.
+func redactSecretEnv(env []types.EnvVar, paramsStore *config.ParamsStateStore) []types.EnvVar {
+	secret := map[string]bool{}
+	for key, entry := range paramsStore.Args.Entries {
+		if entry.Def != nil && entry.Def.Secret {
+			secret["ARGS_"+envvar.GetEnvVariableNameFromStateKey(key)] = true
+		}
+	}
+	for name := range paramsStore.Flags.Secrets() {
+		secret["FLAGS_"+envvar.GetEnvVariableNameFromStateKey(name)] = true
+	}
+
+	for i, envVar := range env {
+		if secret[envVar.Name] {
+			env[i].Value = params.Redacted
+		}
+	}
+	return env
+}
+
+// renderOutput shows what a start script with an `output` printed. When the script failed, its output is
+// shown as it is, since it's unlikely to be the data it was meant to print.
+func renderOutput(renderer *output.Renderer, data []byte, err error) error {
+	if err != nil {
+		os.Stdout.Write(data)
+		return err
+	}
+
+	return renderer.Render(os.Stdout, data)
+}
+
+// promptSecretArgs asks for the required secret arguments that are missing, when stdin is a terminal, and
+// returns the arguments with their values appended along with the names of the ones that were asked for.
+// Only arguments that directly follow the given ones are asked for, so that every value keeps its position.
+func promptSecretArgs(argDefs []types.ArgDefinition, arguments []string) ([]string, []string, error) {
+	prompted := []string{}
+	if !executable.CanPrompt() {
+		return arguments, prompted, nil
+	}
+
+	for index, argDef := range argDefs {
+		if index < len(arguments) {
+			continue
+		}
+		if index > len(arguments) || !argDef.Secret || !argDef.Required {
+			break
+		}
+		if _, ok := envvar.Lookup(argDef.Env); argDef.Env != "" && ok {
+			break
+		}
+
+		value, err := executable.ReadSecret(argDef.Name + ": ")
+		if err != nil {
+			return nil, nil, err
+		}
+		arguments = append(arguments, value)
+		prompted = append(prompted, argDef.Name)
+	}
+
+	return arguments, prompted, nil
+}
+
+// tempFiles holds the files written by writeTempFile, which are removed once the CLI is done.
+var tempFiles []string
+
+// writeParamsFiles writes the params JSON of a command to a file and sets `cli.params_file` to its path,
+// since it can be too large for an environment variable. The values of secret arguments and flags are
+// masked in it, and written to a separate file whose path is set as `cli.secrets_file`, as JSON like
+// `{"args": {...}, "flags": {...}}`. With inherit, the files have no name on disk and are reached through
+// the descriptors the script inherits instead.
+func writeParamsFiles(paramsStore *config.ParamsStateStore, inherit bool) error {
+	write := writeTempFile
+	if inherit {
+		write = executable.WriteInheritedFile
+	}
+
+	path, err := write("params", []byte(paramsStore.ToJSONString()))
+	if err != nil {
+		return err
+	}
+	paramsStore.Set("cli.params_file", path)
+
+	argSecrets, flagSecrets := paramsStore.Args.Secrets(), paramsStore.Flags.Secrets()
+	if len(argSecrets) == 0 && len(flagSecrets) == 0 {
+		return nil
+	}
+
+	content, err := json.Marshal(map[string]any{"args": argSecrets, "flags": flagSecrets})
+	if err != nil {
+		return err
+	}
+
+	path, err = write("secrets", content)
+	if err != nil {
+		return err
+	}
+	paramsStore.Set("cli.secrets_file", path)
+
+	return nil
+}
+
+// writeTempFile writes a JSON file that only the user can read, and that's removed once the CLI is done.
+func writeTempFile(name string, content []byte) (string, error) {
+	// os.CreateTemp creates files with the 0600 mode
+	file, err := os.CreateTemp("", "cmdeagle-"+name+"-*.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s file: %w", name, err)
+	}
+	tempFiles = append(tempFiles, file.Name())
+	defer file.Close()
+
+	if _, err := file.Write(content); err != nil {
+		return "", fmt.Errorf("failed to write %s file: %w", name, err)
+	}
+
+	return file.Name(), nil
+}
+
+func removeTempFiles() {
+	for _, path := range tempFiles {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warn("Failed to remove temporary file", "path", path, "error", err)
+		}
+	}
+	tempFiles = nil
+}
+
+// controlled gives a script the control channel, through which it reports progress, logs, asks the user
+// and sets outputs that the scripts after it can use as `{{outputs.<name>}}` and `$OUTPUTS_<NAME>`. The
+// name tells apart scripts that run at the same time, like steps.
+func controlled(runOptions executable.RunOptions, paramsStore *config.ParamsStateStore, name string) executable.RunOptions {
+	runOptions.Control = &control.Handler{
+		Name:   name,
+		LibDir: controlLibDir(paramsStore.Get("cli.data_dir")),
+		SetOutput: func(key string, value string) {
+			log.Debug("Setting output", "name", key, "script", name)
+			paramsStore.Set("outputs."+key, value)
+		},
+	}
+	return runOptions
+}
+
+var installControlLib sync.Once
+var controlLib string
+
+// controlLibDir installs the helper libraries for scripts in the data directory the first time a script
+// runs. Scripts can still use the control channel without them, so failing to install them isn't fatal.
+func controlLibDir(dataDir string) string {
+	installControlLib.Do(func() {
+		dir := filepath.Join(dataDir, ".control")
+		if err := control.InstallLib(dir); err != nil {
+			log.Debug("Failed to install the control channel libraries", "dir", dir, "error", err)
+			return
+		}
+		controlLib = dir
+	})
+	return controlLib
+}
+
+// newSelfCmd creates the `self` command, whose subcommands manage the installation of the CLI itself.
+func newSelfCmd(cmdConfig *types.CmdeagleConfig) *cobra.Command {
+	selfCmd := &cobra.Command{
+		Use:    cmdConfig.Self.CommandName(),
+		Short:  "Manage the installation of this CLI",
+		Hidden: cmdConfig.Self.Hidden(),
+	}
+	appDataDirPath := executable.GetAppDataDir(cmdConfig.Name)
+	// Suggested in messages, whatever the command is called
+	selfCmdPath := cmdConfig.Name + " " + selfCmd.Name()
+
+	selfCmd.AddCommand(&cobra.Command{
+		Use:   "info",
+		Short: "Show the version and build of this CLI, and where it's installed",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			selfPath, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("failed to get executable path: %w", err)
+			}
+
+			builtWith := runtime.Version()
+			if CMDEAGLE_VERSION != "" {
+				builtWith = "cmdeagle " + CMDEAGLE_VERSION + ", " + builtWith
+			}
+			for _, field := range [][2]string{
+				{"Name", cmdConfig.Name},
+				{"Version", cmdConfig.Version},
+				{"Bundle hash", BUNDLE_HASH},
+				{"Built at", BUILD_TIME},
+				{"Built with", builtWith},
+				{"Platform", runtime.GOOS + "/" + runtime.GOARCH},
+				{"Executable", selfPath},
+				{"Data dir", dataDirPath},
+			} {
+				fmt.Fprintf(cmd.OutOrStdout(), "%-12s %s\n", field[0]+":", field[1])
+			}
+			return nil
+		},
+	})
+
+	selfCmd.AddCommand(&cobra.Command{
+		Use:   "env",
+		Short: "Print the CLI_* variables that scripts of this CLI get",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			paramsStore := config.CreateEmptyParamsStore()
+			if err := setCLIParams(paramsStore, cmdConfig.Name); err != nil {
+				return err
+			}
+
+			lines := []string{}
+			for _, envVar := range paramsStore.GetEnvVariables() {
+				// The ones without a value are only set while a command runs
+				if strings.HasPrefix(envVar.Name, "CLI_") && envVar.Value != "" {
+					lines = append(lines, envVar.Name+"="+envVar.Value)
+				}
+			}
+			sort.Strings(lines)
+			fmt.Fprintln(cmd.OutOrStdout(), strings.Join(lines, "\n"))
+			return nil
+		},
+	})
+
+	selfCmd.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "Check the bundled files against their hashes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			changed, err := executable.VerifyBundle(bundleFS, dataDirPath)
+			if err != nil {
+				return executable.NewExitError(executable.ExitCodeInternal, fmt.Errorf("Failed to verify the bundle: %w", err))
+			}
+
+			if len(changed) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "All bundled files are intact")
+				return nil
+			}
+			for _, path := range changed {
+				fmt.Fprintln(cmd.OutOrStdout(), "Changed", path)
+			}
+			return fmt.Errorf("%d bundled files were changed since they were installed, run `%s repair` to restore them", len(changed), selfCmdPath)
+		},
+	})
+
+	selfCmd.AddCommand(&cobra.Command{
+		Use:   "repair",
+		Short: "Restore the bundled files that were changed since they were installed",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repaired, err := executable.RepairBundle(bundleFS, dataDirPath)
+			if err != nil {
+				return executable.NewExitError(executable.ExitCodeInternal, fmt.Errorf("Failed to repair the bundle: %w", err))
+			}
+
+			if len(repaired) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "All bundled files are intact")
+				return nil
+			}
+			for _, path := range repaired {
+				fmt.Fprintln(cmd.OutOrStdout(), "Restored", path)
+			}
+			return nil
+		},
+	})
+
+	selfCmd.AddCommand(&cobra.Command{
+		Use:   "clean",
+		Short: "Remove the extracted bundles, which are extracted again when needed",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := executable.RemoveBundles(appDataDirPath); err != nil {
+				return executable.NewExitError(executable.ExitCodeInternal, err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Removed the extracted bundles from", appDataDirPath)
+			return nil
+		},
+	})
+
+	var yes bool
+	uninstallCmd := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove this CLI, along with its data directory and completion scripts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			selfPath, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("failed to get executable path: %w", err)
+			}
+			if resolved, err := filepath.EvalSymlinks(selfPath); err == nil {
+				selfPath = resolved
+			}
+
+			paths := append(executable.FindCompletionScripts(cmdConfig.Name), appDataDirPath, selfPath)
+			if !yes {
+				if !executable.CanPrompt() {
+					return executable.NewExitError(executable.ExitCodeUsage, fmt.Errorf("pass --yes to uninstall without a terminal"))
+				}
+				fmt.Fprintf(os.Stderr, "This removes:\n  %s\nContinue? [y/N] ", strings.Join(paths, "\n  "))
+				var answer string
+				fmt.Fscanln(os.Stdin, &answer)
+				if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+					return executable.NewExitError(executable.ExitCodeError, fmt.Errorf("uninstall cancelled"))
+				}
+			}
+
+			for _, path := range paths {
+				if err := os.RemoveAll(path); err != nil {
+					return executable.NewExitError(executable.ExitCodeError, fmt.Errorf("failed to remove %s: %w", path, err))
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "Removed", path)
+			}
+			return nil
+		},
+	}
+	uninstallCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Don't ask for confirmation")
+	selfCmd.AddCommand(uninstallCmd)
+
+	if cmdConfig.Update != nil {
+		selfCmd.AddCommand(newSelfUpdateCmd(cmdConfig))
+	}
+
+	return selfCmd
+}
+
+// newSelfUpdateCmd creates the `self update` command, which replaces the CLI with its latest release.
+func newSelfUpdateCmd(cmdConfig *types.CmdeagleConfig) *cobra.Command {
+	var check, force bool
+	updateCmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update this CLI to its latest release",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// This command tells about new versions itself
+			skipUpdateNotice = true
+
+			updater, err := newUpdater(cmdConfig)
+			if err != nil {
+				return executable.NewExitError(executable.ExitCodeInternal, err)
+			}
+
+			if check {
+				release, err := updater.Source.FetchRelease(cmd.Context())
+				if err != nil {
+					return err
+				}
+				newer, err := release.IsNewer(cmdConfig.Version)
+				if err != nil {
+					return err
+				}
+				if !newer {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s %s is the latest version\n", cmdConfig.Name, cmdConfig.Version)
+					return nil
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s is available, you have %s\n", cmdConfig.Name, release.Version, cmdConfig.Version)
+				return nil
+			}
+
+			release, updated, err := updater.Update(cmd.Context(), force)
+			if err != nil {
+				return fmt.Errorf("Failed to update: %w", err)
+			}
+			if !updated {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s %s is the latest version\n", cmdConfig.Name, cmdConfig.Version)
+				return nil
+			}
+
+			// Running the new version installs its bundle, rather than leaving it to the next command
+			versionCmd := exec.Command(updater.Executable, "--version")
+			versionCmd.Stderr = os.Stderr
+			if err := versionCmd.Run(); err != nil {
+				return fmt.Errorf("Updated to %s, but failed to install its bundle: %w", release.Version, err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Updated %s from %s to %s\n", cmdConfig.Name, cmdConfig.Version, release.Version)
+			if release.Notes != "" {
+				fmt.Fprintln(cmd.OutOrStdout(), release.DisplayNotes())
+			}
+			return nil
+		},
+	}
+	updateCmd.Flags().BoolVar(&check, "check", false, "Only tell whether a new version is available")
+	updateCmd.Flags().BoolVar(&force, "force", false, "Install the latest release even if it isn't newer")
+
+	return updateCmd
+}
+
+func newUpdater(cmdConfig *types.CmdeagleConfig) (*update.Updater, error) {
+	selfPath, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executable path: %w", err)
+	}
+	// Symlinks, such as the ones package managers install, are left in place
+	if resolved, err := filepath.EvalSymlinks(selfPath); err == nil {
+		selfPath = resolved
+	}
+
+	return update.NewUpdater(cmdConfig.Update, cmdConfig.Version, selfPath)
+}
+
+// Set by commands after which telling users about a new version would be out of place
+var skipUpdateNotice bool
+
+// checkForUpdate checks for a new version while the command runs, when the `update` setting has `notify`
+// and the user is at a terminal to see it, and has the `self update` command to install it.
+func checkForUpdate(cmdConfig *types.CmdeagleConfig) <-chan *update.Release {
+	if cmdConfig.Update == nil || !cmdConfig.Update.Notify || !cmdConfig.Self.Enabled() || !output.IsTerminal(os.Stderr) {
+		return nil
+	}
+
+	updater, err := newUpdater(cmdConfig)
+	if err != nil {
+		log.Debug("Not checking for updates", "error", err)
+		return nil
+	}
+	interval, err := update.ParseNotifyInterval(cmdConfig.Update)
+	if err != nil {
+		log.Debug("Not checking for updates", "error", err)
+		return nil
+	}
+
+	notice := make(chan *update.Release, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		release, err := updater.CheckForNotice(ctx, executable.GetAppDataDir(cmdConfig.Name), interval)
+		if err != nil {
+			log.Debug("Failed to check for updates", "error", err)
+		}
+		notice <- release
+	}()
+	return notice
+}
+
+// showUpdateNotice tells the user about a new version, if the check found one by the time the command is
+// done. Slow checks aren't waited for long, and they're only tried once per interval anyway.
+func showUpdateNotice(notice <-chan *update.Release, cmdConfig *types.CmdeagleConfig) {
+	if notice == nil || skipUpdateNotice {
+		return
+	}
+
+	select {
+	case release := <-notice:
+		if release != nil {
+			fmt.Fprintf(os.Stderr, "\nA new version of %s is available: %s (you have %s). Run `%s %s update` to update.\n",
+				cmdConfig.Name, release.Version, cmdConfig.Version, cmdConfig.Name, cmdConfig.Self.CommandName())
+		}
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+// hasStart reports whether a command runs something when executed, rather than just showing its help.
+func hasStart(commandDef *types.CommandDefinition) bool {
+	return commandDef.Start != "" || commandDef.Run != nil || len(commandDef.Argv) > 0 || len(commandDef.Call) > 0 || len(commandDef.Steps) > 0
+}
+
+// callCommands runs the commands of a `call` setting in order, in the same process. Each of them is parsed,
+// validated and run along with its hooks, the same way as when it's invoked from the command line, and
+// the first one that fails stops the rest. Persistent hooks that ran for the caller don't run again.
+func callCommands(caller *cobra.Command, calls []types.CallDefinition, paramsStore *config.ParamsStateStore) error {
+	for cmd := caller; cmd != nil; cmd = cmd.Parent() {
+		registeredCommands[cmd].callers++
+		defer func() { registeredCommands[cmd].callers-- }()
+	}
+
+	for _, call := range calls {
+		argv, err := getCallArgv(call, paramsStore)
+		if err != nil {
+			return err
+		}
+
+		callee := registeredCommands[cobraCommands[getCommandPath(strings.Fields(call.Command)...)]]
+		if callee == nil {
+			return fmt.Errorf("call of unknown command %q", call.Command)
+		}
+
+		// A command called more than once must not keep the flags of its previous call
+		if err := callee.flagStore.Reset(); err != nil {
+			return fmt.Errorf("failed to reset flags of command %s: %w", call.Command, err)
+		}
+
+		if isDryRun() {
+			// Keeps the reports of the called commands apart
+			fmt.Println()
+		}
+
+		log.Debug("Run / Calling command", "argv", argv)
+		rootCmd.SetArgs(argv)
+		callee.called = true
+		executedCmd, err := rootCmd.ExecuteC()
+		callee.called = false
+		if err := runFinalHooks(executedCmd, err); err != nil {
+			return fmt.Errorf("command %s failed: %w", call.Command, err)
+		}
+	}
+
+	return nil
+}
+
+// getCallArgv renders a `call` entry into the command line that invokes it, without the CLI's name.
+func getCallArgv(call types.CallDefinition, paramsStore *config.ParamsStateStore) ([]string, error) {
+	argv := strings.Fields(call.Command)
+
+	names := make([]string, 0, len(call.Flags))
+	for name := range call.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := paramsStore.Interpolate(call.Flags[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to interpolate flag %s of call %s: %w", name, call.Command, err)
+		}
+		argv = append(argv, "--"+name+"="+value)
+	}
+
+	if len(call.Args) > 0 {
+		// Arguments may start with a dash
+		argv = append(argv, "--")
+	}
+	for i, arg := range call.Args {
+		value, err := paramsStore.Interpolate(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to interpolate arg[%d] of call %s: %w", i, call.Command, err)
+		}
+		argv = append(argv, value)
+	}
+
+	return argv, nil
+}
+
+// runSteps runs the `steps` of a command as a dependency graph and prints how each of them went. Every
+// step gets the command's timeout, and none of them reads the CLI's stdin since they may run side by side.
+func runSteps(commandDef *types.CommandDefinition, paramsStore *config.ParamsStateStore, dir string, runOptions executable.RunOptions) error {
+	plan, err := steps.Plan(commandDef.Steps)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(plan))
+	for i, step := range plan {
+		names[i] = step.Name
+	}
+
+	output, err := steps.NewOutput(commandDef.StepOutput, os.Stdout, os.Stderr, names)
+	if err != nil {
+		return err
+	}
+
+	// Every step is prepared before any of them runs, so a script that can't be interpolated fails the
+	// command before it has done anything. Steps that use the outputs of other steps are prepared when
+	// they start instead, once those outputs are set
+	stepCmds := map[string]*exec.Cmd{}
+	deferred := map[string]types.StepDefinition{}
+	for _, stepDef := range commandDef.Steps {
+		if config.UsesOutputs(stepDef.Run) || (stepDef.If != "" && config.UsesOutputs(steps.Condition(stepDef.If))) {
+			deferred[stepDef.Name] = stepDef
+			continue
+		}
+
+		stepCmd, err := newStepCmd(commandDef, stepDef, paramsStore, dir)
+		if err != nil {
+			return err
+		}
+		if stepCmd != nil {
+			stepCmds[stepDef.Name] = stepCmd
+		}
+	}
+
+	opts := steps.Options{Jobs: commandDef.Jobs, ContinueOnError: commandDef.ContinueOnError}
+	if rootCmd.PersistentFlags().Changed("jobs") {
+		opts.Jobs = jobsOverride
+	}
+
+	results := steps.Execute(context.Background(), plan, func(ctx context.Context, name string) error {
+		stepCmd := stepCmds[name]
+		if stepDef, ok := deferred[name]; ok {
+			var err error
+			if stepCmd, err = newStepCmd(commandDef, stepDef, paramsStore, dir); err != nil {
+				return err
+			}
+		}
+		if stepCmd == nil {
+			return steps.ErrSkipped
+		}
+
+		// Outputs set by the steps that ran so far are in the environment
+		stepCmd.Env = append(paramsStore.Environ(), "CLI_STEP="+name)
+
+		stdout, stderr, flush := output.StepWriters(name)
+		defer flush()
+		stepCmd.Stdout, stepCmd.Stderr = stdout, stderr
+
+		stepOptions := runOptions
+		stepOptions.Cancel = ctx.Done()
+		log.Debug("Run / Starting step", "step", name)
+		return executable.Run(stepCmd, controlled(stepOptions, paramsStore, name))
+	}, opts)
+
+	fmt.Fprintln(os.Stderr)
+	if err := steps.WriteSummary(os.Stderr, results); err != nil {
+		return err
+	}
+
+	return steps.FirstError(results)
+}
+
+// newStepCmd prepares the script of a step, or returns nil when its `if` condition doesn't hold.
+func newStepCmd(commandDef *types.CommandDefinition, stepDef types.StepDefinition, paramsStore *config.ParamsStateStore, dir string) (*exec.Cmd, error) {
+	run, err := shouldRunStep(stepDef, paramsStore)
+	if err != nil || !run {
+		return nil, err
+	}
+
+	return newScriptCmd(commandDef, "step "+stepDef.Name, stepDef.Run, paramsStore, dir)
+}
+
+// shouldRunStep evaluates the `if` condition of a step. Steps without one always run.
+func shouldRunStep(stepDef types.StepDefinition, paramsStore *config.ParamsStateStore) (bool, error) {
+	if stepDef.If == "" {
+		return true, nil
+	}
+
+	result, err := paramsStore.Interpolate(steps.Condition(stepDef.If))
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate the condition of step %s: %w", stepDef.Name, err)
+	}
+
+	return result == "true", nil
+}
+
+// newStartCmd prepares whatever the command runs when executed: a `run` file, an `argv` executable or
+// the `start` script.
+func newStartCmd(commandDef *types.CommandDefinition, paramsStore *config.ParamsStateStore, dir string) (*exec.Cmd, error) {
+	if commandDef.Run != nil {
+		runFile, err := paramsStore.Interpolate(commandDef.Run.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to interpolate run file: %w", err)
+		}
+
+		log.Debug("Run / Running start file for", "runtime", commandDef.Run.Runtime, "file", runFile)
+		return newRunFileCmd(commandDef.Run.Runtime, runFile, paramsStore, dir, paramsStore.ScriptArgs...)
+	}
+
+	if len(commandDef.Argv) > 0 {
+		return newArgvCmd(commandDef.Argv, paramsStore, dir, paramsStore.ScriptArgs...)
+	}
+
+	return newScriptCmd(commandDef, "start script", commandDef.Start, paramsStore, dir, paramsStore.ScriptArgs...)
+}
+
+// newScriptCmd prepares an inline script to run with the command's interpreter, from the given directory
+// and with the params exposed as environment variables. Values are interpolated into the script escaped
+// for the interpreter, so they can't change what the script does.
+func newScriptCmd(commandDef *types.CommandDefinition, name string, script string, paramsStore *config.ParamsStateStore, dir string, args ...string) (*exec.Cmd, error) {
+	interpreter, err := shell.Resolve(commandDef.Shell)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 && interpreter.NoInlineArgs {
+		return nil, fmt.Errorf("arguments after -- can't be passed to inline %s scripts", interpreter.Name)
+	}
+
+	script, err = paramsStore.InterpolateScript(script, interpreter.Quoting)
+	if err != nil {
+		return nil, fmt.Errorf("failed to interpolate %s: %w", name, err)
+	}
+	log.Debug("Run / Prepared script", "name", name, "interpreter", interpreter.Name, "script", script)
+
+	execCmd := interpreter.Command(script, args...)
+	setupScriptCmd(execCmd, paramsStore, dir)
+
+	return execCmd, nil
+}
+
+// newRunFileCmd prepares a bundled file to run with the given runtime, as declared by the `run` shorthand.
+func newRunFileCmd(runtime string, filePath string, paramsStore *config.ParamsStateStore, dir string, args ...string) (*exec.Cmd, error) {
+	interpreter, err := shell.GetInterpreter(runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	execCmd := interpreter.FileCommand(filePath, args...)
+	setupScriptCmd(execCmd, paramsStore, dir)
+
+	return execCmd, nil
+}
+
+// newArgvCmd prepares the executable of an `argv` start, with each entry rendered into exactly one
+// argument and the given arguments appended. No shell is involved, so values never need quoting.
+func newArgvCmd(argv []string, paramsStore *config.ParamsStateStore, dir string, args ...string) (*exec.Cmd, error) {
+	rendered := make([]string, len(argv))
+	for i, arg := range argv {
+		value, err := paramsStore.Interpolate(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to interpolate argv[%d]: %w", i, err)
+		}
+		rendered[i] = value
+	}
+	log.Debug("Run / Prepared argv", "argv", rendered)
+
+	rendered = append(rendered, args...)
+	execCmd := exec.Command(rendered[0], rendered[1:]...)
+	setupScriptCmd(execCmd, paramsStore, dir)
+
+	return execCmd, nil
+}
+
+func setupScriptCmd(execCmd *exec.Cmd, paramsStore *config.ParamsStateStore, dir string) {
+	execCmd.Env = paramsStore.Environ()
+
+	execCmd.Dir = dir
+	execCmd.Stdout = os.Stdout
+	execCmd.Stderr = os.Stderr
 }
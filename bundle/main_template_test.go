@@ -0,0 +1,315 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/migsc/cmdeagle/executable"
+	"github.com/migsc/cmdeagle/params"
+)
+
+// runCLI runs the CLI of a config with the given arguments and returns its exit code. Every `LOG` in the
+// config is replaced with the path of a file that scripts can append to, whose lines are returned too.
+func runCLI(t *testing.T, configYAML string, arguments ...string) (int, []string) {
+	t.Helper()
+
+	t.Setenv("HOME", t.TempDir())
+	logPath := filepath.Join(t.TempDir(), "log")
+	configYAML = strings.ReplaceAll(configYAML, "LOG", `"`+logPath+`"`)
+
+	// Each run registers its commands anew, as a fresh process would
+	cobraCommands = make(map[string]*cobra.Command)
+	registeredCommands = make(map[*cobra.Command]*registeredCommand)
+	params.ResetSecrets()
+	t.Cleanup(params.ResetSecrets)
+	previousArgs := os.Args
+	os.Args = append([]string{"mycli"}, arguments...)
+	defer func() { os.Args = previousArgs }()
+
+	err := executeBundle(fstest.MapFS{"config.cmd.yaml": {Data: []byte(configYAML)}})
+	if err != nil {
+		t.Log(err)
+	}
+
+	content, readErr := os.ReadFile(logPath)
+	if readErr != nil && !os.IsNotExist(readErr) {
+		require.NoError(t, readErr)
+	}
+	return executable.GetExitCode(err), strings.Fields(string(content))
+}
+
+const hooksConfig = `
+name: mycli
+hooks:
+  persistent-before: echo root-persistent-before >> LOG
+  persistent-after: echo root-persistent-after >> LOG
+  persistent-on-error: echo root-persistent-on-error >> LOG
+  persistent-finally: echo root-persistent-finally >> LOG
+  before: echo root-before >> LOG
+  finally: echo root-finally >> LOG
+commands:
+- name: deploy
+  flags:
+  - name: fail
+    type: string
+    default: ""
+  hooks:
+    persistent-before: echo deploy-persistent-before >> LOG
+    persistent-finally: echo deploy-persistent-finally >> LOG
+    before: '[ "$FLAGS_FAIL" = before ] && exit 4; echo deploy-before >> LOG'
+    after: '[ "$FLAGS_FAIL" = after ] && exit 5; echo deploy-after >> LOG'
+    on-error: echo "deploy-on-error-$CLI_EXIT_CODE" >> LOG
+    finally: '[ "$FLAGS_FAIL" = finally ] && exit 6; echo deploy-finally >> LOG'
+  start: '[ "$FLAGS_FAIL" = start ] && exit 3; echo start >> LOG'
+`
+
+func TestHookOrder(t *testing.T) {
+	code, log := runCLI(t, hooksConfig, "deploy")
+	assert.Equal(t, executable.ExitCodeOK, code)
+	// Persistent `before` hooks run from the root inwards, and all others from the command outwards. The
+	// root's own hooks don't run for its subcommands.
+	assert.Equal(t, []string{
+		"root-persistent-before",
+		"deploy-persistent-before",
+		"deploy-before",
+		"start",
+		"deploy-after",
+		"root-persistent-after",
+		"deploy-finally",
+		"deploy-persistent-finally",
+		"root-persistent-finally",
+	}, log)
+}
+
+func TestFailingHooks(t *testing.T) {
+	tests := []struct {
+		fail string
+		code int
+		log  []string
+	}{
+		{
+			// The script's exit code is the CLI's, and the error hooks run before `finally`
+			fail: "start",
+			code: 3,
+			log: []string{
+				"root-persistent-before", "deploy-persistent-before", "deploy-before",
+				"deploy-on-error-3", "root-persistent-on-error",
+				"deploy-finally", "deploy-persistent-finally", "root-persistent-finally",
+			},
+		},
+		{
+			// A failing `before` hook skips the start script and the hooks after it
+			fail: "before",
+			code: 4,
+			log: []string{
+				"root-persistent-before", "deploy-persistent-before",
+				"deploy-on-error-4", "root-persistent-on-error",
+				"deploy-finally", "deploy-persistent-finally", "root-persistent-finally",
+			},
+		},
+		{
+			fail: "after",
+			code: 5,
+			log: []string{
+				"root-persistent-before", "deploy-persistent-before", "deploy-before", "start",
+				"deploy-on-error-5", "root-persistent-on-error",
+				"deploy-finally", "deploy-persistent-finally", "root-persistent-finally",
+			},
+		},
+		{
+			// A failing `finally` hook fails a command that succeeded, and the other hooks still run
+			fail: "finally",
+			code: 6,
+			log: []string{
+				"root-persistent-before", "deploy-persistent-before", "deploy-before", "start",
+				"deploy-after", "root-persistent-after",
+				"deploy-persistent-finally", "root-persistent-finally",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fail, func(t *testing.T) {
+			code, log := runCLI(t, hooksConfig, "deploy", "--fail", tt.fail)
+			assert.Equal(t, tt.code, code)
+			assert.Equal(t, tt.log, log)
+		})
+	}
+}
+
+func TestHooksOfFailingFinallyKeepTheFirstError(t *testing.T) {
+	code, log := runCLI(t, `
+name: mycli
+commands:
+- name: deploy
+  hooks:
+    finally: echo finally >> LOG; exit 6
+  start: exit 3
+`, "deploy")
+	assert.Equal(t, 3, code)
+	assert.Equal(t, []string{"finally"}, log)
+}
+
+func TestHooksAreSkippedInDryRuns(t *testing.T) {
+	code, log := runCLI(t, hooksConfig, "deploy", "--dry-run")
+	assert.Equal(t, executable.ExitCodeOK, code)
+	assert.Empty(t, log)
+}
+
+const callsConfig = `
+name: mycli
+hooks:
+  persistent-before: echo root-persistent-before >> LOG
+  persistent-finally: echo root-persistent-finally >> LOG
+commands:
+- name: greet
+  args:
+  - name: name
+    default: world
+  flags:
+  - name: loud
+    type: boolean
+  hooks:
+    before: echo greet-before >> LOG
+    finally: echo greet-finally >> LOG
+  start: echo "greet-{{args.name}}-{{flags.loud}}" >> LOG
+- name: group
+  hooks:
+    persistent-before: echo group-persistent-before >> LOG
+  commands:
+  - name: build
+    start: echo build >> LOG
+- name: release
+  call:
+  - command: greet
+    args: [alice]
+    flags:
+      loud: "true"
+  - greet
+  - group build
+`
+
+func TestCallsRunHooksOnce(t *testing.T) {
+	code, log := runCLI(t, callsConfig, "release")
+	assert.Equal(t, executable.ExitCodeOK, code)
+	// The root's persistent hooks ran for `release` and don't run again for the commands it calls, while
+	// those of other parents and the called commands' own hooks do
+	assert.Equal(t, []string{
+		"root-persistent-before",
+		"greet-before", "greet-alice-true", "greet-finally",
+		"greet-before", "greet-world-false", "greet-finally",
+		"group-persistent-before", "build",
+		"root-persistent-finally",
+	}, log)
+}
+
+func TestCallsKeepArgumentsApart(t *testing.T) {
+	// The arguments and flags of the command line don't reach the called commands, whose own ones don't
+	// carry over to the next call
+	code, log := runCLI(t, `
+name: mycli
+commands:
+- name: greet
+  args:
+  - name: name
+    default: world
+  flags:
+  - name: loud
+    type: boolean
+  start: echo "greet-{{args.name}}-{{flags.loud}}" >> LOG
+- name: release
+  args:
+  - name: version
+  flags:
+  - name: loud
+    type: boolean
+  call:
+  - command: greet
+    args: ["{{args.version}}"]
+    flags:
+      loud: "true"
+  - greet
+`, "release", "v1", "--loud=false")
+	assert.Equal(t, executable.ExitCodeOK, code)
+	assert.Equal(t, []string{"greet-v1-true", "greet-world-false"}, log)
+}
+
+func TestCallStopsAtFailure(t *testing.T) {
+	code, log := runCLI(t, `
+name: mycli
+hooks:
+  persistent-on-error: echo "root-persistent-on-error-$CLI_EXIT_CODE" >> LOG
+commands:
+- name: fail
+  hooks:
+    on-error: echo "fail-on-error-$CLI_EXIT_CODE" >> LOG
+  start: exit 3
+- name: greet
+  start: echo greet >> LOG
+- name: release
+  call:
+  - fail
+  - greet
+`, "release")
+	assert.Equal(t, 3, code)
+	assert.Equal(t, []string{"fail-on-error-3", "root-persistent-on-error-3"}, log)
+}
+
+func TestSecretDefaultsAreRedacted(t *testing.T) {
+	code, _ := runCLI(t, `
+name: mycli
+args:
+- name: password
+  secret: true
+  default: dev-password
+flags:
+- name: token
+  type: string
+  secret: true
+  default: dev-token
+- name: port
+  type: int
+  secret: true
+start: "true"
+`)
+	assert.Equal(t, executable.ExitCodeOK, code)
+	assert.Equal(t, "*** *** 0", params.Redact("dev-password dev-token 0"))
+}
+
+func TestSecretsAreRedactedInExplanations(t *testing.T) {
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	require.NoError(t, err)
+	previousStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = previousStdout }()
+
+	// Values this short aren't masked in text, so the fields that hold them are masked instead
+	code, _ := runCLI(t, `
+name: mycli
+args:
+- name: pin
+  secret: true
+  pattern: "^[0-9]+$"
+flags:
+- name: code
+  type: string
+  secret: true
+start: "true"
+`, "--explain", "--code", "xy", "123")
+	assert.Equal(t, executable.ExitCodeOK, code)
+
+	output, err := os.ReadFile(stdout.Name())
+	require.NoError(t, err)
+	assert.Contains(t, string(output), "ARGS_PIN=***")
+	assert.Contains(t, string(output), "FLAGS_CODE=***")
+	assert.Contains(t, string(output), "pin [pattern] ***: ok")
+	assert.NotContains(t, string(output), "123")
+	assert.NotContains(t, string(output), "=xy")
+}
@@ -14,17 +14,25 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/migsc/cmdeagle/bundle"
 	"github.com/migsc/cmdeagle/config"
+	"github.com/migsc/cmdeagle/control"
 	"github.com/migsc/cmdeagle/envvar"
+	"github.com/migsc/cmdeagle/explain"
 	"github.com/migsc/cmdeagle/file"
 	"github.com/migsc/cmdeagle/flags"
+	"github.com/migsc/cmdeagle/interpolation"
+	"github.com/migsc/cmdeagle/output"
 	"github.com/migsc/cmdeagle/params"
+	"github.com/migsc/cmdeagle/shell"
+	"github.com/migsc/cmdeagle/steps"
 
 	"github.com/migsc/cmdeagle/args"
 	"github.com/migsc/cmdeagle/executable"
 	"github.com/migsc/cmdeagle/types"
+	"github.com/migsc/cmdeagle/update"
 
 	"github.com/charmbracelet/log"
 	"github.com/spf13/cobra"
@@ -95,12 +103,19 @@ var packages = []Package{
 	{FS: args.PackageFS, Name: "args"},
 	{FS: bundle.PackageFS, Name: "bundle"},
 	{FS: config.PackageFS, Name: "config"},
+	{FS: control.PackageFS, Name: "control"},
 	{FS: envvar.PackageFS, Name: "envvar"},
 	{FS: executable.PackageFS, Name: "executable"},
+	{FS: explain.PackageFS, Name: "explain"},
 	{FS: file.PackageFS, Name: "file"},
 	{FS: flags.PackageFS, Name: "flags"},
+	{FS: interpolation.PackageFS, Name: "interpolation"},
+	{FS: output.PackageFS, Name: "output"},
 	{FS: params.PackageFS, Name: "params"},
+	{FS: shell.PackageFS, Name: "shell"},
+	{FS: steps.PackageFS, Name: "steps"},
 	{FS: types.PackageFS, Name: "types"},
+	{FS: update.PackageFS, Name: "update"},
 }
 
 func runBuild() error {
@@ -181,6 +196,10 @@ func runBuild() error {
 		}
 	}
 
+	if err := config.ValidateTemplates(cmdConfig); err != nil {
+		return err
+	}
+
 	outFile := filepath.Join(bundleStagingDirPath, "config.cmd.yaml")
 	err = os.WriteFile(outFile, configFileContent, 0644) // TODO do we need to preserve original permissions?
 	if err != nil {
@@ -200,6 +219,7 @@ func runBuild() error {
 		config:   cmdConfig,
 		baseDir:  bundleStagingDirPath,
 		envStore: envvar.CreateEnvStore(),
+		includes: map[string][]string{},
 	}
 
 	// TODO: Useful?
@@ -214,14 +234,36 @@ func runBuild() error {
 
 	// First we build the root command by creating a command definition from the root configuration.
 	rootCommandDef := &types.CommandDefinition{
-		Name:        cmdConfig.Name,
-		Description: cmdConfig.Description,
-		Commands:    cmdConfig.Commands,
-		Flags:       cmdConfig.Flags,
-		Requires:    cmdConfig.Requires,
-		Includes:    cmdConfig.Includes,
-		Build:       cmdConfig.Build,
-		Start:       cmdConfig.Start,
+		Name:            cmdConfig.Name,
+		Description:     cmdConfig.Description,
+		Commands:        cmdConfig.Commands,
+		Flags:           cmdConfig.Flags,
+		Requires:        cmdConfig.Requires,
+		Includes:        cmdConfig.Includes,
+		Build:           cmdConfig.Build,
+		Start:           cmdConfig.Start,
+		Shell:           cmdConfig.Shell,
+		Run:             cmdConfig.Run,
+		Argv:            cmdConfig.Argv,
+		Call:            cmdConfig.Call,
+		Steps:           cmdConfig.Steps,
+		Jobs:            cmdConfig.Jobs,
+		ContinueOnError: cmdConfig.ContinueOnError,
+		StepOutput:      cmdConfig.StepOutput,
+		Env:             cmdConfig.Env,
+		EnvFiles:        cmdConfig.EnvFiles,
+		RequiredEnv:     cmdConfig.RequiredEnv,
+		InheritEnv:      cmdConfig.InheritEnv,
+		AllowEnv:        cmdConfig.AllowEnv,
+		KillTimeout:     cmdConfig.KillTimeout,
+		Timeout:         cmdConfig.Timeout,
+		Retry:           cmdConfig.Retry,
+		Interactive:     cmdConfig.Interactive,
+		Exec:            cmdConfig.Exec,
+		PassArgs:        cmdConfig.PassArgs,
+		Output:          cmdConfig.Output,
+		Columns:         cmdConfig.Columns,
+		Hooks:           cmdConfig.Hooks,
 	}
 	err = cmdVisitor.Build(rootCommandDef, nil, []string{})
 	if err != nil {
@@ -235,26 +277,22 @@ func runBuild() error {
 		}
 	}
 
-	// We need to do some code generation to create a main.go file from an existing static template in order to
-	// leverage Go's embed features to embded the bundle into the binary.
-	templateMainFileContent, err := bundle.GetMainTemplateContent()
-	if err != nil {
+	// Files in the bundle can be executables, which have to be installed with the same mode, and each command
+	// only extracts its own files
+	if err := bundle.WriteFilesManifest(bundleStagingDirPath, cmdVisitor.includes); err != nil {
 		return err
 	}
 
-	bundle.MainTemplateReplacements["github.com/migsc/cmdeagle/"] = []byte(fmt.Sprintf("%s/", cmdConfig.Name))
-
-	resultingMainFileContent := bundle.InterpolateMainContent(templateMainFileContent)
-
-	resultingMainFilePath := filepath.Join(bundleStagingDirPath, "main.go")
-	// resultingMainFilePath := filepath.Join(executable.GetPackageSrcDirPath(), "main.go")
-
-	// Write the resulting main.go file to the bundle staging directory
-	err = os.WriteFile(resultingMainFilePath, resultingMainFileContent, 0644) // TODO do we need to preserve original permissions?
-	if err != nil {
-		return fmt.Errorf("error writing %s: %w", resultingMainFilePath, err)
+	if cmdConfig.Compression == executable.CompressionGzip {
+		size, compressedSize, err := bundle.CompressIncludedFiles(bundleStagingDirPath)
+		if err != nil {
+			return err
+		}
+		log.Info("Compressed included files",
+			"size", bundle.FormatSize(size),
+			"compressed", bundle.FormatSize(compressedSize),
+		)
 	}
-	log.Debug("Wrote resulting main.go file to", "path", resultingMainFilePath)
 
 	// And now we need to also copy over every package that the executable depends on.
 	for _, pkg := range packages {
@@ -301,6 +339,38 @@ func runBuild() error {
 		})
 	}
 
+	// We need to do some code generation to create a main.go file from an existing static template in order to
+	// leverage Go's embed features to embded the bundle into the binary.
+	templateMainFileContent, err := bundle.GetMainTemplateContent()
+	if err != nil {
+		return err
+	}
+
+	bundle.MainTemplateReplacements["github.com/migsc/cmdeagle/"] = []byte(fmt.Sprintf("%s/", cmdConfig.Name))
+
+	// The hash tells the CLI when its bundle differs from the one extracted before, even for the same version.
+	// main.go isn't written yet, so it isn't part of the hash
+	bundleHash, err := executable.HashBundle(os.DirFS(bundleStagingDirPath))
+	if err != nil {
+		return err
+	}
+	bundle.MainTemplateReplacements[`var BUNDLE_HASH = ""`] = []byte(fmt.Sprintf("var BUNDLE_HASH = %q", bundleHash))
+	bundle.MainTemplateReplacements[`var BUILD_TIME = ""`] = []byte(fmt.Sprintf("var BUILD_TIME = %q", time.Now().UTC().Format(time.RFC3339)))
+	bundle.MainTemplateReplacements[`var CMDEAGLE_VERSION = ""`] = []byte(fmt.Sprintf("var CMDEAGLE_VERSION = %q", rootCmd.Version))
+	log.Debug("Hashed bundle", "hash", bundleHash)
+
+	resultingMainFileContent := bundle.InterpolateMainContent(templateMainFileContent)
+
+	resultingMainFilePath := filepath.Join(bundleStagingDirPath, "main.go")
+	// resultingMainFilePath := filepath.Join(executable.GetPackageSrcDirPath(), "main.go")
+
+	// Write the resulting main.go file to the bundle staging directory
+	err = os.WriteFile(resultingMainFilePath, resultingMainFileContent, 0644) // TODO do we need to preserve original permissions?
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", resultingMainFilePath, err)
+	}
+	log.Debug("Wrote resulting main.go file to", "path", resultingMainFilePath)
+
 	// Finally we build the binary
 	log.Debug("Preparing to build binary with", "binDirPath", binDirPath, "targetBinaryPath")
 
@@ -331,12 +401,6 @@ func runBuild() error {
 
 	log.Info("CLI built successfully", "location", targetBinaryPath)
 
-	// Delete the existing bundle data directory
-	err = os.RemoveAll(executable.GetAppDataDir(cmdConfig.Name))
-	if err != nil {
-		return fmt.Errorf("failed to delete existing bundle data directory: %w", err)
-	}
-
 	return nil
 }
 
@@ -346,6 +410,8 @@ type BuildCommandVisitor struct {
 	config   *types.CmdeagleConfig
 	baseDir  string
 	envStore *envvar.EnvStateStore
+	// Where each command's includes were staged, by command path
+	includes map[string][]string
 }
 
 func (v *BuildCommandVisitor) Visit(commandDef *types.CommandDefinition, parent *types.CommandDefinition, path []string) error {
@@ -367,14 +433,19 @@ func (v *BuildCommandVisitor) Build(commandDef *types.CommandDefinition, parent
 			"script", commandDef.Build,
 		)
 
-		// Interpolate params such as environment variables
-		script := commandDef.Build
-		script = v.envStore.Interpolate(script)
-
 		// TODO: Highly inefficient, but it works for now
 
-		// TODO: Should probably allow the user to specify the shell to run the build script in.
-		cmd := exec.Command("sh", "-c", script)
+		interpreter, err := shell.Resolve(commandDef.Shell)
+		if err != nil {
+			return err
+		}
+
+		// Interpolate params such as environment variables
+		script, err := v.envStore.InterpolateScript(commandDef.Build, interpreter.Quoting)
+		if err != nil {
+			return fmt.Errorf("failed to interpolate build script of command %s: %w", commandDef.Name, err)
+		}
+		cmd := interpreter.Command(script)
 
 		// Copy the current environment and add new variables iteratively
 		envVars := v.envStore.GetEnvVariables()
@@ -392,9 +463,13 @@ func (v *BuildCommandVisitor) Build(commandDef *types.CommandDefinition, parent
 		}
 	}
 
-	if err := bundle.CopyIncludedFiles(v.config, commandDef, path, bundleStagingDirPath); err != nil {
+	stagedPaths, err := bundle.CopyIncludedFiles(v.config, commandDef, path, bundleStagingDirPath)
+	if err != nil {
 		return err
 	}
+	if len(stagedPaths) > 0 {
+		v.includes[strings.Join(path, ":")] = stagedPaths
+	}
 
 	return nil
 }
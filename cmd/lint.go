@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/migsc/cmdeagle/config"
+
+	"github.com/charmbracelet/log"
+	"github.com/spf13/cobra"
+)
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Check your cmd.yaml configuration for mistakes and unsafe scripts.",
+	Long: `Finds the configuration file in the current directory and checks it
+without building the CLI. Invalid references fail the lint. Values
+inserted with raw outside of quotes or into heredocs, and values inside
+command substitutions within strings, are reported as warnings.`,
+	// Failures are reported through the log like the warnings, rather than along with the usage
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, arguments []string) error {
+		strict, _ := cmd.Flags().GetBool("strict")
+
+		if err := runLint(strict); err != nil {
+			log.Error("Lint failed", "error", err)
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+
+	lintCmd.Flags().Bool("strict", false, "Fail when there are warnings")
+}
+
+func runLint(strict bool) error {
+	workingDirPath, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	_, cmdConfig, err := config.Load(workingDirPath)
+	if err != nil {
+		return err
+	}
+
+	if err := config.ValidateTemplates(cmdConfig); err != nil {
+		return err
+	}
+
+	warnings, err := config.LintTemplates(cmdConfig)
+	if err != nil {
+		return err
+	}
+
+	for _, warning := range warnings {
+		log.Warn(warning.Message,
+			"command", warning.Command,
+			"script", warning.Script,
+			"line", warning.Action.Line,
+			"action", warning.Action.Text,
+		)
+	}
+
+	if strict && len(warnings) > 0 {
+		return fmt.Errorf("%d warning(s)", len(warnings))
+	}
+
+	log.Info("Lint finished", "warnings", len(warnings))
+	return nil
+}
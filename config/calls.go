@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+// CallVisitor collects the commands of the config by their path, so that the commands each `call` names
+// can be looked up.
+type CallVisitor struct {
+	commands map[string]*types.CommandDefinition
+}
+
+func (visitor *CallVisitor) Visit(cmd *types.CommandDefinition, parent *types.CommandDefinition, path []string) error {
+	visitor.commands[strings.Join(path, " ")] = cmd
+	return nil
+}
+
+// CallPath normalizes the command of a `call` entry into its path from the root, e.g. `db migrate`.
+func CallPath(def types.CallDefinition) string {
+	return strings.Join(strings.Fields(def.Command), " ")
+}
+
+// validateCallSettings checks the settings of a command that calls others. The called commands run with
+// their own settings, so the ones that control how a script runs don't apply to the caller.
+func validateCallSettings(calls []types.CallDefinition, timeout string, retry *types.RetryDefinition, interactive bool, exec bool) error {
+	if len(calls) > 0 && (timeout != "" || retry != nil || interactive || exec) {
+		return fmt.Errorf("call cannot be combined with timeout, retry, interactive or exec")
+	}
+
+	return nil
+}
+
+// ValidateCalls checks that every `call` names a command of the config, and that no command ends up
+// calling itself.
+func ValidateCalls(config *types.CmdeagleConfig) error {
+	visitor := &CallVisitor{commands: map[string]*types.CommandDefinition{}}
+	if err := WalkCommands(&config.Commands, nil, visitor, []string{}); err != nil {
+		return err
+	}
+
+	// The root command can't be called, since it has no path, but it can call others
+	root := getRootCommandDef(config)
+	visitor.commands[""] = root
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	chain := []string{}
+
+	var visit func(path string) error
+	visit = func(path string) error {
+		switch state[path] {
+		case visiting:
+			return fmt.Errorf("commands call each other in a cycle: %s -> %s", strings.Join(chain, " -> "), path)
+		case visited:
+			return nil
+		}
+
+		state[path] = visiting
+		name := path
+		if name == "" {
+			name = root.Name
+		}
+		chain = append(chain, name)
+
+		for _, call := range visitor.commands[path].Call {
+			callee := CallPath(call)
+			if callee == "" {
+				return fmt.Errorf("invalid command %s: every call needs a command", name)
+			}
+			if _, ok := visitor.commands[callee]; !ok {
+				return fmt.Errorf("invalid command %s: call of unknown command %q", name, call.Command)
+			}
+			if err := visit(callee); err != nil {
+				return err
+			}
+		}
+
+		chain = chain[:len(chain)-1]
+		state[path] = visited
+		return nil
+	}
+
+	paths := make([]string, 0, len(visitor.commands))
+	for path := range visitor.commands {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := visit(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
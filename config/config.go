@@ -4,6 +4,7 @@ import (
 	"embed"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 
 	"github.com/migsc/cmdeagle/file"
@@ -31,7 +32,7 @@ import (
 //go:embed *
 var PackageFS embed.FS
 
-func LoadFromBundle(bundleFS embed.FS) ([]byte, *types.CmdeagleConfig, error) {
+func LoadFromBundle(bundleFS fs.FS) ([]byte, *types.CmdeagleConfig, error) {
 	log.Debug("Loading config file from embedded bundle")
 
 	configFile, err := bundleFS.Open("config.cmd.yaml")
@@ -96,5 +97,9 @@ func Parse(content []byte) (*types.CmdeagleConfig, error) {
 		log.Debug("Found top-level command definition in config file:", "name", cmd.Name)
 	}
 
+	if err := ResolveInheritance(&config); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
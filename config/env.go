@@ -0,0 +1,150 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/migsc/cmdeagle/envvar"
+	"github.com/migsc/cmdeagle/types"
+)
+
+// LoadEnvFiles reads the `env-files` of a command, in order. Relative paths are looked up in each of the
+// given directories in turn, which are the directory the CLI was invoked from and its data directory.
+func LoadEnvFiles(envFiles []types.EnvFileDefinition, dirs ...string) ([]types.EnvVar, error) {
+	vars := []types.EnvVar{}
+
+	for _, envFile := range envFiles {
+		candidates := []string{envFile.Path}
+		if !filepath.IsAbs(envFile.Path) {
+			candidates = nil
+			for _, dir := range dirs {
+				candidates = append(candidates, filepath.Join(dir, envFile.Path))
+			}
+		}
+
+		found := false
+		for _, candidate := range candidates {
+			file, err := os.Open(candidate)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to open env file: %w", err)
+			}
+
+			fileVars, err := envvar.ParseDotenv(file)
+			file.Close()
+			if err != nil {
+				return nil, fmt.Errorf("invalid env file %s: %w", candidate, err)
+			}
+
+			vars = append(vars, fileVars...)
+			found = true
+			break
+		}
+
+		if !found && !envFile.Optional {
+			return nil, fmt.Errorf("env file %s not found in %s", envFile.Path, strings.Join(dirs, " or "))
+		}
+	}
+
+	return vars, nil
+}
+
+// RenderEnv renders the values of an `env` setting with the params of the command.
+func RenderEnv(env map[string]string, store *ParamsStateStore) ([]types.EnvVar, error) {
+	vars := make([]types.EnvVar, 0, len(env))
+
+	for name, value := range env {
+		rendered, err := store.Interpolate(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to interpolate env %s: %w", name, err)
+		}
+		vars = append(vars, types.EnvVar{Name: name, Value: rendered})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+
+	return vars, nil
+}
+
+// Environment is what the scripts of a command get on top of the variables generated from its args, flags
+// and the CLI.
+type Environment struct {
+	// Only pass PATH and the variables in Allow from the CLI's environment, for `inherit-env: false`
+	Clean bool
+	Allow []string
+	// Variables from `env-files`, which don't override the ones scripts already get from the CLI
+	Files []types.EnvVar
+	// Variables from `env`, which override everything but the generated variables
+	Declared []types.EnvVar
+}
+
+// passes reports whether scripts get a variable from the CLI's environment.
+func (env Environment) passes(name string) bool {
+	if !env.Clean || name == "PATH" {
+		return true
+	}
+
+	for _, allowed := range env.Allow {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Vars returns the variables the command sets for its scripts, without the ones passed from the CLI's
+// environment.
+func (env Environment) Vars() []types.EnvVar {
+	vars := []types.EnvVar{}
+
+	for _, envVar := range env.Files {
+		if _, set := os.LookupEnv(envVar.Name); set && env.passes(envVar.Name) {
+			continue
+		}
+		vars = append(vars, envVar)
+	}
+
+	return append(vars, env.Declared...)
+}
+
+// Environ returns the environment of a script in the format of os.Environ, followed by the generated
+// variables. When a variable appears more than once, the last one wins.
+func (env Environment) Environ(generated []types.EnvVar) []string {
+	environ := []string{}
+
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if env.passes(name) {
+			environ = append(environ, entry)
+		}
+	}
+
+	for _, envVar := range append(env.Vars(), generated...) {
+		environ = append(environ, envVar.Name+"="+envVar.Value)
+	}
+
+	return environ
+}
+
+// Missing returns the required variables that scripts would get empty or not at all.
+func (env Environment) Missing(required []string) []string {
+	values := map[string]string{}
+	for _, entry := range env.Environ(nil) {
+		name, value, _ := strings.Cut(entry, "=")
+		values[name] = value
+	}
+
+	missing := []string{}
+	for _, name := range required {
+		if values[name] == "" {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,422 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/migsc/cmdeagle/envvar"
+	"github.com/migsc/cmdeagle/executable"
+	"github.com/migsc/cmdeagle/shell"
+	"github.com/migsc/cmdeagle/steps"
+	"github.com/migsc/cmdeagle/types"
+
+	"github.com/charmbracelet/log"
+)
+
+// InheritanceVisitor fills in the settings that commands inherit from their parent command, so that the
+// rest of the build and runtime can treat every command definition as complete.
+type InheritanceVisitor struct {
+	config *types.CmdeagleConfig
+}
+
+func ResolveInheritance(config *types.CmdeagleConfig) error {
+	if err := validateStartForm(config.Start, config.Run, config.Argv, config.Call, config.Steps); err != nil {
+		return fmt.Errorf("invalid root command: %w", err)
+	}
+
+	if err := validateCallSettings(config.Call, config.Timeout, config.Retry, config.Interactive, config.Exec); err != nil {
+		return fmt.Errorf("invalid root command: %w", err)
+	}
+
+	if err := validatePassArgs(config.PassArgs, config.Start, config.Shell, config.Call, config.Steps); err != nil {
+		return fmt.Errorf("invalid root command: %w", err)
+	}
+
+	if err := validateOutput(config.Output, config.Columns, config.Call, config.Steps, config.Interactive, config.Exec); err != nil {
+		return fmt.Errorf("invalid root command: %w", err)
+	}
+
+	if err := validateSteps(config.Steps, config.Jobs, config.StepOutput, config.Interactive, config.Exec, config.Retry); err != nil {
+		return fmt.Errorf("invalid root command: %w", err)
+	}
+
+	requires, err := inferRequires(config.Requires, config.Shell, config.Run, config.Argv)
+	if err != nil {
+		return fmt.Errorf("invalid root command: %w", err)
+	}
+	config.Requires = requires
+
+	if _, err := ParseKillTimeout(config.KillTimeout); err != nil {
+		return fmt.Errorf("invalid root command: %w", err)
+	}
+
+	if err := validateEnv(config.Env, config.EnvFiles, config.RequiredEnv, config.AllowEnv); err != nil {
+		return fmt.Errorf("invalid root command: %w", err)
+	}
+
+	if err := validateStartPolicy(config.Timeout, config.Retry, config.Exec); err != nil {
+		return fmt.Errorf("invalid root command: %w", err)
+	}
+
+	if err := executable.ValidateExtraction(config.Extraction); err != nil {
+		return err
+	}
+
+	if err := executable.ValidateCompression(config.Compression); err != nil {
+		return err
+	}
+
+	if err := WalkCommands(&config.Commands, nil, &InheritanceVisitor{config: config}, []string{}); err != nil {
+		return err
+	}
+
+	return ValidateCalls(config)
+}
+
+func (visitor *InheritanceVisitor) Visit(cmd *types.CommandDefinition, parent *types.CommandDefinition, path []string) error {
+	if cmd.Shell == nil {
+		if parent == nil {
+			cmd.Shell = visitor.config.Shell
+		} else {
+			cmd.Shell = parent.Shell
+		}
+	}
+
+	if cmd.KillTimeout == "" {
+		if parent == nil {
+			cmd.KillTimeout = visitor.config.KillTimeout
+		} else {
+			cmd.KillTimeout = parent.KillTimeout
+		}
+	}
+
+	if _, err := ParseKillTimeout(cmd.KillTimeout); err != nil {
+		return fmt.Errorf("invalid command %s: %w", cmd.Name, err)
+	}
+
+	if err := validateEnv(cmd.Env, cmd.EnvFiles, cmd.RequiredEnv, cmd.AllowEnv); err != nil {
+		return fmt.Errorf("invalid command %s: %w", cmd.Name, err)
+	}
+
+	// Environment settings add up through the tree, with the command's own taking precedence
+	inheritFrom := &types.CommandDefinition{
+		Env:         visitor.config.Env,
+		EnvFiles:    visitor.config.EnvFiles,
+		RequiredEnv: visitor.config.RequiredEnv,
+		InheritEnv:  visitor.config.InheritEnv,
+		AllowEnv:    visitor.config.AllowEnv,
+	}
+	if parent != nil {
+		inheritFrom = parent
+	}
+
+	env := map[string]string{}
+	for name, value := range inheritFrom.Env {
+		env[name] = value
+	}
+	for name, value := range cmd.Env {
+		env[name] = value
+	}
+	if len(env) > 0 {
+		cmd.Env = env
+	}
+
+	cmd.EnvFiles = append(append([]types.EnvFileDefinition{}, inheritFrom.EnvFiles...), cmd.EnvFiles...)
+	cmd.RequiredEnv = mergeNames(inheritFrom.RequiredEnv, cmd.RequiredEnv)
+	cmd.AllowEnv = mergeNames(inheritFrom.AllowEnv, cmd.AllowEnv)
+	if cmd.InheritEnv == nil {
+		cmd.InheritEnv = inheritFrom.InheritEnv
+	}
+
+	if err := validateStartPolicy(cmd.Timeout, cmd.Retry, cmd.Exec); err != nil {
+		return fmt.Errorf("invalid command %s: %w", cmd.Name, err)
+	}
+
+	if err := validateStartForm(cmd.Start, cmd.Run, cmd.Argv, cmd.Call, cmd.Steps); err != nil {
+		return fmt.Errorf("invalid command %s: %w", cmd.Name, err)
+	}
+
+	if err := validateCallSettings(cmd.Call, cmd.Timeout, cmd.Retry, cmd.Interactive, cmd.Exec); err != nil {
+		return fmt.Errorf("invalid command %s: %w", cmd.Name, err)
+	}
+
+	if err := validatePassArgs(cmd.PassArgs, cmd.Start, cmd.Shell, cmd.Call, cmd.Steps); err != nil {
+		return fmt.Errorf("invalid command %s: %w", cmd.Name, err)
+	}
+
+	if err := validateOutput(cmd.Output, cmd.Columns, cmd.Call, cmd.Steps, cmd.Interactive, cmd.Exec); err != nil {
+		return fmt.Errorf("invalid command %s: %w", cmd.Name, err)
+	}
+
+	if err := validateSteps(cmd.Steps, cmd.Jobs, cmd.StepOutput, cmd.Interactive, cmd.Exec, cmd.Retry); err != nil {
+		return fmt.Errorf("invalid command %s: %w", cmd.Name, err)
+	}
+
+	requires, err := inferRequires(cmd.Requires, cmd.Shell, cmd.Run, cmd.Argv)
+	if err != nil {
+		return fmt.Errorf("invalid command %s: %w", cmd.Name, err)
+	}
+	cmd.Requires = requires
+
+	return nil
+}
+
+// mergeNames returns the names of both lists, without duplicates.
+func mergeNames(inherited []string, own []string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, name := range append(append([]string{}, inherited...), own...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// validateEnv checks the names of the variables in the environment settings of a command.
+func validateEnv(env map[string]string, envFiles []types.EnvFileDefinition, requiredEnv []string, allowEnv []string) error {
+	for name := range env {
+		if !envvar.IsValidName(name) {
+			return fmt.Errorf("env has an invalid variable name %q", name)
+		}
+	}
+
+	for _, envFile := range envFiles {
+		if strings.TrimSpace(envFile.Path) == "" {
+			return fmt.Errorf("every env file needs a path")
+		}
+	}
+
+	for _, name := range append(append([]string{}, requiredEnv...), allowEnv...) {
+		if !envvar.IsValidName(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+
+	return nil
+}
+
+// ParseKillTimeout parses a `kill-timeout` setting, falling back to executable.DefaultKillTimeout when it's
+// not set.
+func ParseKillTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return executable.DefaultKillTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("kill-timeout must be a non-negative duration such as 10s, got %q", value)
+	}
+
+	return timeout, nil
+}
+
+// ParseTimeout parses a `timeout` setting. Zero means the script may run for as long as it takes.
+func ParseTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("timeout must be a non-negative duration such as 5m, got %q", value)
+	}
+
+	return timeout, nil
+}
+
+// Defaults for the attempts and delays of a `retry` setting
+var (
+	DefaultRetryAttempts = 3
+	DefaultRetryBackoff  = time.Second
+	DefaultRetryMaxDelay = 30 * time.Second
+)
+
+// ParseRetry turns a `retry` setting into a policy. Without one, the script runs once.
+func ParseRetry(def *types.RetryDefinition) (executable.RetryPolicy, error) {
+	policy := executable.RetryPolicy{Attempts: 1, Backoff: DefaultRetryBackoff, MaxDelay: DefaultRetryMaxDelay}
+	if def == nil {
+		return policy, nil
+	}
+
+	// A `retry` setting without attempts, like `retry: {}`, retries with the default ones
+	policy.Attempts = DefaultRetryAttempts
+	if def.Attempts < 0 {
+		return policy, fmt.Errorf("retry attempts must be at least 1, got %d", def.Attempts)
+	}
+	if def.Attempts > 0 {
+		policy.Attempts = def.Attempts
+	}
+	policy.OnExitCodes = def.OnExitCodes
+
+	if def.Backoff != "" {
+		backoff, err := time.ParseDuration(def.Backoff)
+		if err != nil || backoff < 0 {
+			return policy, fmt.Errorf("retry backoff must be a non-negative duration such as 2s, got %q", def.Backoff)
+		}
+		policy.Backoff = backoff
+	}
+
+	if def.MaxDelay != "" {
+		maxDelay, err := time.ParseDuration(def.MaxDelay)
+		if err != nil || maxDelay < 0 {
+			return policy, fmt.Errorf("retry max-delay must be a non-negative duration such as 1m, got %q", def.MaxDelay)
+		}
+		policy.MaxDelay = maxDelay
+	}
+
+	return policy, nil
+}
+
+// validateStartPolicy checks the `timeout` and `retry` settings. Neither can apply to a script that
+// replaces the CLI's process.
+func validateStartPolicy(timeout string, retry *types.RetryDefinition, exec bool) error {
+	if _, err := ParseTimeout(timeout); err != nil {
+		return err
+	}
+
+	if _, err := ParseRetry(retry); err != nil {
+		return err
+	}
+
+	if exec && (timeout != "" || retry != nil) {
+		return fmt.Errorf("timeout and retry cannot be combined with exec")
+	}
+
+	return nil
+}
+
+// validateStartForm checks that a command starts in only one way, since `run`, `argv`, `call` and `steps`
+// each replace `start`.
+func validateStartForm(start string, runDef *types.RunDefinition, argv []string, calls []types.CallDefinition, stepDefs []types.StepDefinition) error {
+	forms := []string{}
+	if start != "" {
+		forms = append(forms, "start")
+	}
+	if runDef != nil {
+		forms = append(forms, "run")
+	}
+	if len(argv) > 0 {
+		forms = append(forms, "argv")
+	}
+	if len(calls) > 0 {
+		forms = append(forms, "call")
+	}
+	if len(stepDefs) > 0 {
+		forms = append(forms, "steps")
+	}
+
+	if len(forms) > 1 {
+		return fmt.Errorf("only one of start, run, argv, call and steps can be set, got %s", strings.Join(forms, " and "))
+	}
+
+	if len(argv) > 0 && strings.TrimSpace(argv[0]) == "" {
+		return fmt.Errorf("argv must start with the executable to run")
+	}
+
+	return nil
+}
+
+// validatePassArgs checks that the arguments of a command with `pass-args` have a start script to go to,
+// and that its interpreter can receive them.
+func validatePassArgs(passArgs bool, start string, shellDef *types.ShellDefinition, calls []types.CallDefinition, stepDefs []types.StepDefinition) error {
+	if !passArgs {
+		return nil
+	}
+
+	if len(calls) > 0 || len(stepDefs) > 0 {
+		return fmt.Errorf("pass-args cannot be combined with call or steps")
+	}
+
+	if start != "" {
+		interpreter, err := shell.Resolve(shellDef)
+		if err != nil {
+			return err
+		}
+		if interpreter.NoInlineArgs {
+			return fmt.Errorf("pass-args is not supported for inline %s scripts, use run instead", interpreter.Name)
+		}
+	}
+
+	return nil
+}
+
+// validateSteps checks the `steps` of a command and the settings that go with them. Steps run side by
+// side, so none of them can take over the terminal or the CLI's process.
+func validateSteps(stepDefs []types.StepDefinition, jobs int, stepOutput string, interactive bool, exec bool, retry *types.RetryDefinition) error {
+	if jobs < 0 {
+		return fmt.Errorf("jobs must not be negative, got %d", jobs)
+	}
+
+	if stepOutput != "" && stepOutput != steps.OutputPrefix && stepOutput != steps.OutputGroup {
+		return fmt.Errorf("step-output must be %s or %s, got %q", steps.OutputPrefix, steps.OutputGroup, stepOutput)
+	}
+
+	if len(stepDefs) == 0 {
+		return nil
+	}
+
+	if interactive || exec || retry != nil {
+		return fmt.Errorf("steps cannot be combined with interactive, exec or retry")
+	}
+
+	if _, err := steps.Plan(stepDefs); err != nil {
+		return err
+	}
+
+	for _, stepDef := range stepDefs {
+		if strings.TrimSpace(stepDef.Run) == "" {
+			return fmt.Errorf("step %s has nothing to run", stepDef.Name)
+		}
+	}
+
+	return nil
+}
+
+// inferRequires adds the executables behind the command's interpreter, runtime and argv to its
+// requirements, unless the command already declares a version constraint for them.
+func inferRequires(requires map[string]string, shellDef *types.ShellDefinition, runDef *types.RunDefinition, argv []string) (map[string]string, error) {
+	executables := []string{}
+
+	if shellDef != nil {
+		interpreter, err := shell.Resolve(shellDef)
+		if err != nil {
+			return nil, err
+		}
+		executables = append(executables, interpreter.Executable())
+	}
+
+	if runDef != nil {
+		interpreter, err := shell.GetInterpreter(runDef.Runtime)
+		if err != nil {
+			return nil, err
+		}
+		executables = append(executables, interpreter.Executable())
+	}
+
+	// Executables given by path or chosen at runtime can't be looked up on the PATH ahead of time
+	if len(argv) > 0 && !strings.Contains(argv[0], "{{") && !strings.ContainsAny(argv[0], `/\`) {
+		executables = append(executables, argv[0])
+	}
+
+	for _, name := range executables {
+		if name == shell.DefaultShell {
+			continue
+		}
+
+		if _, declared := requires[name]; declared {
+			continue
+		}
+
+		if requires == nil {
+			requires = map[string]string{}
+		}
+
+		log.Debug("Inferred requirement from interpreter", "name", name)
+		requires[name] = "*"
+	}
+
+	return requires, nil
+}
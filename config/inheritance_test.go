@@ -0,0 +1,94 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+func TestInferRequires(t *testing.T) {
+	tests := []struct {
+		name     string
+		requires map[string]string
+		shell    *types.ShellDefinition
+		run      *types.RunDefinition
+		argv     []string
+		expected map[string]string
+	}{
+		{name: "nothing to run"},
+		{name: "the default shell", shell: &types.ShellDefinition{Name: "sh"}},
+		{name: "a shell", shell: &types.ShellDefinition{Name: "bash"}, expected: map[string]string{"bash": "*"}},
+		{name: "a custom shell", shell: &types.ShellDefinition{Argv: []string{"zsh", "-eu", "-c"}}, expected: map[string]string{"zsh": "*"}},
+		{name: "a runtime", run: &types.RunDefinition{Runtime: "node", File: "greet.js"}, expected: map[string]string{"node": "*"}},
+		{name: "an executable", argv: []string{"git", "clone"}, expected: map[string]string{"git": "*"}},
+		{name: "an executable by path", argv: []string{"./bin/tool", "run"}},
+		{name: "an executable chosen at runtime", argv: []string{"{{flags.tool}}", "run"}},
+		{
+			name:     "declared requirements",
+			requires: map[string]string{"node": ">=18.0.0"},
+			shell:    &types.ShellDefinition{Name: "bash"},
+			run:      &types.RunDefinition{Runtime: "node", File: "greet.js"},
+			expected: map[string]string{"node": ">=18.0.0", "bash": "*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requires, err := inferRequires(tt.requires, tt.shell, tt.run, tt.argv)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, requires)
+		})
+	}
+
+	_, err := inferRequires(nil, &types.ShellDefinition{Name: "fish"}, nil, nil)
+	assert.ErrorContains(t, err, "unknown shell or runtime `fish`")
+	_, err = inferRequires(nil, nil, &types.RunDefinition{Runtime: "fish", File: "x.fish"}, nil)
+	assert.ErrorContains(t, err, "unknown shell or runtime `fish`")
+}
+
+func TestInheritedShellRequires(t *testing.T) {
+	config, err := Parse([]byte(`
+name: mycli
+shell: bash
+commands:
+- name: greet
+  start: echo hi
+- name: build
+  requires:
+    bash: ^5.0.0
+  start: make
+- name: js
+  run:
+    node: greet.js
+`))
+	require.NoError(t, err)
+
+	// The shell of the root command is inherited along with its requirement
+	assert.Equal(t, map[string]string{"bash": "*"}, config.Requires)
+	assert.Equal(t, map[string]string{"bash": "*"}, config.Commands[0].Requires)
+	assert.Equal(t, map[string]string{"bash": "^5.0.0"}, config.Commands[1].Requires)
+	assert.Equal(t, map[string]string{"bash": "*", "node": "*"}, config.Commands[2].Requires)
+}
+
+func TestParseRetry(t *testing.T) {
+	policy, err := ParseRetry(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, policy.Attempts, "runs once without a retry setting")
+
+	policy, err = ParseRetry(&types.RetryDefinition{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRetryAttempts, policy.Attempts, "retries with the default attempts when none are set")
+	assert.Equal(t, DefaultRetryBackoff, policy.Backoff)
+
+	policy, err = ParseRetry(&types.RetryDefinition{Attempts: 5, Backoff: "2s"})
+	require.NoError(t, err)
+	assert.Equal(t, 5, policy.Attempts)
+	assert.Equal(t, 2*time.Second, policy.Backoff)
+
+	_, err = ParseRetry(&types.RetryDefinition{Attempts: -1})
+	assert.ErrorContains(t, err, "retry attempts must be at least 1")
+}
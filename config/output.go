@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/migsc/cmdeagle/output"
+	"github.com/migsc/cmdeagle/types"
+)
+
+// validateOutput checks the `output` of a command and the `columns` it's rendered with. The output of the
+// start script is captured to be rendered, so it can't have the terminal or replace the CLI's process.
+func validateOutput(format string, columns []types.ColumnDefinition, calls []types.CallDefinition, stepDefs []types.StepDefinition, interactive bool, exec bool) error {
+	if format == "" {
+		if len(columns) > 0 {
+			return fmt.Errorf("columns need output to be set")
+		}
+		return nil
+	}
+
+	if format != output.JSON {
+		return fmt.Errorf("output must be %s, got %q", output.JSON, format)
+	}
+
+	if len(calls) > 0 || len(stepDefs) > 0 || interactive || exec {
+		return fmt.Errorf("output cannot be combined with call, steps, interactive or exec")
+	}
+
+	return output.ValidateColumns(columns)
+}
@@ -2,19 +2,31 @@ package config
 
 import (
 	"encoding/json"
-	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/migsc/cmdeagle/args"
 	"github.com/migsc/cmdeagle/envvar"
 	"github.com/migsc/cmdeagle/flags"
+	"github.com/migsc/cmdeagle/interpolation"
 	"github.com/migsc/cmdeagle/types"
 )
 
+// MaxJSONEnvSize is the size up to which the JSON values, like `params.json`, are also set as environment
+// variables such as PARAMS_JSON. Linux limits each variable to 128 KiB.
+const MaxJSONEnvSize = 32 * 1024
+
 type ParamsStateStore struct {
 	Args    *args.ArgsStateStore
 	Flags   *flags.FlagsStateStore
 	Entries map[string]string
+	// The environment declared by the command, which scripts get along with the generated variables
+	Environment Environment
+	// Arguments for the start script: the ones given after `--`, preceded by the positional arguments
+	// when the command has `pass-args`
+	ScriptArgs []string
+	// Guards Entries, which scripts that run at the same time set outputs in
+	mu sync.RWMutex
 }
 
 func CreateEmptyParamsStore() *ParamsStateStore {
@@ -42,16 +54,42 @@ func CreateParamsStore(argsStore *args.ArgsStateStore, flagsStore *flags.FlagsSt
 }
 
 func (store *ParamsStateStore) Set(key string, value string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
 	store.Entries[key] = value
 }
 
-func (store *ParamsStateStore) Interpolate(script string) string {
+// Get returns the value of a param such as `cli.data_dir`, or "" if it isn't set.
+func (store *ParamsStateStore) Get(key string) string {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.Entries[key]
+}
+
+// GetContext returns every value scripts can reference: args, flags and the other params such as
+// `{{cli.name}}`, so that a script is rendered in a single pass.
+func (store *ParamsStateStore) GetContext() interpolation.Context {
+	ctx := interpolation.NewContext()
+	ctx.Merge(store.Args.GetContext())
+	ctx.Merge(store.Flags.GetContext())
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
 	for key, val := range store.Entries {
-		placeholder := fmt.Sprintf("{{%s}}", key)
-		script = strings.ReplaceAll(script, placeholder, fmt.Sprint(val))
+		ctx.Set(key, val)
 	}
 
-	return script
+	return ctx
+}
+
+func (store *ParamsStateStore) Interpolate(script string) (string, error) {
+	return interpolation.Render(script, store.GetContext())
+}
+
+// InterpolateScript renders a script that runs with an interpreter, escaping the values it inserts with
+// the interpreter's quoting.
+func (store *ParamsStateStore) InterpolateScript(script string, quoting interpolation.Quoting) (string, error) {
+	return interpolation.RenderScript(script, store.GetContext(), quoting)
 }
 
 func (store *ParamsStateStore) GetEnvVariables() []types.EnvVar {
@@ -60,13 +98,25 @@ func (store *ParamsStateStore) GetEnvVariables() []types.EnvVar {
 	envVars = append(envVars, store.Args.GetEnvVariables()...)
 	envVars = append(envVars, store.Flags.GetEnvVariables()...)
 
+	store.mu.RLock()
+	defer store.mu.RUnlock()
 	for key, val := range store.Entries {
+		// Large JSON values would exceed the size limits of the environment, scripts read those from
+		// `CLI_PARAMS_FILE` instead
+		if strings.HasSuffix(key, ".json") && len(val) > MaxJSONEnvSize {
+			continue
+		}
 		envVars = append(envVars, types.EnvVar{Name: envvar.GetEnvVariableNameFromStateKey(key), Value: val})
 	}
 
 	return envVars
 }
 
+// Environ returns the full environment of a script, in the format of os.Environ.
+func (store *ParamsStateStore) Environ() []string {
+	return store.Environment.Environ(store.GetEnvVariables())
+}
+
 func (store *ParamsStateStore) ToJSON() map[string]any {
 	return map[string]any{
 		"args":  store.Args.ToJSON(),
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/migsc/cmdeagle/args"
+	"github.com/migsc/cmdeagle/flags"
+)
+
+func TestGetEnvVariablesIncludesJSON(t *testing.T) {
+	store := CreateParamsStore(args.CreateArgsStore(nil, nil, nil), flags.CreateFlagsStore(nil, nil))
+	store.Set("outputs.small.json", `{"a": 1}`)
+	store.Set("outputs.large.json", `"`+strings.Repeat("x", MaxJSONEnvSize)+`"`)
+
+	env := map[string]string{}
+	for _, envVar := range store.GetEnvVariables() {
+		env[envVar.Name] = envVar.Value
+	}
+
+	assert.Equal(t, store.Entries["args.json"], env["ARGS_JSON"])
+	assert.Equal(t, store.Entries["flags.json"], env["FLAGS_JSON"])
+	assert.Equal(t, store.Entries["params.json"], env["PARAMS_JSON"])
+	assert.Equal(t, `{"a": 1}`, env["OUTPUTS_SMALL_JSON"])
+	assert.NotContains(t, env, "OUTPUTS_LARGE_JSON", "values too large for the environment are left to the params file")
+}
@@ -0,0 +1,281 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/migsc/cmdeagle/interpolation"
+	"github.com/migsc/cmdeagle/shell"
+	"github.com/migsc/cmdeagle/steps"
+	"github.com/migsc/cmdeagle/types"
+)
+
+// Keys of the `cli` and `params` namespaces. `exit_code` and `error` are only set for `on-error` and
+// `finally` hooks, but are accepted everywhere so hooks and scripts can share snippets.
+var knownCLIKeys = []string{"bin_dir", "data_dir", "name", "self", "params_file", "secrets_file", "attempt", "exit_code", "error"}
+var knownParamsKeys = []string{"json"}
+
+// TemplateVisitor checks that the scripts of every command only reference args and flags the command
+// declares, so that a typo fails the build instead of surfacing when a user runs the command.
+type TemplateVisitor struct{}
+
+// ValidateTemplates parses every script in the config and checks its references.
+func ValidateTemplates(config *types.CmdeagleConfig) error {
+	if err := validateCommandTemplates(getRootCommandDef(config)); err != nil {
+		return err
+	}
+
+	return WalkCommands(&config.Commands, nil, &TemplateVisitor{}, []string{})
+}
+
+func (visitor *TemplateVisitor) Visit(cmd *types.CommandDefinition, parent *types.CommandDefinition, path []string) error {
+	return validateCommandTemplates(cmd)
+}
+
+// TemplateWarning points at an action of a script that is valid but likely unsafe.
+type TemplateWarning struct {
+	Command string
+	Script  string
+	Action  interpolation.Action
+	Message string
+}
+
+// LintVisitor collects warnings about the scripts of every command.
+type LintVisitor struct {
+	Warnings []TemplateWarning
+}
+
+// LintTemplates returns warnings for `raw` values inserted into scripts outside of any quotes or into
+// heredocs, where a value containing spaces or shell syntax changes what the script does, and for values
+// inside command substitutions that are themselves inside strings, which are easily mistaken for part of
+// the string.
+func LintTemplates(config *types.CmdeagleConfig) ([]TemplateWarning, error) {
+	visitor := &LintVisitor{}
+
+	if err := visitor.Visit(getRootCommandDef(config), nil, []string{}); err != nil {
+		return nil, err
+	}
+
+	if err := WalkCommands(&config.Commands, nil, visitor, []string{}); err != nil {
+		return nil, err
+	}
+
+	return visitor.Warnings, nil
+}
+
+func (visitor *LintVisitor) Visit(cmd *types.CommandDefinition, parent *types.CommandDefinition, path []string) error {
+	interpreter, err := shell.Resolve(cmd.Shell)
+	if err != nil {
+		return fmt.Errorf("invalid command %s: %w", cmd.Name, err)
+	}
+
+	for _, script := range getTemplatedScripts(cmd) {
+		if script.script == "" || !script.interpreted {
+			continue
+		}
+
+		actions, err := interpolation.OutputActions(script.script, interpreter.Quoting)
+		if err != nil {
+			return fmt.Errorf("invalid %s of command %s: %w", script.name, cmd.Name, err)
+		}
+
+		for _, action := range actions {
+			if message := lintAction(action); message != "" {
+				visitor.Warnings = append(visitor.Warnings, TemplateWarning{
+					Command: cmd.Name,
+					Script:  script.name,
+					Action:  action,
+					Message: message,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// lintAction returns why an action is likely unsafe, if it is.
+func lintAction(action interpolation.Action) string {
+	switch {
+	case action.Raw && action.Context == interpolation.ContextUnquoted:
+		return "raw value is inserted without quotes, so it is split into words and may run as code"
+	case action.Raw && action.Context == interpolation.ContextHeredoc:
+		return "raw value is inserted into a heredoc, so any $ or backticks in it run as code"
+	case action.Substitution:
+		return "value is inserted into a command substitution inside a string, so it's quoted as a word of the nested command rather than as part of the string"
+	}
+	return ""
+}
+
+// The root command isn't visited by WalkCommands, so its settings are checked as a command of their own
+func getRootCommandDef(config *types.CmdeagleConfig) *types.CommandDefinition {
+	return &types.CommandDefinition{
+		Name:     config.Name,
+		Args:     config.Args,
+		Flags:    config.Flags,
+		Build:    config.Build,
+		Validate: config.Validate,
+		Start:    config.Start,
+		Shell:    config.Shell,
+		Run:      config.Run,
+		Argv:     config.Argv,
+		Call:     config.Call,
+		Env:      config.Env,
+		Steps:    config.Steps,
+		Hooks:    config.Hooks,
+	}
+}
+
+type templatedScript struct {
+	name   string
+	script string
+	known  map[string][]string
+	// Whether the script runs with the command's interpreter, rather than being a file path or argument
+	interpreted bool
+}
+
+func getTemplatedScripts(cmd *types.CommandDefinition) []templatedScript {
+	argNames := []string{"json", "list"}
+	for _, arg := range cmd.Args {
+		argNames = append(argNames, arg.Name)
+	}
+
+	flagNames := []string{"json", "help"}
+	for _, flag := range cmd.Flags {
+		flagNames = append(flagNames, flag.Name)
+	}
+
+	// Scripts that run with this command's params
+	known := map[string][]string{
+		"args":   argNames,
+		"flags":  flagNames,
+		"params": knownParamsKeys,
+		"cli":    knownCLIKeys,
+	}
+
+	// Persistent hooks run with the params of whichever descendant is executed, so their args and flags
+	// can't be checked here
+	persistentKnown := map[string][]string{
+		"params": knownParamsKeys,
+		"cli":    knownCLIKeys,
+	}
+
+	// Build scripts run before there are any args or flags
+	buildKnown := map[string][]string{
+		"args":   {},
+		"flags":  {},
+		"params": {},
+		"cli":    {"bin_dir", "data_dir", "name"},
+	}
+
+	scripts := []templatedScript{
+		{"build script", cmd.Build, buildKnown, true},
+		{"validate script", cmd.Validate, known, true},
+		{"start script", cmd.Start, known, true},
+	}
+
+	if cmd.Run != nil {
+		scripts = append(scripts, templatedScript{"run file", cmd.Run.File, known, false})
+	}
+
+	for i, arg := range cmd.Argv {
+		scripts = append(scripts, templatedScript{fmt.Sprintf("argv[%d]", i), arg, known, false})
+	}
+
+	envNames := make([]string, 0, len(cmd.Env))
+	for name := range cmd.Env {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+	for _, name := range envNames {
+		scripts = append(scripts, templatedScript{"env " + name, cmd.Env[name], known, false})
+	}
+
+	for _, call := range cmd.Call {
+		for i, arg := range call.Args {
+			scripts = append(scripts, templatedScript{fmt.Sprintf("arg[%d] of call %s", i, call.Command), arg, known, false})
+		}
+
+		names := make([]string, 0, len(call.Flags))
+		for name := range call.Flags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			scripts = append(scripts, templatedScript{fmt.Sprintf("flag %s of call %s", name, call.Command), call.Flags[name], known, false})
+		}
+	}
+
+	for _, step := range cmd.Steps {
+		scripts = append(scripts, templatedScript{"step " + step.Name, step.Run, known, true})
+		if step.If != "" {
+			scripts = append(scripts, templatedScript{"condition of step " + step.Name, steps.Condition(step.If), known, false})
+		}
+	}
+
+	if hooks := cmd.Hooks; hooks != nil {
+		scripts = append(scripts,
+			templatedScript{"before hook", hooks.Before, known, true},
+			templatedScript{"after hook", hooks.After, known, true},
+			templatedScript{"on-error hook", hooks.OnError, known, true},
+			templatedScript{"finally hook", hooks.Finally, known, true},
+			templatedScript{"persistent-before hook", hooks.PersistentBefore, persistentKnown, true},
+			templatedScript{"persistent-after hook", hooks.PersistentAfter, persistentKnown, true},
+			templatedScript{"persistent-on-error hook", hooks.PersistentOnError, persistentKnown, true},
+			templatedScript{"persistent-finally hook", hooks.PersistentFinally, persistentKnown, true},
+		)
+	}
+
+	return scripts
+}
+
+// UsesOutputs reports whether a script references `outputs`, which only exist once the scripts that set
+// them have run.
+func UsesOutputs(script string) bool {
+	return len(referencedOutputs(script)) > 0
+}
+
+// ReferencedOutputs returns the names of the outputs the scripts of a command reference.
+func ReferencedOutputs(cmd *types.CommandDefinition) []string {
+	names := []string{}
+	for _, script := range getTemplatedScripts(cmd) {
+		for _, name := range referencedOutputs(script.script) {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+func referencedOutputs(script string) []string {
+	refs, err := interpolation.References(script)
+	if err != nil {
+		return nil
+	}
+
+	names := []string{}
+	for _, ref := range refs {
+		if ref.Namespace == "outputs" {
+			names = append(names, ref.Key)
+		}
+	}
+
+	return names
+}
+
+func validateCommandTemplates(cmd *types.CommandDefinition) error {
+	for _, script := range getTemplatedScripts(cmd) {
+		if script.script == "" {
+			continue
+		}
+
+		if err := interpolation.CheckReferences(script.script, script.known); err != nil {
+			return fmt.Errorf("invalid %s of command %s: %w", script.name, cmd.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build !windows
+
+package control
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// closeTimeout is how long the channel is still read after the script exits, for messages from processes
+// it left running.
+const closeTimeout = 100 * time.Millisecond
+
+// Attach opens a control channel for the command before it starts, as an extra file descriptor whose
+// number is set as CLI_CONTROL_FD. Both ends of it can be read and written, so scripts get the answers
+// to their prompts on the same descriptor. `terminal` runs a function while the CLI has the terminal.
+// The returned function closes the channel once the command is done.
+func Attach(cmd *exec.Cmd, handler *Handler, terminal func(fn func())) (func(), error) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control channel: %w", err)
+	}
+	syscall.CloseOnExec(fds[0])
+	syscall.CloseOnExec(fds[1])
+	// Our end is read through the runtime's poller, so that closing it stops a read that's waiting on
+	// processes the script left running
+	if err := syscall.SetNonblock(fds[0], true); err != nil {
+		syscall.Close(fds[0])
+		syscall.Close(fds[1])
+		return nil, fmt.Errorf("failed to open control channel: %w", err)
+	}
+
+	conn := os.NewFile(uintptr(fds[0]), "control")
+	scriptEnd := os.NewFile(uintptr(fds[1]), "control-script")
+
+	// Extra files follow stdin, stdout and stderr
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, scriptEnd)
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append(env, fmt.Sprintf("%s=%d", FDEnvVar, fd))
+	if handler.LibDir != "" {
+		env = append(env, LibEnvVar+"="+handler.LibDir)
+	}
+	cmd.Env = env
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		serve(conn, handler, terminal)
+	}()
+
+	return func() {
+		// The channel ends once no process holds the script's end anymore
+		scriptEnd.Close()
+		select {
+		case <-served:
+		case <-time.After(closeTimeout):
+		}
+		conn.Close()
+		<-served
+		status.finish(handler)
+	}, nil
+}
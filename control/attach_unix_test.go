@@ -0,0 +1,63 @@
+//go:build !windows
+
+package control
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runAttached(t *testing.T, script string) (map[string]string, string) {
+	t.Helper()
+
+	libDir, err := filepath.Abs("lib")
+	require.NoError(t, err)
+
+	outputs := map[string]string{}
+	handler := &Handler{LibDir: libDir, SetOutput: func(name string, value string) { outputs[name] = value }}
+
+	cmd := exec.Command("sh", "-c", script)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	closeControl, err := Attach(cmd, handler, func(fn func()) { fn() })
+	require.NoError(t, err)
+	require.NoError(t, cmd.Run())
+	closeControl()
+
+	return outputs, stdout.String()
+}
+
+func TestAttachShellLib(t *testing.T) {
+	outputs, stdout := runAttached(t, `
+		. "$CLI_CONTROL_LIB/cli.sh"
+		cli_progress "working" 1 2
+		cli_log info "halfway" step one
+		cli_output greeting 'a "quoted"
+value'
+		cli_done
+		answer=$(cli_prompt "Name?" input 'back\slash "anon"')
+		echo "answer=$answer"
+	`)
+
+	assert.Equal(t, map[string]string{"greeting": "a \"quoted\"\nvalue"}, outputs)
+	assert.Equal(t, "answer=back\\slash \"anon\"\n", stdout)
+}
+
+func TestAttachCloseWithLeftoverProcess(t *testing.T) {
+	start := time.Now()
+	outputs, _ := runAttached(t, `
+		. "$CLI_CONTROL_LIB/cli.sh"
+		cli_output done yes
+		sleep 5 >/dev/null &
+	`)
+
+	assert.Equal(t, map[string]string{"done": "yes"}, outputs)
+	assert.Less(t, time.Since(start), 4*time.Second)
+}
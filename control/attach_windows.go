@@ -0,0 +1,11 @@
+//go:build windows
+
+package control
+
+import "os/exec"
+
+// Attach doesn't open a control channel on Windows, where processes can't inherit extra file descriptors.
+// Scripts can tell from CLI_CONTROL_FD not being set.
+func Attach(cmd *exec.Cmd, handler *Handler, terminal func(fn func())) (func(), error) {
+	return func() {}, nil
+}
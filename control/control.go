@@ -0,0 +1,188 @@
+package control
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/migsc/cmdeagle/envvar"
+)
+
+//go:embed *
+var PackageFS embed.FS
+
+// Environment variables that tell scripts how to reach the control channel
+const (
+	// Number of the file descriptor scripts write messages to, and read replies from
+	FDEnvVar = "CLI_CONTROL_FD"
+	// Directory of the helper libraries for sh, node and python
+	LibEnvVar = "CLI_CONTROL_LIB"
+)
+
+// Types of the messages scripts send, one JSON object per line
+const (
+	// Shows a spinner, or a progress bar when `total` is set, until a message with `done` arrives
+	TypeProgress = "progress"
+	// Logs `message` at `level`, with `fields` as key-value pairs
+	TypeLog = "log"
+	// Sets the output `name` to `value`, which later steps and hooks can use as `{{outputs.<name>}}`
+	TypeOutput = "output"
+	// Asks the user and replies with the answer
+	TypePrompt = "prompt"
+)
+
+// Message is a message a script sends through the control channel. Which fields apply depends on its type.
+type Message struct {
+	Type    string `json:"type"`
+	Message string `json:"message,omitempty"`
+
+	// Progress
+	Current float64 `json:"current,omitempty"`
+	Total   float64 `json:"total,omitempty"`
+	Done    bool    `json:"done,omitempty"`
+
+	// Log
+	Level  string         `json:"level,omitempty"`
+	Fields map[string]any `json:"fields,omitempty"`
+
+	// Output
+	Name  string          `json:"name,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+
+	// Prompt: input, password, confirm or select
+	Kind    string   `json:"kind,omitempty"`
+	Options []string `json:"options,omitempty"`
+	Default string   `json:"default,omitempty"`
+}
+
+// Reply answers a prompt, with either the value the user gave or an error.
+type Reply struct {
+	Value string `json:"value"`
+	Error string `json:"error,omitempty"`
+}
+
+// Handler acts on the messages a script sends through the control channel.
+type Handler struct {
+	// Shown along with progress and log messages, e.g. the name of the step that sends them
+	Name string
+	// Directory of the helper libraries, exposed to scripts as CLI_CONTROL_LIB
+	LibDir string
+	// Receives the outputs the script sets
+	SetOutput func(name string, value string)
+}
+
+// maxMessageSize bounds a single line, so a script writing garbage can't exhaust memory.
+const maxMessageSize = 1024 * 1024
+
+// serve reads messages from the control channel until it's closed. Messages that can't be handled are
+// logged and skipped, so a broken message doesn't take the script down with it. `terminal` runs a
+// function while the CLI has the terminal, which prompts need.
+func serve(conn io.ReadWriter, handler *Handler, terminal func(fn func())) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+
+	logger := log.Default()
+	if handler.Name != "" {
+		logger = logger.WithPrefix(handler.Name)
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			log.Warn("Ignoring invalid control message", "error", err)
+			continue
+		}
+
+		if err := handle(conn, handler, logger, terminal, msg); err != nil {
+			log.Warn("Ignoring control message", "type", msg.Type, "error", err)
+		}
+	}
+}
+
+func handle(conn io.Writer, handler *Handler, logger *log.Logger, terminal func(fn func()), msg Message) error {
+	switch msg.Type {
+	case TypeProgress:
+		status.update(handler, msg)
+		return nil
+
+	case TypeLog:
+		level := log.InfoLevel
+		if msg.Level != "" {
+			parsed, err := log.ParseLevel(msg.Level)
+			if err != nil {
+				return err
+			}
+			level = parsed
+		}
+
+		names := make([]string, 0, len(msg.Fields))
+		for name := range msg.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		keyvals := make([]any, 0, 2*len(names))
+		for _, name := range names {
+			keyvals = append(keyvals, name, msg.Fields[name])
+		}
+
+		status.pause(func() {
+			logger.Log(level, msg.Message, keyvals...)
+		})
+		return nil
+
+	case TypeOutput:
+		if !envvar.IsValidName(msg.Name) {
+			return fmt.Errorf("invalid output name %q, use letters, digits and underscores", msg.Name)
+		}
+		if handler.SetOutput != nil {
+			handler.SetOutput(msg.Name, outputValue(msg.Value))
+		}
+		return nil
+
+	case TypePrompt:
+		var reply Reply
+		terminal(func() {
+			status.pause(func() {
+				value, err := prompt(msg)
+				if err != nil {
+					reply.Error = err.Error()
+				}
+				reply.Value = value
+			})
+		})
+
+		encoder := json.NewEncoder(conn)
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(reply)
+
+	default:
+		return fmt.Errorf("unknown type %q", msg.Type)
+	}
+}
+
+// outputValue turns the value of an output into the string params hold. Strings are taken as they are,
+// and anything else as its compact JSON.
+func outputValue(raw json.RawMessage) string {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return string(raw)
+	}
+	return compact.String()
+}
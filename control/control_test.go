@@ -0,0 +1,61 @@
+package control
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConn reads the messages of a script from a string and records the replies.
+type fakeConn struct {
+	*strings.Reader
+	replies bytes.Buffer
+}
+
+func (conn *fakeConn) Write(p []byte) (int, error) {
+	return conn.replies.Write(p)
+}
+
+func serveMessages(messages string) (map[string]string, string) {
+	outputs := map[string]string{}
+	handler := &Handler{SetOutput: func(name string, value string) { outputs[name] = value }}
+
+	conn := &fakeConn{Reader: strings.NewReader(messages)}
+	serve(conn, handler, func(fn func()) { fn() })
+
+	return outputs, conn.replies.String()
+}
+
+func TestServeOutputs(t *testing.T) {
+	outputs, _ := serveMessages(`{"type":"output","name":"version","value":"1.2.3"}
+
+not json
+{"type":"output","name":"meta","value":{"a": 1, "b": [true]}}
+{"type":"output","name":"bad name","value":"x"}
+{"type":"unknown"}
+{"type":"log","level":"loud","message":"ignored"}
+{"type":"log","level":"debug","message":"logged","fields":{"b":2,"a":1}}
+{"type":"progress","message":"working","current":1,"total":2}
+{"type":"progress","done":true}
+{"type":"output","name":"count","value":3}
+`)
+
+	assert.Equal(t, map[string]string{
+		"version": "1.2.3",
+		"meta":    `{"a":1,"b":[true]}`,
+		"count":   "3",
+	}, outputs)
+}
+
+func TestServePromptWithoutTerminal(t *testing.T) {
+	// Tests don't run with a terminal on stdin, so prompts are answered with their default
+	_, replies := serveMessages(`{"type":"prompt","message":"Name?","default":"anon"}
+{"type":"prompt","message":"Sure?","kind":"confirm"}
+`)
+
+	assert.Equal(t, `{"value":"anon"}
+{"value":"","error":"can't ask \"Sure?\", stdin is not a terminal"}
+`, replies)
+}
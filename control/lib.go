@@ -0,0 +1,42 @@
+package control
+
+import (
+	"bytes"
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+//go:embed lib
+var libFS embed.FS
+
+// InstallLib writes the helper libraries to dir, where scripts find them through CLI_CONTROL_LIB. Files
+// that are already up to date are left alone.
+func InstallLib(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	entries, err := fs.ReadDir(libFS, "lib")
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		content, err := libFS.ReadFile("lib/" + entry.Name())
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, content) {
+			continue
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
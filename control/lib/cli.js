@@ -0,0 +1,77 @@
+// Helpers for node scripts to talk to the CLI that runs them. Require it with:
+//
+//   const cli = require(`${process.env.CLI_CONTROL_LIB}/cli.js`)
+//
+// Without a control channel, e.g. on Windows, progress and log messages go to stderr, outputs are
+// dropped and prompts throw.
+"use strict";
+
+const fs = require("fs");
+
+const fd = process.env.CLI_CONTROL_FD ? Number(process.env.CLI_CONTROL_FD) : null;
+
+function send(message) {
+  if (fd !== null) {
+    fs.writeSync(fd, JSON.stringify(message) + "\n");
+  }
+}
+
+// Shows a spinner with the message, or a progress bar when current and total are given.
+function progress(message, current, total) {
+  if (fd === null) {
+    process.stderr.write(message + "\n");
+    return;
+  }
+  send(total === undefined ? { type: "progress", message } : { type: "progress", message, current, total });
+}
+
+// Removes the spinner or progress bar.
+function done() {
+  send({ type: "progress", done: true });
+}
+
+// Logs a message at the level (debug, info, warn or error) through the CLI's logger.
+function log(level, message, fields = {}) {
+  if (fd === null) {
+    process.stderr.write(`${level}: ${message}\n`);
+    return;
+  }
+  send({ type: "log", level, message, fields });
+}
+
+// Sets an output that later steps and hooks can use as {{outputs.<name>}} or $OUTPUTS_<NAME>.
+function output(name, value) {
+  send({ type: "output", name, value });
+}
+
+// Asks the user and returns the answer. kind is input (the default), password, confirm or select, which
+// takes options.
+function prompt(message, { kind = "input", default: defaultValue = "", options = [] } = {}) {
+  if (fd === null) {
+    throw new Error("cli.prompt: no control channel");
+  }
+  send({ type: "prompt", message, kind, default: String(defaultValue), options });
+
+  // Read the reply a byte at a time, so nothing after it is consumed
+  const bytes = [];
+  const buffer = Buffer.alloc(1);
+  for (;;) {
+    let read;
+    try {
+      read = fs.readSync(fd, buffer, 0, 1, null);
+    } catch (err) {
+      if (err.code === "EAGAIN") continue;
+      throw err;
+    }
+    if (read === 0 || buffer[0] === 0x0a) break;
+    bytes.push(buffer[0]);
+  }
+
+  const reply = JSON.parse(Buffer.from(bytes).toString("utf8"));
+  if (reply.error) {
+    throw new Error(`cli.prompt: ${reply.error}`);
+  }
+  return kind === "confirm" ? reply.value === "true" : reply.value;
+}
+
+module.exports = { progress, done, log, output, prompt };
@@ -0,0 +1,69 @@
+"""Helpers for python scripts to talk to the CLI that runs them. Import it with:
+
+    import os, sys
+    sys.path.insert(0, os.environ["CLI_CONTROL_LIB"])
+    import cli
+
+Without a control channel, e.g. on Windows, progress and log messages go to stderr, outputs are
+dropped and prompts raise.
+"""
+
+import json
+import os
+import sys
+
+_fd = int(os.environ["CLI_CONTROL_FD"]) if os.environ.get("CLI_CONTROL_FD") else None
+
+
+def _send(message):
+    if _fd is not None:
+        os.write(_fd, (json.dumps(message) + "\n").encode("utf-8"))
+
+
+def progress(message, current=None, total=None):
+    """Shows a spinner with the message, or a progress bar when current and total are given."""
+    if _fd is None:
+        print(message, file=sys.stderr)
+        return
+    if total is None:
+        _send({"type": "progress", "message": message})
+    else:
+        _send({"type": "progress", "message": message, "current": current, "total": total})
+
+
+def done():
+    """Removes the spinner or progress bar."""
+    _send({"type": "progress", "done": True})
+
+
+def log(level, message, **fields):
+    """Logs a message at the level (debug, info, warn or error) through the CLI's logger."""
+    if _fd is None:
+        print(f"{level}: {message}", file=sys.stderr)
+        return
+    _send({"type": "log", "level": level, "message": message, "fields": fields})
+
+
+def output(name, value):
+    """Sets an output that later steps and hooks can use as {{outputs.<name>}} or $OUTPUTS_<NAME>."""
+    _send({"type": "output", "name": name, "value": value})
+
+
+def prompt(message, kind="input", default="", options=()):
+    """Asks the user and returns the answer. kind is input, password, confirm or select, which takes options."""
+    if _fd is None:
+        raise RuntimeError("cli.prompt: no control channel")
+    _send({"type": "prompt", "message": message, "kind": kind, "default": str(default), "options": list(options)})
+
+    # Read the reply a byte at a time, so nothing after it is consumed
+    reply = b""
+    while True:
+        byte = os.read(_fd, 1)
+        if not byte or byte == b"\n":
+            break
+        reply += byte
+
+    answer = json.loads(reply.decode("utf-8"))
+    if answer.get("error"):
+        raise RuntimeError(f"cli.prompt: {answer['error']}")
+    return answer["value"] == "true" if kind == "confirm" else answer["value"]
@@ -0,0 +1,119 @@
+# Helpers for sh, bash and zsh scripts to talk to the CLI that runs them. Source it with:
+#
+#   . "$CLI_CONTROL_LIB/cli.sh"
+#
+# Without a control channel, e.g. on Windows, progress and log messages go to stderr, outputs are
+# dropped and prompts fail.
+
+# Encodes a string as a JSON string literal. Characters are escaped one at a time, since awks disagree on
+# how backslashes in gsub replacements are treated.
+_cli_json() {
+  printf '%s' "$1" | awk '
+    BEGIN { ORS = ""; print "\"" }
+    NR > 1 { print "\\n" }
+    {
+      for (i = 1; i <= length($0); i++) {
+        c = substr($0, i, 1)
+        if (c == "\\") c = "\\\\"
+        else if (c == "\"") c = "\\\""
+        else if (c == "\t") c = "\\t"
+        else if (c == "\r") c = "\\r"
+        print c
+      }
+    }
+    END { print "\"" }'
+}
+
+_cli_send() {
+  if [ -n "${CLI_CONTROL_FD:-}" ]; then
+    printf '%s\n' "$1" >&"$CLI_CONTROL_FD"
+  fi
+}
+
+# cli_progress MESSAGE [CURRENT TOTAL]
+# Shows a spinner with the message, or a progress bar when CURRENT and TOTAL are given.
+cli_progress() {
+  if [ -z "${CLI_CONTROL_FD:-}" ]; then
+    printf '%s\n' "$1" >&2
+    return
+  fi
+  if [ $# -ge 3 ]; then
+    _cli_send "{\"type\":\"progress\",\"message\":$(_cli_json "$1"),\"current\":$2,\"total\":$3}"
+  else
+    _cli_send "{\"type\":\"progress\",\"message\":$(_cli_json "$1")}"
+  fi
+}
+
+# cli_done
+# Removes the spinner or progress bar.
+cli_done() {
+  _cli_send '{"type":"progress","done":true}'
+}
+
+# cli_log LEVEL MESSAGE [KEY VALUE]...
+# Logs a message at the level (debug, info, warn or error) through the CLI's logger.
+cli_log() {
+  if [ -z "${CLI_CONTROL_FD:-}" ]; then
+    printf '%s: %s\n' "$1" "$2" >&2
+    return
+  fi
+  _cli_level=$1
+  _cli_message=$2
+  shift 2
+  _cli_fields=""
+  while [ $# -ge 2 ]; do
+    _cli_fields="$_cli_fields${_cli_fields:+,}$(_cli_json "$1"):$(_cli_json "$2")"
+    shift 2
+  done
+  _cli_send "{\"type\":\"log\",\"level\":$(_cli_json "$_cli_level"),\"message\":$(_cli_json "$_cli_message"),\"fields\":{$_cli_fields}}"
+}
+
+# cli_output NAME VALUE
+# Sets an output that later steps and hooks can use as {{outputs.NAME}} or $OUTPUTS_NAME.
+cli_output() {
+  _cli_send "{\"type\":\"output\",\"name\":$(_cli_json "$1"),\"value\":$(_cli_json "$2")}"
+}
+
+# cli_prompt MESSAGE [KIND [DEFAULT [OPTION]...]]
+# Asks the user and prints the answer. KIND is input (the default), password, confirm or select, for
+# which the options follow the default. Returns 1 if the user couldn't be asked.
+cli_prompt() {
+  if [ -z "${CLI_CONTROL_FD:-}" ]; then
+    echo "cli_prompt: no control channel" >&2
+    return 1
+  fi
+  _cli_message=$1
+  _cli_kind=${2:-input}
+  _cli_default=${3:-}
+  shift $(($# < 3 ? $# : 3))
+  _cli_options=""
+  for _cli_option in "$@"; do
+    _cli_options="$_cli_options${_cli_options:+,}$(_cli_json "$_cli_option")"
+  done
+  _cli_send "{\"type\":\"prompt\",\"message\":$(_cli_json "$_cli_message"),\"kind\":$(_cli_json "$_cli_kind"),\"default\":$(_cli_json "$_cli_default"),\"options\":[$_cli_options]}"
+
+  IFS= read -r _cli_reply <&"$CLI_CONTROL_FD" || return 1
+  # Replies are {"value":"..."} or {"value":"","error":"..."}
+  case $_cli_reply in
+    *'"error":'*)
+      printf '%s\n' "$_cli_reply" | sed 's/.*"error":"\(.*\)"}$/cli_prompt: \1/' >&2
+      return 1
+      ;;
+  esac
+  printf '%s\n' "$_cli_reply" | sed 's/^{"value":"\(.*\)"}$/\1/' | awk '
+    {
+      out = ""
+      for (i = 1; i <= length($0); i++) {
+        c = substr($0, i, 1)
+        if (c == "\\") {
+          i++
+          c = substr($0, i, 1)
+          if (c == "n") c = "\n"
+          else if (c == "t") c = "\t"
+          else if (c == "r") c = "\r"
+        }
+        out = out c
+      }
+      print out
+    }'
+}
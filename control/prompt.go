@@ -0,0 +1,73 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/charmbracelet/huh"
+	"github.com/charmbracelet/x/term"
+
+	"github.com/migsc/cmdeagle/params"
+)
+
+// Kinds of prompts
+const (
+	PromptInput    = "input"
+	PromptPassword = "password"
+	PromptConfirm  = "confirm"
+	PromptSelect   = "select"
+)
+
+// prompt asks the user what a prompt message says, on stderr so it doesn't mix with the data a script
+// prints. Without a terminal, the default is the answer, if there's one.
+func prompt(msg Message) (string, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		if msg.Default != "" {
+			return msg.Default, nil
+		}
+		return "", fmt.Errorf("can't ask %q, stdin is not a terminal", msg.Message)
+	}
+
+	var value string
+	confirmed := msg.Default == "true"
+
+	var field huh.Field
+	switch msg.Kind {
+	case "", PromptInput:
+		// The default is shown as a placeholder and is the answer if the user doesn't type anything
+		field = huh.NewInput().Title(msg.Message).Placeholder(msg.Default).Value(&value)
+	case PromptPassword:
+		field = huh.NewInput().Title(msg.Message).EchoMode(huh.EchoModePassword).Value(&value)
+	case PromptConfirm:
+		field = huh.NewConfirm().Title(msg.Message).Value(&confirmed)
+	case PromptSelect:
+		if len(msg.Options) == 0 {
+			return "", fmt.Errorf("select prompts need options")
+		}
+		value = msg.Default
+		field = huh.NewSelect[string]().Title(msg.Message).Options(huh.NewOptions(msg.Options...)...).Value(&value)
+	default:
+		return "", fmt.Errorf("unknown prompt kind %q, use %s, %s, %s or %s", msg.Kind, PromptInput, PromptPassword, PromptConfirm, PromptSelect)
+	}
+
+	err := huh.NewForm(huh.NewGroup(field)).WithOutput(os.Stderr).WithShowHelp(false).Run()
+	if errors.Is(err, huh.ErrUserAborted) {
+		return "", fmt.Errorf("cancelled")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if msg.Kind == PromptConfirm {
+		return strconv.FormatBool(confirmed), nil
+	}
+	if msg.Kind == PromptPassword {
+		params.AddSecret(value)
+	}
+	if value == "" {
+		return msg.Default, nil
+	}
+	return value, nil
+}
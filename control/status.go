@@ -0,0 +1,173 @@
+package control
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/charmbracelet/x/term"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const barWidth = 20
+
+// status is the line on stderr that shows the progress scripts report. Scripts that run at the same time,
+// like steps, share it, and the one that reported last is shown.
+var status = newStatusLine(os.Stderr, term.IsTerminal(os.Stderr.Fd()))
+
+type task struct {
+	handler *Handler
+	msg     Message
+}
+
+type statusLine struct {
+	mu  sync.Mutex
+	out io.Writer
+	// Without a terminal to redraw a line on, progress messages are logged instead
+	tty    bool
+	tasks  []*task
+	frame  int
+	shown  bool
+	paused bool
+	stop   chan struct{}
+}
+
+func newStatusLine(out io.Writer, tty bool) *statusLine {
+	return &statusLine{out: out, tty: tty}
+}
+
+// update shows the progress a script reported, or removes it once it's done.
+func (line *statusLine) update(handler *Handler, msg Message) {
+	line.mu.Lock()
+	defer line.mu.Unlock()
+
+	index := -1
+	for i, t := range line.tasks {
+		if t.handler == handler {
+			index = i
+		}
+	}
+
+	if !line.tty {
+		changed := index < 0 || line.tasks[index].msg.Message != msg.Message
+		if msg.Message != "" && (changed || msg.Done) {
+			keyvals := []any{}
+			if handler.Name != "" {
+				keyvals = append(keyvals, "step", handler.Name)
+			}
+			if msg.Total > 0 {
+				keyvals = append(keyvals, "progress", fmt.Sprintf("%g/%g", msg.Current, msg.Total))
+			}
+			log.Info(msg.Message, keyvals...)
+		}
+	}
+
+	if index >= 0 {
+		line.tasks = append(line.tasks[:index], line.tasks[index+1:]...)
+	}
+	if !msg.Done {
+		// The task that reported last goes to the end, where it's shown from
+		line.tasks = append(line.tasks, &task{handler: handler, msg: msg})
+	}
+
+	if line.tty {
+		line.render()
+		line.ticking()
+	}
+}
+
+// finish removes whatever progress a script left behind when it exits.
+func (line *statusLine) finish(handler *Handler) {
+	line.update(handler, Message{Done: true})
+}
+
+// pause clears the line while fn writes to the terminal, and redraws it afterwards.
+func (line *statusLine) pause(fn func()) {
+	line.mu.Lock()
+	line.clear()
+	line.paused = true
+	line.mu.Unlock()
+
+	defer func() {
+		line.mu.Lock()
+		line.paused = false
+		line.render()
+		line.mu.Unlock()
+	}()
+
+	fn()
+}
+
+// ticking starts or stops animating the spinner, depending on whether there's anything to show.
+func (line *statusLine) ticking() {
+	if len(line.tasks) == 0 {
+		if line.stop != nil {
+			close(line.stop)
+			line.stop = nil
+		}
+		return
+	}
+
+	if line.stop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	line.stop = stop
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				line.mu.Lock()
+				line.frame++
+				line.render()
+				line.mu.Unlock()
+			}
+		}
+	}()
+}
+
+func (line *statusLine) clear() {
+	if line.shown {
+		fmt.Fprint(line.out, "\r\033[K")
+		line.shown = false
+	}
+}
+
+func (line *statusLine) render() {
+	line.clear()
+	if !line.tty || line.paused || len(line.tasks) == 0 {
+		return
+	}
+
+	current := line.tasks[len(line.tasks)-1]
+	text := spinnerFrames[line.frame%len(spinnerFrames)] + " "
+	if current.handler.Name != "" {
+		text += "[" + current.handler.Name + "] "
+	}
+	text += current.msg.Message
+
+	if total := current.msg.Total; total > 0 {
+		ratio := math.Max(0, math.Min(1, current.msg.Current/total))
+		filled := int(ratio * barWidth)
+		text += fmt.Sprintf(" %s%s %3.0f%%", strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled), ratio*100)
+	}
+
+	if others := len(line.tasks) - 1; others > 0 {
+		text += fmt.Sprintf(" (+%d more)", others)
+	}
+
+	fmt.Fprint(line.out, text)
+	line.shown = true
+}
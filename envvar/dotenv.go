@@ -0,0 +1,124 @@
+package envvar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// IsValidName reports whether a string can be used as the name of an environment variable.
+func IsValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// ParseDotenv reads variables in the dotenv format: `NAME=value` lines with an optional `export` in
+// front, `#` comments and blank lines. Values in single quotes are taken as they are, values in double
+// quotes may span lines and support `\n`, `\t`, `\"` and `\\` escapes, and unquoted values end at a `#`
+// that follows a space. Variables aren't expanded.
+func ParseDotenv(r io.Reader) ([]types.EnvVar, error) {
+	vars := []types.EnvVar{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || !IsValidName(name) {
+			return nil, fmt.Errorf("line %d: expected NAME=value", lineNumber)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single-quoted value of %s", lineNumber, name)
+			}
+			value = value[1 : end+1]
+
+		case strings.HasPrefix(value, `"`):
+			start := lineNumber
+			raw := value[1:]
+			for {
+				if end := closingQuote(raw); end >= 0 {
+					raw = raw[:end]
+					break
+				}
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %d: unterminated double-quoted value of %s", start, name)
+				}
+				lineNumber++
+				raw += "\n" + scanner.Text()
+			}
+			value = unescape(raw)
+
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = value[:comment]
+			}
+			value = strings.TrimSpace(value)
+		}
+
+		vars = append(vars, types.EnvVar{Name: name, Value: value})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return vars, nil
+}
+
+// closingQuote returns the index of the first double quote that isn't escaped, or -1.
+func closingQuote(value string) int {
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescape(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value)
+}
+
+// fileVars holds the variables loaded from the `env-files` of the command being run.
+var fileVars = map[string]string{}
+
+// SetFileVars sets the variables loaded from env files, which Lookup falls back to.
+func SetFileVars(vars []types.EnvVar) {
+	fileVars = map[string]string{}
+	for _, envVar := range vars {
+		fileVars[envVar.Name] = envVar.Value
+	}
+}
+
+// Lookup returns the value of an environment variable, or the value it has in the env files of the
+// command when it isn't set. Variables that are set always win over env files, like with most dotenv
+// loaders.
+func Lookup(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+
+	value, ok := fileVars[name]
+	return value, ok
+}
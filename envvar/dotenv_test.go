@@ -0,0 +1,65 @@
+package envvar
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+func TestParseDotenv(t *testing.T) {
+	vars, err := ParseDotenv(strings.NewReader(`
+# Comment
+PLAIN=value
+export EXPORTED=yes
+SPACED = padded value   # trailing comment
+HASH=a#b
+EMPTY=
+SINGLE='$HOME stays # literal'
+DOUBLE="line\nbreak \"quoted\""
+MULTI="first
+second"
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.EnvVar{
+		{Name: "PLAIN", Value: "value"},
+		{Name: "EXPORTED", Value: "yes"},
+		{Name: "SPACED", Value: "padded value"},
+		{Name: "HASH", Value: "a#b"},
+		{Name: "EMPTY", Value: ""},
+		{Name: "SINGLE", Value: "$HOME stays # literal"},
+		{Name: "DOUBLE", Value: "line\nbreak \"quoted\""},
+		{Name: "MULTI", Value: "first\nsecond"},
+	}, vars)
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	_, err := ParseDotenv(strings.NewReader("OK=1\nnot a variable\n"))
+	assert.EqualError(t, err, "line 2: expected NAME=value")
+
+	_, err = ParseDotenv(strings.NewReader("1BAD=x"))
+	assert.Error(t, err)
+
+	_, err = ParseDotenv(strings.NewReader("OPEN=\"never\nclosed\n"))
+	assert.EqualError(t, err, "line 1: unterminated double-quoted value of OPEN")
+}
+
+func TestLookup(t *testing.T) {
+	t.Setenv("FROM_ENV", "env")
+	SetFileVars([]types.EnvVar{{Name: "FROM_ENV", Value: "file"}, {Name: "FROM_FILE", Value: "file"}})
+	defer SetFileVars(nil)
+
+	value, _ := Lookup("FROM_ENV")
+	assert.Equal(t, "env", value, "variables that are set win over env files")
+
+	value, ok := Lookup("FROM_FILE")
+	assert.True(t, ok)
+	assert.Equal(t, "file", value)
+
+	_, ok = Lookup("CMDEAGLE_UNSET_VARIABLE")
+	assert.False(t, ok)
+}
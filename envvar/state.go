@@ -1,9 +1,7 @@
 package envvar
 
 import (
-	"fmt"
-	"strings"
-
+	"github.com/migsc/cmdeagle/interpolation"
 	"github.com/migsc/cmdeagle/types"
 )
 
@@ -23,13 +21,19 @@ func (store *EnvStateStore) Set(key string, value string) {
 	store.Entries[key] = value
 }
 
-func (store *EnvStateStore) Interpolate(script string) string {
+func (store *EnvStateStore) Interpolate(script string) (string, error) {
+	return store.InterpolateScript(script, interpolation.QuoteNone)
+}
+
+// InterpolateScript renders a script that runs with an interpreter, escaping the values it inserts with
+// the interpreter's quoting.
+func (store *EnvStateStore) InterpolateScript(script string, quoting interpolation.Quoting) (string, error) {
+	ctx := interpolation.NewContext()
 	for key, val := range store.Entries {
-		placeholder := fmt.Sprintf("{{%s}}", key)
-		script = strings.ReplaceAll(script, placeholder, fmt.Sprint(val))
+		ctx.Set(key, val)
 	}
 
-	return script
+	return interpolation.RenderScript(script, ctx, quoting)
 }
 
 func (store *EnvStateStore) GetEnvVariables() []types.EnvVar {
@@ -0,0 +1,185 @@
+package executable
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// Ways the included files of a bundle can be stored, as declared by its `compression` setting
+const (
+	// As they are, each embedded on its own
+	CompressionNone = "none"
+	// In a gzip-compressed tar archive
+	CompressionGzip = "gzip"
+)
+
+// ArchiveFileName is the file at the root of a compressed bundle that holds its included files.
+const ArchiveFileName = "bundle.tar.gz"
+
+// ValidateCompression checks the value of a `compression` setting.
+func ValidateCompression(compression string) error {
+	switch compression {
+	case "", CompressionNone, CompressionGzip:
+		return nil
+	default:
+		return fmt.Errorf("invalid compression %q: must be %s or %s", compression, CompressionNone, CompressionGzip)
+	}
+}
+
+// OpenBundle returns the files of an embedded bundle. Compressed bundles serve their included files from
+// their archive, so the rest of the CLI reads them the same way either way.
+func OpenBundle(fsys fs.FS) (fs.FS, error) {
+	files, err := ReadFilesManifest(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if files.Archive == "" {
+		return fsys, nil
+	}
+	return &archiveFS{FS: fsys, files: files}, nil
+}
+
+// archiveFS is the bundle of a CLI built with compression, whose included files are in an archive.
+type archiveFS struct {
+	fs.FS
+	files *FilesManifest
+}
+
+func (fsys *archiveFS) archived(name string) bool {
+	_, ok := fsys.files.Sizes[name]
+	return ok
+}
+
+// Open decompresses the archive up to an archived file, which suits the few files that are read on their
+// own, like message catalogs. Extraction and repairs go through the archive once for all the files they
+// need instead, and verification checks the sizes and hashes of the files manifest without decompressing it.
+func (fsys *archiveFS) Open(name string) (fs.File, error) {
+	if !fsys.archived(name) {
+		return fsys.FS.Open(name)
+	}
+
+	var file *archivedFile
+	err := fsys.walk(func(header *tar.Header, content io.Reader) (bool, error) {
+		if header.Name != name {
+			return true, nil
+		}
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return false, err
+		}
+		file = &archivedFile{Reader: bytes.NewReader(data), info: header.FileInfo()}
+		return false, nil
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if file == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return file, nil
+}
+
+// Stat tells the size of archived files from the files manifest, without decompressing the archive.
+func (fsys *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	if !fsys.archived(name) {
+		return fs.Stat(fsys.FS, name)
+	}
+
+	mode, err := fsys.files.Mode(name)
+	if err != nil {
+		return nil, err
+	}
+	header := &tar.Header{Name: name, Typeflag: tar.TypeReg, Size: fsys.files.Sizes[name], Mode: int64(mode)}
+	return header.FileInfo(), nil
+}
+
+// walk decompresses the archive, and calls fn with each file in it until fn returns false.
+func (fsys *archiveFS) walk(fn func(header *tar.Header, content io.Reader) (bool, error)) error {
+	archive, err := fsys.FS.Open(fsys.files.Archive)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", fsys.files.Archive, err)
+	}
+	defer archive.Close()
+
+	decompressed, err := gzip.NewReader(archive)
+	if err != nil {
+		return fmt.Errorf("failed to decompress %s: %w", fsys.files.Archive, err)
+	}
+	defer decompressed.Close()
+
+	reader := tar.NewReader(decompressed)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", fsys.files.Archive, err)
+		}
+
+		more, err := fn(header, reader)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// extractFiles writes the archived files among paths into dir, in a single pass through the archive that
+// streams each file to disk, and returns the other paths.
+func (fsys *archiveFS) extractFiles(dir string, paths []string, modTime time.Time) ([]string, error) {
+	wanted := map[string]bool{}
+	rest := []string{}
+	for _, path := range paths {
+		if fsys.archived(path) {
+			wanted[path] = true
+		} else {
+			rest = append(rest, path)
+		}
+	}
+	if len(wanted) == 0 {
+		return rest, nil
+	}
+
+	err := fsys.walk(func(header *tar.Header, content io.Reader) (bool, error) {
+		if !wanted[header.Name] {
+			return true, nil
+		}
+
+		mode, err := fsys.files.Mode(header.Name)
+		if err != nil {
+			return false, err
+		}
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(header.Name)), content, mode, modTime); err != nil {
+			return false, err
+		}
+
+		delete(wanted, header.Name)
+		return len(wanted) > 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for path := range wanted {
+		return nil, fmt.Errorf("failed to read embedded file %s: not in %s", path, fsys.files.Archive)
+	}
+
+	return rest, nil
+}
+
+// archivedFile is a file read from the archive.
+type archivedFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (file *archivedFile) Stat() (fs.FileInfo, error) { return file.info, nil }
+
+func (file *archivedFile) Close() error { return nil }
+
+var _ fs.StatFS = (*archiveFS)(nil)
@@ -0,0 +1,159 @@
+package executable
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compressedBundle is a bundle whose included files are in its archive, like the ones built with
+// compression.
+func compressedBundle(t *testing.T, files map[string]string, manifest FilesManifest) fstest.MapFS {
+	t.Helper()
+
+	var archive bytes.Buffer
+	compressed := gzip.NewWriter(&archive)
+	writer := tar.NewWriter(compressed)
+	manifest.Archive = ArchiveFileName
+	manifest.Sizes = map[string]int64{}
+	for path, content := range files {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: path, Mode: 0644, Size: int64(len(content))}))
+		_, err := writer.Write([]byte(content))
+		require.NoError(t, err)
+		manifest.Sizes[path] = int64(len(content))
+	}
+	require.NoError(t, writer.Close())
+	require.NoError(t, compressed.Close())
+
+	content, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	return fstest.MapFS{
+		"config.cmd.yaml": {Data: []byte("name: mycli\n")},
+		ArchiveFileName:   {Data: archive.Bytes()},
+		FilesManifestName: {Data: content},
+	}
+}
+
+var archivedFiles = map[string]string{
+	"shared.sh":         "echo shared",
+	"db/schema.sql":     "create table t;",
+	"db/migrate/run.sh": "echo migrate",
+}
+
+func TestOpenBundle(t *testing.T) {
+	bundle, err := OpenBundle(compressedBundle(t, archivedFiles, FilesManifest{}))
+	require.NoError(t, err)
+
+	content, err := fs.ReadFile(bundle, "db/schema.sql")
+	require.NoError(t, err)
+	assert.Equal(t, "create table t;", string(content))
+
+	info, err := fs.Stat(bundle, "db/migrate/run.sh")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("echo migrate")), info.Size())
+
+	// Files outside the archive are read from the bundle itself
+	content, err = fs.ReadFile(bundle, "config.cmd.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "name: mycli\n", string(content))
+
+	// Bundles without an archive are used as they are
+	plain := testBundle("echo hi")
+	opened, err := OpenBundle(plain)
+	require.NoError(t, err)
+	assert.Equal(t, plain, opened)
+}
+
+func TestExtractCommandFilesFromArchive(t *testing.T) {
+	appDataDir := t.TempDir()
+
+	bundle, err := OpenBundle(compressedBundle(t, archivedFiles, FilesManifest{
+		Modes: map[string]string{"db/migrate/run.sh": "0755"},
+		Commands: map[string][]string{
+			"":           {"shared.sh"},
+			"db":         {"db/schema.sql"},
+			"db:migrate": {"db/migrate/run.sh"},
+		},
+	}))
+	require.NoError(t, err)
+
+	dir, err := InstallBundle(bundle, appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, ArchiveFileName))
+
+	require.NoError(t, ExtractCommandFiles(bundle, dir, "db:migrate"))
+	for path, expected := range archivedFiles {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "db", "migrate", "run.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// Extracted files are checked against the sizes in the manifest
+	changed, err := VerifyCommandFiles(bundle, dir, "db:migrate", false)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shared.sh"), []byte("echo changed!"), 0644))
+	repaired, err := RepairBundle(bundle, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shared.sh"}, repaired)
+	content, err := os.ReadFile(filepath.Join(dir, "shared.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "echo shared", string(content))
+}
+
+func TestArchiveIsReadOncePerExtraction(t *testing.T) {
+	appDataDir := t.TempDir()
+
+	hashes := map[string]string{}
+	for path, content := range archivedFiles {
+		sum := sha256.Sum256([]byte(content))
+		hashes[path] = hex.EncodeToString(sum[:])
+	}
+	embedded := newCountingFS(compressedBundle(t, archivedFiles, FilesManifest{
+		Hashes:   hashes,
+		Commands: map[string][]string{"": {"shared.sh", "db/schema.sql", "db/migrate/run.sh"}},
+	}))
+	bundle, err := OpenBundle(embedded)
+	require.NoError(t, err)
+
+	dir, err := InstallBundle(bundle, appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+	require.NoError(t, ExtractCommandFiles(bundle, dir, ""))
+	assert.Equal(t, int32(1), embedded.reads[ArchiveFileName].Load())
+
+	// Extracted files are checked against the hashes in the manifest, without decompressing the archive
+	changed, err := VerifyBundle(bundle, dir)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, int32(1), embedded.reads[ArchiveFileName].Load())
+
+	for path := range archivedFiles {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, filepath.FromSlash(path)), []byte("changed"), 0644))
+	}
+	repaired, err := RepairBundle(bundle, dir)
+	require.NoError(t, err)
+	assert.Len(t, repaired, len(archivedFiles))
+	assert.Equal(t, int32(2), embedded.reads[ArchiveFileName].Load())
+}
+
+func TestValidateCompression(t *testing.T) {
+	assert.NoError(t, ValidateCompression(""))
+	assert.NoError(t, ValidateCompression(CompressionGzip))
+	assert.ErrorContains(t, ValidateCompression("zip"), "invalid compression")
+}
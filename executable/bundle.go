@@ -0,0 +1,585 @@
+package executable
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// ManifestFileName is the file in each version directory that records what was extracted into it. It's
+// written last, so a directory with a manifest is complete.
+const ManifestFileName = ".manifest.json"
+
+// CurrentFileName is the file in the data directory that names the version directory of the CLI that ran
+// last.
+const CurrentFileName = "current"
+
+// keepVersions is how many of the most recently used versions are kept in the data directory, so that
+// installs of different versions on the same machine don't remove each other's files.
+const keepVersions = 3
+
+// Extractions that were interrupted leave their temporary directory behind, which is removed once it's
+// this old.
+const staleExtractionAge = time.Hour
+
+const extractionPrefix = ".extract-"
+
+// FilesManifestName is the file at the root of a bundle that records how its files are installed. It's
+// written at build time and embedded along with the files.
+const FilesManifestName = "bundle.manifest.json"
+
+// FilesManifest records how the files of a bundle are installed.
+type FilesManifest struct {
+	// Permissions of the included files, by path, in octal such as `0755`. Other files get 0644.
+	Modes map[string]string `json:"modes"`
+	// SHA-256 hashes of the included files, by path, which tell whether an extracted file was changed.
+	Hashes map[string]string `json:"hashes,omitempty"`
+	// The files included by each command, by command path such as `db:migrate`, with an empty path for the
+	// root command. Bundles with commands only extract a command's files when it runs, and extract
+	// everything at once otherwise.
+	Commands map[string][]string `json:"commands"`
+	// The archive that holds the included files of bundles built with compression, which are left out of
+	// the bundle itself
+	Archive string `json:"archive,omitempty"`
+	// Sizes of the files in the archive, by path, which can be told without decompressing it
+	Sizes map[string]int64 `json:"sizes,omitempty"`
+}
+
+// ReadFilesManifest returns the files manifest of a bundle, or an empty one for bundles built without it.
+func ReadFilesManifest(fsys fs.FS) (*FilesManifest, error) {
+	manifest := &FilesManifest{Modes: map[string]string{}}
+
+	content, err := fs.ReadFile(fsys, FilesManifestName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", FilesManifestName, err)
+	}
+	return manifest, nil
+}
+
+// Mode returns the permissions a file of the bundle is installed with.
+func (manifest *FilesManifest) Mode(path string) (fs.FileMode, error) {
+	mode, ok := manifest.Modes[path]
+	if !ok {
+		return 0644, nil
+	}
+
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %q of %s", mode, path)
+	}
+	return fs.FileMode(perm).Perm(), nil
+}
+
+// CommandFiles returns the files a command needs, which are its own and those of the commands it's nested in,
+// since their hooks run along with it and their files are found next to its own.
+func (manifest *FilesManifest) CommandFiles(commandPath string) []string {
+	files := []string{}
+	seen := map[string]bool{}
+	add := func(path string) {
+		for _, file := range manifest.Commands[path] {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	add("")
+	if commandPath != "" {
+		parts := strings.Split(commandPath, ":")
+		for i := range parts {
+			add(strings.Join(parts[:i+1], ":"))
+		}
+	}
+
+	return files
+}
+
+// allFiles returns every file the commands of the bundle include, each once.
+func (manifest *FilesManifest) allFiles() []string {
+	seen := map[string]bool{}
+	for _, files := range manifest.Commands {
+		for _, file := range files {
+			seen[file] = true
+		}
+	}
+
+	files := make([]string, 0, len(seen))
+	for file := range seen {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// BundleManifest records a version of the bundle that was extracted into the data directory.
+type BundleManifest struct {
+	Version string            `json:"version"`
+	Hash    string            `json:"hash"`
+	Files   []string          `json:"files"`
+	Time    time.Time         `json:"created_at"`
+	Meta    map[string]string `json:"meta"`
+}
+
+// HashBundle returns a short hash of the files of a bundle, which tells apart builds of the same version. Like
+// `go:embed`, it skips files whose names start with a dot or an underscore.
+func HashBundle(fsys fs.FS) (string, error) {
+	hash := sha256.New()
+
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != "." && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "_")) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", path, len(content))
+		hash.Write(content)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash bundle: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
+
+var unsafeVersionChars = regexp.MustCompile(`[^A-Za-z0-9._+-]`)
+
+// BundleDir returns the directory the bundle of a version is extracted into, such as
+// `~/.local/share/cmdeagle/mycli/1.2.0-3f9a0c1d2e4b`.
+func BundleDir(appDataDir string, version string, hash string) string {
+	name := unsafeVersionChars.ReplaceAllString(version, "_")
+	if name == "" {
+		name = "dev"
+	}
+	if hash != "" {
+		name += "-" + hash
+	}
+
+	return filepath.Join(appDataDir, name)
+}
+
+// InstallBundle makes sure the bundle of this version of the CLI is extracted into its version directory, and
+// returns the directory. A version that's already there is used as it is. Otherwise the bundle is
+// extracted into a temporary directory first and renamed once complete, so a CLI that's interrupted, or
+// another one running at the same time, never sees a partial bundle. CLIs starting at the same time take
+// turns through a lock on the data directory, and the ones that waited use the bundle extracted first. Bundles that list the files of their
+// commands only get the directory here, and each command's files are extracted by ExtractCommandFiles.
+// Old versions are removed afterwards.
+func InstallBundle(fsys fs.FS, appDataDir string, version string, hash string, meta map[string]string) (string, error) {
+	dir := BundleDir(appDataDir, version, hash)
+
+	if !isInstalled(dir, hash) {
+		if err := os.MkdirAll(appDataDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create data directory: %w", err)
+		}
+
+		release, err := acquireLock(filepath.Join(appDataDir, LockFileName))
+		if err != nil {
+			return "", err
+		}
+		// Another CLI may have extracted the bundle while this one waited for the lock
+		if !isInstalled(dir, hash) {
+			log.Debug("Extracting bundle", "dir", dir)
+			err = extract(fsys, appDataDir, dir, BundleManifest{Version: version, Hash: hash, Meta: meta})
+		}
+		release()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Using a version keeps it from being collected while it's among the most recent ones
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(dir, ManifestFileName), now, now); err != nil {
+		log.Debug("Failed to record the use of the bundle", "dir", dir, "error", err)
+	}
+
+	if err := setCurrent(appDataDir, filepath.Base(dir)); err != nil {
+		log.Debug("Failed to record the current version of the bundle", "error", err)
+	}
+
+	collect(appDataDir, dir)
+
+	return dir, nil
+}
+
+func isInstalled(dir string, hash string) bool {
+	manifest, err := readManifest(dir)
+	return err == nil && manifest.Hash == hash
+}
+
+func readManifest(dir string) (*BundleManifest, error) {
+	content, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BundleManifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest in %s: %w", dir, err)
+	}
+	return manifest, nil
+}
+
+func extract(fsys fs.FS, appDataDir string, dir string, manifest BundleManifest) error {
+	tempDir, err := os.MkdirTemp(appDataDir, extractionPrefix+filepath.Base(dir)+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+	// Temporary directories are only accessible to the user, unlike the bundle
+	if err := os.Chmod(tempDir, 0755); err != nil {
+		return fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+
+	files, err := ReadFilesManifest(fsys)
+	if err != nil {
+		return err
+	}
+
+	// Extracted files get the time of the extraction, so one with another time was changed since
+	manifest.Time = time.Now().Truncate(time.Second)
+
+	// Commands extract their own files when they run
+	if files.Commands != nil {
+		manifest.Files = files.allFiles()
+		return finishExtraction(tempDir, dir, manifest)
+	}
+
+	manifest.Files = []string{}
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == "." {
+			return nil
+		}
+
+		targetPath := filepath.Join(tempDir, filepath.FromSlash(path))
+		if d.IsDir() {
+			if err := os.MkdirAll(targetPath, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", targetPath, err)
+			}
+			return nil
+		}
+
+		mode, err := files.Mode(path)
+		if err != nil {
+			return err
+		}
+		if err := extractFile(fsys, files, tempDir, path, mode, manifest.Time); err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy embedded files: %w", err)
+	}
+
+	return finishExtraction(tempDir, dir, manifest)
+}
+
+// finishExtraction writes the manifest into the temporary directory and moves it into place.
+func finishExtraction(tempDir string, dir string, manifest BundleManifest) error {
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, ManifestFileName), manifestData, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := os.Rename(tempDir, dir); err != nil {
+		// Another CLI may have extracted the same version in the meantime
+		if isInstalled(dir, manifest.Hash) {
+			return nil
+		}
+
+		// Or a directory without a manifest was left behind, which is replaced
+		if _, statErr := os.Stat(dir); statErr == nil {
+			if err := os.RemoveAll(dir); err != nil {
+				return fmt.Errorf("failed to remove incomplete bundle %s: %w", dir, err)
+			}
+			err = os.Rename(tempDir, dir)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to move bundle into place: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ExtractCommandFiles extracts the files a command needs into the version directory of the bundle, unless
+// they're there already, which is the case for the files shared with commands that ran before. Like
+// InstallBundle, it holds the lock on the data directory while it extracts, and each file is written next
+// to its path first and renamed once complete, so a CLI that's interrupted never leaves a partial file.
+func ExtractCommandFiles(fsys fs.FS, dir string, commandPath string) error {
+	files, err := ReadFilesManifest(fsys)
+	if err != nil {
+		return err
+	}
+	if files.Commands == nil {
+		// The whole bundle was extracted already
+		return nil
+	}
+
+	missing := missingFiles(dir, files.CommandFiles(commandPath))
+	if len(missing) == 0 {
+		return nil
+	}
+
+	release, err := acquireLock(filepath.Join(filepath.Dir(dir), LockFileName))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Only what another CLI didn't extract while this one waited for the lock
+	return extractFiles(fsys, dir, files, missingFiles(dir, missing))
+}
+
+// extractFiles extracts files of the bundle into its version directory, over the ones that are there.
+func extractFiles(fsys fs.FS, dir string, files *FilesManifest, paths []string) error {
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read the manifest of %s: %w", dir, err)
+	}
+
+	if archive, ok := fsys.(*archiveFS); ok {
+		log.Debug("Extracting files from the archive", "dir", dir, "paths", paths)
+		if paths, err = archive.extractFiles(dir, paths, manifest.Time); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range paths {
+		mode, err := files.Mode(path)
+		if err != nil {
+			return err
+		}
+		log.Debug("Extracting file", "dir", dir, "path", path)
+		if err := extractFile(fsys, files, dir, path, mode, manifest.Time); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func missingFiles(dir string, paths []string) []string {
+	missing := []string{}
+	for _, path := range paths {
+		if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(path))); err != nil {
+			missing = append(missing, path)
+		}
+	}
+	return missing
+}
+
+func extractFile(fsys fs.FS, files *FilesManifest, dir string, path string, mode fs.FileMode, modTime time.Time) error {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return fmt.Errorf("failed to read embedded file %s: %w", path, err)
+	}
+	return writeFile(filepath.Join(dir, filepath.FromSlash(path)), bytes.NewReader(data), mode, modTime)
+}
+
+// writeFile writes a file next to its path first and renames it once complete.
+func writeFile(targetPath string, content io.Reader, mode fs.FileMode, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", targetPath, err)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(targetPath), extractionPrefix+filepath.Base(targetPath)+"-")
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", targetPath, err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = io.Copy(temp, content)
+	if err == nil {
+		err = temp.Chmod(mode)
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(temp.Name(), modTime, modTime)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), targetPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", targetPath, err)
+	}
+	return nil
+}
+
+// setCurrent points the data directory at a version directory, by writing its name to a file next to it.
+// Unlike a symlink, this works the same on every OS.
+func setCurrent(appDataDir string, name string) error {
+	path := filepath.Join(appDataDir, CurrentFileName)
+	if current, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(current)) == name {
+		return nil
+	}
+
+	temp, err := os.CreateTemp(appDataDir, "."+CurrentFileName+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.WriteString(name + "\n")
+	if err == nil {
+		err = temp.Chmod(0644)
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+// collect removes the versions that weren't among the most recently used ones, the files of the bundle
+// extracted by CLIs from before versions had their own directory, and extractions that were interrupted.
+// Failing to remove something only means it's tried again next time.
+func collect(appDataDir string, keep string) {
+	// Collecting can wait for the next time when another CLI is extracting
+	release, err := tryAcquireLock(filepath.Join(appDataDir, LockFileName))
+	if err != nil {
+		log.Debug("Skipping removal of old bundles", "error", err)
+		return
+	}
+	defer release()
+
+	entries, err := os.ReadDir(appDataDir)
+	if err != nil {
+		log.Debug("Failed to list data directory", "error", err)
+		return
+	}
+
+	type version struct {
+		dir     string
+		usedAt  time.Time
+		current bool
+	}
+	versions := []version{}
+
+	for _, entry := range entries {
+		path := filepath.Join(appDataDir, entry.Name())
+		if !entry.IsDir() {
+			continue
+		}
+
+		if strings.HasPrefix(entry.Name(), extractionPrefix) {
+			if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > staleExtractionAge {
+				removeVersion(path)
+			}
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(path, ManifestFileName))
+		if err != nil {
+			// Not a version directory
+			continue
+		}
+		versions = append(versions, version{dir: path, usedAt: info.ModTime(), current: path == keep})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].current != versions[j].current {
+			return versions[i].current
+		}
+		return versions[i].usedAt.After(versions[j].usedAt)
+	})
+	for i := keepVersions; i < len(versions); i++ {
+		removeVersion(versions[i].dir)
+	}
+
+	removeLegacyBundle(appDataDir)
+}
+
+func removeVersion(dir string) {
+	log.Debug("Removing old bundle", "dir", dir)
+	if err := os.RemoveAll(dir); err != nil {
+		log.Debug("Failed to remove old bundle", "dir", dir, "error", err)
+	}
+}
+
+// removeLegacyBundle removes the files that CLIs used to extract right into the data directory, as listed
+// by the manifest they left there.
+func removeLegacyBundle(appDataDir string) {
+	manifest, err := readManifest(appDataDir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Debug("Failed to read legacy manifest", "error", err)
+		}
+		return
+	}
+
+	log.Debug("Removing bundle extracted by an older version", "dir", appDataDir)
+	dirs := map[string]bool{}
+	for _, path := range manifest.Files {
+		path = filepath.Join(appDataDir, filepath.FromSlash(path))
+		// Only what's inside the data directory is ever removed
+		if rel, err := filepath.Rel(appDataDir, path); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		os.Remove(path)
+		for dir := filepath.Dir(path); dir != appDataDir && !dirs[dir]; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	// Directories are removed deepest first, and only once they're empty
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, dir := range sorted {
+		os.Remove(dir)
+	}
+
+	os.Remove(filepath.Join(appDataDir, ManifestFileName))
+}
@@ -0,0 +1,218 @@
+package executable
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBundle(content string) fstest.MapFS {
+	return fstest.MapFS{
+		"config.cmd.yaml":   {Data: []byte("name: mycli\n")},
+		"scripts/greet.sh":  {Data: []byte(content)},
+		"scripts/.hidden":   {Data: []byte("not embedded")},
+		"_build/output.txt": {Data: []byte("not embedded")},
+	}
+}
+
+func readCurrent(t *testing.T, appDataDir string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join(appDataDir, CurrentFileName))
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestHashBundle(t *testing.T) {
+	hash, err := HashBundle(testBundle("echo hi"))
+	require.NoError(t, err)
+	assert.Len(t, hash, 12)
+
+	same, err := HashBundle(testBundle("echo hi"))
+	require.NoError(t, err)
+	assert.Equal(t, hash, same)
+
+	changed, err := HashBundle(testBundle("echo bye"))
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, changed)
+
+	// Files that go:embed skips don't count
+	ignored := testBundle("echo hi")
+	ignored["scripts/.hidden"] = &fstest.MapFile{Data: []byte("changed")}
+	ignored["_build/output.txt"] = &fstest.MapFile{Data: []byte("changed")}
+	withIgnored, err := HashBundle(ignored)
+	require.NoError(t, err)
+	assert.Equal(t, hash, withIgnored)
+}
+
+func TestBundleDir(t *testing.T) {
+	assert.Equal(t, filepath.Join("data", "1.2.0-abc"), BundleDir("data", "1.2.0", "abc"))
+	assert.Equal(t, filepath.Join("data", "1.2.0_beta-abc"), BundleDir("data", "1.2.0/beta", "abc"))
+	assert.Equal(t, filepath.Join("data", "dev-abc"), BundleDir("data", "", "abc"))
+}
+
+func TestInstallBundle(t *testing.T) {
+	appDataDir := t.TempDir()
+
+	dir, err := InstallBundle(testBundle("echo v1"), appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(appDataDir, "1.0.0-aaa"), dir)
+	assert.FileExists(t, filepath.Join(dir, "scripts", "greet.sh"))
+	assert.FileExists(t, filepath.Join(dir, ManifestFileName))
+	assert.Equal(t, "1.0.0-aaa\n", readCurrent(t, appDataDir))
+
+	// Files changed by hand are kept as long as the bundle is the same
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "scripts", "greet.sh"), []byte("edited"), 0644))
+	_, err = InstallBundle(testBundle("echo v1"), appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(dir, "scripts", "greet.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "edited", string(content))
+
+	// A different bundle of the same version gets its own directory, and the first one is kept
+	next, err := InstallBundle(testBundle("echo v2"), appDataDir, "1.0.0", "bbb", nil)
+	require.NoError(t, err)
+	content, err = os.ReadFile(filepath.Join(next, "scripts", "greet.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "echo v2", string(content))
+	assert.DirExists(t, dir)
+	assert.Equal(t, "1.0.0-bbb\n", readCurrent(t, appDataDir))
+
+	entries, err := os.ReadDir(appDataDir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"1.0.0-aaa", "1.0.0-bbb", CurrentFileName, LockFileName}, names)
+}
+
+func TestInstallBundleCollectsOldVersions(t *testing.T) {
+	appDataDir := t.TempDir()
+
+	// Each version is used a minute after the one before
+	start := time.Now().Add(-time.Hour)
+	hashes := []string{"aaa", "bbb", "ccc", "ddd", "eee"}
+	for i, hash := range hashes {
+		dir, err := InstallBundle(testBundle("echo "+hash), appDataDir, "1.0.0", hash, nil)
+		require.NoError(t, err)
+		usedAt := start.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(filepath.Join(dir, ManifestFileName), usedAt, usedAt))
+	}
+
+	// Running an older version again keeps it around
+	_, err := InstallBundle(testBundle("echo aaa"), appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+
+	for _, hash := range []string{"aaa", "ddd", "eee"} {
+		assert.DirExists(t, filepath.Join(appDataDir, "1.0.0-"+hash))
+	}
+	for _, hash := range []string{"bbb", "ccc"} {
+		assert.NoDirExists(t, filepath.Join(appDataDir, "1.0.0-"+hash))
+	}
+}
+
+func TestInstallBundleRemovesLegacyBundle(t *testing.T) {
+	appDataDir := t.TempDir()
+
+	// Older CLIs extracted their bundle right into the data directory
+	require.NoError(t, os.MkdirAll(filepath.Join(appDataDir, "scripts"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(appDataDir, "scripts", "old.sh"), []byte("old"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(appDataDir, "user.db"), []byte("kept"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(appDataDir, ManifestFileName),
+		[]byte(`{"files": ["scripts/old.sh", "../outside"], "created_at": "2024-01-01T00:00:00Z"}`), 0644))
+
+	_, err := InstallBundle(testBundle("echo hi"), appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, filepath.Join(appDataDir, ManifestFileName))
+	assert.NoDirExists(t, filepath.Join(appDataDir, "scripts"))
+	assert.FileExists(t, filepath.Join(appDataDir, "user.db"))
+}
+
+func TestInstallBundleRestoresModes(t *testing.T) {
+	appDataDir := t.TempDir()
+
+	bundle := testBundle("echo hi")
+	bundle[FilesManifestName] = &fstest.MapFile{Data: []byte(`{"modes": {"scripts/greet.sh": "0755"}}`)}
+
+	dir, err := InstallBundle(bundle, appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+
+	info, err := os.Stat(filepath.Join(dir, "scripts", "greet.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// Files missing from the manifest get the default mode
+	info, err = os.Stat(filepath.Join(dir, "config.cmd.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+func TestExtractCommandFiles(t *testing.T) {
+	appDataDir := t.TempDir()
+
+	bundle := fstest.MapFS{
+		"config.cmd.yaml":        {Data: []byte("name: mycli\n")},
+		"shared.sh":              {Data: []byte("echo shared")},
+		"db/schema.sql":          {Data: []byte("create table t;")},
+		"db/migrate/run.sh":      {Data: []byte("echo migrate")},
+		"assets/large.bin":       {Data: []byte("large")},
+		"assets/more/large2.bin": {Data: []byte("large")},
+		FilesManifestName: {Data: []byte(`{
+			"modes": {"db/migrate/run.sh": "0755"},
+			"commands": {
+				"": ["shared.sh"],
+				"db": ["db/schema.sql"],
+				"db:migrate": ["db/migrate/run.sh", "shared.sh"],
+				"assets": ["assets/large.bin", "assets/more/large2.bin"]
+			}
+		}`)},
+	}
+
+	// Only the version directory is created up front
+	dir, err := InstallBundle(bundle, appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "shared.sh"))
+	assert.NoFileExists(t, filepath.Join(dir, "config.cmd.yaml"))
+	manifest, err := readManifest(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"assets/large.bin", "assets/more/large2.bin", "db/migrate/run.sh", "db/schema.sql", "shared.sh"}, manifest.Files)
+
+	// A command gets its own files and those of the commands it's nested in
+	require.NoError(t, ExtractCommandFiles(bundle, dir, "db:migrate"))
+	assert.FileExists(t, filepath.Join(dir, "shared.sh"))
+	assert.FileExists(t, filepath.Join(dir, "db", "schema.sql"))
+	assert.FileExists(t, filepath.Join(dir, "db", "migrate", "run.sh"))
+	assert.NoDirExists(t, filepath.Join(dir, "assets"))
+
+	info, err := os.Stat(filepath.Join(dir, "db", "migrate", "run.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// Files that are there already aren't extracted again
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shared.sh"), []byte("edited"), 0644))
+	require.NoError(t, ExtractCommandFiles(bundle, dir, "assets"))
+	content, err := os.ReadFile(filepath.Join(dir, "shared.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "edited", string(content))
+	assert.FileExists(t, filepath.Join(dir, "assets", "more", "large2.bin"))
+}
+
+func TestCommandFiles(t *testing.T) {
+	manifest := &FilesManifest{Commands: map[string][]string{
+		"":       {"a", "b"},
+		"db":     {"b", "c"},
+		"db:run": {"d"},
+		"dbx":    {"e"},
+	}}
+
+	assert.Equal(t, []string{"a", "b"}, manifest.CommandFiles(""))
+	assert.Equal(t, []string{"a", "b", "c", "d"}, manifest.CommandFiles("db:run"))
+	assert.Equal(t, []string{"a", "b", "e"}, manifest.CommandFiles("dbx"))
+}
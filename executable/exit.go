@@ -0,0 +1,83 @@
+package executable
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// Exit codes used by generated CLIs when the failure comes from cmdeagle itself rather than from a script.
+// Scripts' own exit codes are passed through unchanged. The values follow the BSD sysexits.h conventions so
+// they are unlikely to clash with the codes scripts commonly use.
+const (
+	ExitCodeOK    = 0
+	ExitCodeError = 1
+	// Invalid arguments or flags, or an unknown command
+	ExitCodeUsage = 64
+	// The command's `validate` script rejected the input
+	ExitCodeValidation = 65
+	// A dependency declared in `requires` is missing or has an incompatible version
+	ExitCodeMissingRequirement = 69
+	// The CLI itself is broken, e.g. its embedded configuration or bundle can't be loaded
+	ExitCodeInternal = 70
+	// The script ran longer than its `timeout`, the same code GNU timeout uses
+	ExitCodeTimeout = 124
+	// Added to the signal number when a script is terminated by a signal, as shells do
+	ExitCodeSignalBase = 128
+)
+
+// ExitError carries the exit code the CLI should terminate with.
+type ExitError struct {
+	Code int
+	Err  error
+	// Silent errors have already been reported, e.g. by the script's own output, and are not printed again.
+	Silent bool
+	// The CLI received a signal while the script was running, e.g. because the user pressed Ctrl-C
+	Interrupted bool
+}
+
+func NewExitError(code int, err error) *ExitError {
+	return &ExitError{Code: code, Err: err}
+}
+
+func (err *ExitError) Error() string {
+	if err.Err == nil {
+		return fmt.Sprintf("exit status %d", err.Code)
+	}
+	return err.Err.Error()
+}
+
+func (err *ExitError) Unwrap() error {
+	return err.Err
+}
+
+// GetExitCode determines the exit code for an error returned while running a command.
+func GetExitCode(err error) int {
+	if err == nil {
+		return ExitCodeOK
+	}
+
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+
+	var processErr *exec.ExitError
+	if errors.As(err, &processErr) {
+		return getProcessExitCode(processErr)
+	}
+
+	return ExitCodeError
+}
+
+// IsInterrupted reports whether the script failed after the CLI forwarded a signal to it.
+func IsInterrupted(err error) bool {
+	var exitErr *ExitError
+	return errors.As(err, &exitErr) && exitErr.Interrupted
+}
+
+// IsSilent reports whether the error has already been reported to the user.
+func IsSilent(err error) bool {
+	var exitErr *ExitError
+	return errors.As(err, &exitErr) && exitErr.Silent
+}
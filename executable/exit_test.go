@@ -0,0 +1,29 @@
+package executable
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetExitCode(t *testing.T) {
+	assert.Equal(t, ExitCodeOK, GetExitCode(nil))
+	assert.Equal(t, ExitCodeError, GetExitCode(errors.New("failed")))
+	assert.Equal(t, ExitCodeUsage, GetExitCode(NewExitError(ExitCodeUsage, errors.New("unknown flag"))))
+
+	// Wrapped exit errors keep their code
+	wrapped := fmt.Errorf("hook before: %w", &ExitError{Code: 42, Silent: true, Interrupted: true})
+	assert.Equal(t, 42, GetExitCode(wrapped))
+	assert.True(t, IsSilent(wrapped))
+	assert.True(t, IsInterrupted(wrapped))
+
+	assert.False(t, IsSilent(errors.New("failed")))
+	assert.False(t, IsInterrupted(NewExitError(ExitCodeError, nil)))
+}
+
+func TestExitErrorMessage(t *testing.T) {
+	assert.Equal(t, "exit status 3", (&ExitError{Code: 3}).Error())
+	assert.Equal(t, "timed out", NewExitError(ExitCodeTimeout, errors.New("timed out")).Error())
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+
+package executable
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ExecReplacesProcess reports whether Exec replaces the CLI's process, in which case nothing the CLI
+// would clean up once the command is done gets cleaned up.
+const ExecReplacesProcess = true
+
+// minInheritedFd is the lowest descriptor that files scripts inherit get, which keeps them clear of the
+// ones os/exec sets up for scripts, like the control channel's.
+const minInheritedFd = 100
+
+// WriteInheritedFile writes content to a file that has no name on disk, and returns a path like
+// `/dev/fd/5` that the CLI's scripts can read it through, including the one Exec replaces the CLI with.
+// The file only exists as long as a process has it open, so it's never left behind.
+func WriteInheritedFile(name string, content []byte) (string, error) {
+	// os.CreateTemp creates files with the 0600 mode
+	file, err := os.CreateTemp("", "cmdeagle-"+name+"-*.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s file: %w", name, err)
+	}
+	defer file.Close()
+	os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		return "", fmt.Errorf("failed to write %s file: %w", name, err)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", fmt.Errorf("failed to write %s file: %w", name, err)
+	}
+
+	fd, err := inheritFd(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to share %s file: %w", name, err)
+	}
+	return fmt.Sprintf("/dev/fd/%d", fd), nil
+}
+
+// inheritFd duplicates the descriptor of a file into one that scripts inherit, which stays open for as long
+// as the CLI runs. Go opens files with close-on-exec, which would close them before scripts could use them.
+func inheritFd(file *os.File) (int, error) {
+	return unix.FcntlInt(file.Fd(), unix.F_DUPFD, minInheritedFd)
+}
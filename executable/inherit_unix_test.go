@@ -0,0 +1,31 @@
+//go:build !windows
+
+package executable
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteInheritedFile(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	path, err := WriteInheritedFile("secrets", []byte(`{"flags":{"token":"s3cret"}}`))
+	require.NoError(t, err)
+	assert.Regexp(t, `^/dev/fd/1\d\d$`, path)
+
+	// Nothing is left on disk
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Scripts read it through the descriptor they inherit
+	output, err := exec.Command("sh", "-c", `cat "$0"`, path).Output()
+	require.NoError(t, err)
+	assert.Equal(t, `{"flags":{"token":"s3cret"}}`, string(output))
+}
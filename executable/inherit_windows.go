@@ -0,0 +1,15 @@
+//go:build windows
+
+package executable
+
+import "fmt"
+
+// ExecReplacesProcess reports whether Exec replaces the CLI's process, in which case nothing the CLI
+// would clean up once the command is done gets cleaned up.
+const ExecReplacesProcess = false
+
+// WriteInheritedFile isn't supported on Windows, where Exec runs the command as a child process and the
+// CLI cleans up after it as usual.
+func WriteInheritedFile(name string, content []byte) (string, error) {
+	return "", fmt.Errorf("failed to create %s file: not supported on Windows", name)
+}
@@ -0,0 +1,45 @@
+package executable
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// LockFileName is the file in the data directory that CLIs lock while they extract their bundle, so that
+// CLIs starting at the same time wait for each other and reuse what the first one extracted.
+const LockFileName = ".lock"
+
+// errLocked is returned by tryLockFile when another process holds the lock.
+var errLocked = errors.New("locked by another process")
+
+// acquireLock waits until it holds the lock on the file at path, which is created if needed, and returns a
+// function that releases it. The lock is advisory, so it only keeps out other CLIs that take it as well.
+func acquireLock(path string) (func(), error) {
+	return openLock(path, lockFile)
+}
+
+// tryAcquireLock is like acquireLock, but fails with errLocked instead of waiting.
+func tryAcquireLock(path string) (func(), error) {
+	return openLock(path, tryLockFile)
+}
+
+func openLock(path string, lock func(file *os.File) error) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := lock(file); err != nil {
+		file.Close()
+		if errors.Is(err, errLocked) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	return func() {
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
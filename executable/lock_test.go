@@ -0,0 +1,236 @@
+package executable
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFS counts how many times the files of a bundle are read or opened, to tell how often it was
+// extracted.
+type countingFS struct {
+	fstest.MapFS
+	reads map[string]*atomic.Int32
+}
+
+func newCountingFS(bundle fstest.MapFS) *countingFS {
+	reads := map[string]*atomic.Int32{}
+	for path := range bundle {
+		reads[path] = &atomic.Int32{}
+	}
+	return &countingFS{MapFS: bundle, reads: reads}
+}
+
+func (fsys *countingFS) ReadFile(name string) ([]byte, error) {
+	if count, ok := fsys.reads[name]; ok {
+		count.Add(1)
+	}
+	return fsys.MapFS.ReadFile(name)
+}
+
+func (fsys *countingFS) Open(name string) (fs.File, error) {
+	if count, ok := fsys.reads[name]; ok {
+		count.Add(1)
+	}
+	return fsys.MapFS.Open(name)
+}
+
+// largeBundle has enough files that extractions running at the same time overlap.
+func largeBundle(manifest string) fstest.MapFS {
+	bundle := fstest.MapFS{}
+	for i := 0; i < 200; i++ {
+		bundle[fmt.Sprintf("assets/%03d.txt", i)] = &fstest.MapFile{Data: []byte(strings.Repeat("x", 4096))}
+	}
+	if manifest != "" {
+		bundle[FilesManifestName] = &fstest.MapFile{Data: []byte(manifest)}
+	}
+	return bundle
+}
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockFileName)
+
+	release, err := acquireLock(path)
+	require.NoError(t, err)
+
+	_, err = tryAcquireLock(path)
+	assert.ErrorIs(t, err, errLocked)
+
+	release()
+	release, err = tryAcquireLock(path)
+	require.NoError(t, err)
+	release()
+}
+
+// TestLockHelperProcess isn't a test of its own. The tests below run the test binary with it, so the lock is
+// taken by separate processes, like CLIs starting at the same time.
+func TestLockHelperProcess(t *testing.T) {
+	switch os.Getenv("CMDEAGLE_TEST_LOCK") {
+	case "try":
+		_, err := tryAcquireLock(os.Getenv("CMDEAGLE_TEST_LOCK_PATH"))
+		if errors.Is(err, errLocked) {
+			os.Exit(3)
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "install":
+		// Starts once stdin is closed, at the same time as the other processes
+		io.ReadAll(os.Stdin)
+		bundle := newCountingFS(largeBundle(""))
+		if _, err := InstallBundle(bundle, os.Getenv("CMDEAGLE_TEST_LOCK_PATH"), "1.0.0", "aaa", nil); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// Tells whether this process extracted the bundle
+		fmt.Print(bundle.reads["assets/000.txt"].Load())
+		os.Exit(0)
+	default:
+		t.Skip("only run by the tests of the lock")
+	}
+}
+
+// lockHelperCmd runs TestLockHelperProcess in a process of its own.
+func lockHelperCmd(mode string, path string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+	cmd.Env = append(os.Environ(), "CMDEAGLE_TEST_LOCK="+mode, "CMDEAGLE_TEST_LOCK_PATH="+path)
+	return cmd
+}
+
+func TestLockKeepsOutOtherProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockFileName)
+
+	release, err := acquireLock(path)
+	require.NoError(t, err)
+	err = lockHelperCmd("try", path).Run()
+	assert.Equal(t, 3, GetExitCode(err), "another process took the lock")
+
+	release()
+	assert.NoError(t, lockHelperCmd("try", path).Run())
+}
+
+func TestInstallBundleFromProcesses(t *testing.T) {
+	appDataDir := t.TempDir()
+
+	cmds := make([]*exec.Cmd, 8)
+	outputs := make([]strings.Builder, len(cmds))
+	starts := make([]io.WriteCloser, len(cmds))
+	for i := range cmds {
+		cmds[i] = lockHelperCmd("install", appDataDir)
+		cmds[i].Stdout = &outputs[i]
+		cmds[i].Stderr = os.Stderr
+
+		var err error
+		starts[i], err = cmds[i].StdinPipe()
+		require.NoError(t, err)
+		require.NoError(t, cmds[i].Start())
+	}
+	for _, start := range starts {
+		start.Close()
+	}
+
+	extractions := 0
+	for i, cmd := range cmds {
+		require.NoError(t, cmd.Wait())
+		reads, err := strconv.Atoi(outputs[i].String())
+		require.NoError(t, err)
+		extractions += reads
+	}
+
+	// One of the processes extracted the bundle, and the others used what it extracted
+	assert.Equal(t, 1, extractions)
+	leftovers, err := filepath.Glob(filepath.Join(appDataDir, extractionPrefix+"*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
+
+func TestInstallBundleConcurrently(t *testing.T) {
+	appDataDir := t.TempDir()
+	bundle := newCountingFS(largeBundle(""))
+
+	var wg sync.WaitGroup
+	dirs := make([]string, 20)
+	errs := make([]error, 20)
+	for i := range dirs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dirs[i], errs[i] = InstallBundle(bundle, appDataDir, "1.0.0", "aaa", nil)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range dirs {
+		require.NoError(t, errs[i])
+		assert.Equal(t, filepath.Join(appDataDir, "1.0.0-aaa"), dirs[i])
+	}
+
+	// The bundle was extracted once, and completely
+	assert.Equal(t, int32(1), bundle.reads["assets/000.txt"].Load())
+	for path, file := range bundle.MapFS {
+		content, err := os.ReadFile(filepath.Join(dirs[0], filepath.FromSlash(path)))
+		require.NoError(t, err)
+		assert.Equal(t, file.Data, content)
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(appDataDir, extractionPrefix+"*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
+
+func TestExtractCommandFilesConcurrently(t *testing.T) {
+	appDataDir := t.TempDir()
+
+	files := []string{}
+	for i := 0; i < 200; i++ {
+		files = append(files, fmt.Sprintf("%q", fmt.Sprintf("assets/%03d.txt", i)))
+	}
+	bundle := newCountingFS(largeBundle(`{"modes": {}, "commands": {"assets": [` + strings.Join(files, ",") + `]}}`))
+
+	dir, err := InstallBundle(bundle, appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = ExtractCommandFiles(bundle, dir, "assets")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	// Each file was extracted once, and completely
+	for path, file := range bundle.MapFS {
+		if path == FilesManifestName {
+			continue
+		}
+		assert.Equal(t, int32(1), bundle.reads[path].Load(), path)
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+		require.NoError(t, err)
+		assert.Equal(t, file.Data, content)
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(dir, "assets", extractionPrefix+"*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package executable
+
+import "golang.org/x/sys/unix"
+
+// isNoExec reports whether the filesystem of a directory is mounted with `noexec`.
+func isNoExec(dir string) bool {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return false
+	}
+	return stat.Flags&unix.ST_NOEXEC != 0
+}
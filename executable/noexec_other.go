@@ -0,0 +1,9 @@
+//go:build !linux
+
+package executable
+
+// isNoExec reports whether the filesystem of a directory is mounted with `noexec`, which is only checked on
+// Linux.
+func isNoExec(dir string) bool {
+	return false
+}
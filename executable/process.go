@@ -0,0 +1,191 @@
+package executable
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/migsc/cmdeagle/control"
+)
+
+// DefaultKillTimeout is how long a script gets to exit after a forwarded signal before it is killed.
+var DefaultKillTimeout = 10 * time.Second
+
+// RunOptions control how a script process is supervised.
+type RunOptions struct {
+	// How long to wait after forwarding a signal before escalating to SIGKILL. Zero disables escalation.
+	KillTimeout time.Duration
+	// Interactive scripts always get the terminal, even when the CLI's own stdin is redirected, and are
+	// never killed for ignoring a signal since editors and REPLs routinely do.
+	Interactive bool
+	// How long the script may run before it is stopped. Zero means no limit.
+	Timeout time.Duration
+	// Stops the script when closed, the same way as a timeout, e.g. when another step of the command failed
+	Cancel <-chan struct{}
+	// Handles the messages the script sends through CLI_CONTROL_FD. Without it, there's no control channel.
+	Control *control.Handler
+}
+
+// Run starts the command in its own process group and waits for it to finish. SIGINT, SIGTERM and SIGHUP
+// received in the meantime are forwarded to the whole group, so that anything the script spawned receives
+// them too. If the script is still running KillTimeout after the first forwarded signal, the group is
+// killed.
+//
+// When the script's stdin is the terminal and the CLI is running in the foreground, the script's process
+// group is made the terminal's foreground group for as long as it runs. This lets it read from the terminal
+// and receive Ctrl-C directly, the same way a shell runs a foreground job.
+//
+// When the script runs longer than Timeout, its group is sent SIGTERM, and killed KillTimeout later if it
+// is still running. Run then returns an ExitError with ExitCodeTimeout. Closing Cancel stops the script
+// the same way, and Run returns an interrupted ExitError.
+//
+// When the script fails, the returned error is a silent ExitError with the script's exact exit code, or
+// 128 plus the signal number if it was terminated by a signal.
+func Run(cmd *exec.Cmd, opts RunOptions) error {
+	if opts.Interactive {
+		if _, ok := foregroundTerminal(cmd.Stdin); !ok {
+			attachTerminal(cmd)
+		}
+	}
+
+	ttyFd, foreground := foregroundTerminal(cmd.Stdin)
+	setupProcessGroup(cmd, ttyFd, foreground)
+	if foreground {
+		defer restoreForeground(ttyFd)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	// The script may send messages before Start returns, but its process is only known afterwards
+	started := make(chan struct{})
+	if opts.Control != nil {
+		closeControl, err := control.Attach(cmd, opts.Control, func(fn func()) {
+			<-started
+			withTerminal(cmd, ttyFd, foreground, fn)
+		})
+		if err != nil {
+			return err
+		}
+		defer closeControl()
+	}
+
+	err := cmd.Start()
+	close(started)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var killTimer, timeoutTimer <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		timeoutTimer = timer.C
+	}
+
+	interrupted, timedOut, cancelled := false, false, false
+	cancel := opts.Cancel
+
+	stop := func() {
+		if opts.KillTimeout > 0 {
+			if err := terminateProcessGroup(cmd); err != nil {
+				log.Debug("Failed to terminate process group", "error", err)
+			}
+			if killTimer == nil {
+				killTimer = time.After(opts.KillTimeout)
+			}
+		} else if err := killProcessGroup(cmd); err != nil {
+			log.Debug("Failed to kill process group", "error", err)
+		}
+	}
+
+	for {
+		select {
+		case <-timeoutTimer:
+			timedOut = true
+			log.Warn("Script timed out, stopping it", "timeout", opts.Timeout)
+			stop()
+
+		case <-cancel:
+			// A closed channel is always ready, so stop listening once it has been handled
+			cancel = nil
+			cancelled = true
+			log.Debug("Script cancelled, stopping it", "pid", cmd.Process.Pid)
+			stop()
+
+		case sig := <-signals:
+			interrupted = true
+			log.Debug("Forwarding signal to script", "signal", sig, "pid", cmd.Process.Pid)
+			if err := signalProcessGroup(cmd, sig); err != nil {
+				log.Debug("Failed to forward signal", "signal", sig, "error", err)
+			}
+
+			if killTimer == nil && opts.KillTimeout > 0 && !opts.Interactive {
+				killTimer = time.After(opts.KillTimeout)
+			}
+
+		case <-killTimer:
+			log.Warn("Script did not exit after being signaled, killing it", "kill-timeout", opts.KillTimeout)
+			if err := killProcessGroup(cmd); err != nil {
+				log.Debug("Failed to kill process group", "error", err)
+			}
+
+		case err := <-done:
+			if timedOut {
+				return &ExitError{Code: ExitCodeTimeout, Err: fmt.Errorf("timed out after %s", opts.Timeout), Interrupted: interrupted}
+			}
+
+			err = toExitError(err)
+			if cancelled {
+				interrupted = true
+			}
+			if exitErr, ok := err.(*ExitError); ok {
+				exitErr.Interrupted = interrupted
+			}
+			return err
+		}
+	}
+}
+
+// Exec replaces the current process with the command, so the script runs without the CLI sitting in
+// between. It only returns if the process could not be replaced. On platforms that don't support it, the
+// command is run with Run instead.
+func Exec(cmd *exec.Cmd) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+
+	if cmd.Dir != "" {
+		if err := os.Chdir(cmd.Dir); err != nil {
+			return err
+		}
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	log.Debug("Replacing process with script", "path", cmd.Path, "args", cmd.Args)
+	return execProcess(cmd, env)
+}
+
+func toExitError(err error) error {
+	var processErr *exec.ExitError
+	if errors.As(err, &processErr) {
+		return &ExitError{Code: getProcessExitCode(processErr), Err: err, Silent: true}
+	}
+
+	return err
+}
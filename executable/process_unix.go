@@ -0,0 +1,140 @@
+//go:build !windows
+
+package executable
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/log"
+	"golang.org/x/sys/unix"
+)
+
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+
+func setupProcessGroup(cmd *exec.Cmd, ttyFd int, foreground bool) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	if foreground {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = ttyFd
+	}
+}
+
+// foregroundTerminal returns the descriptor of the terminal the given stdin is attached to, provided our
+// process group currently owns it. A CLI started in the background must not take the terminal away from
+// the shell.
+func foregroundTerminal(stdin io.Reader) (int, bool) {
+	file, ok := stdin.(*os.File)
+	if !ok {
+		return 0, false
+	}
+
+	fd := int(file.Fd())
+	pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil || pgrp != syscall.Getpgrp() {
+		return 0, false
+	}
+
+	return fd, true
+}
+
+// attachTerminal connects the command's standard streams to the controlling terminal wherever they aren't
+// already attached to one.
+func attachTerminal(cmd *exec.Cmd) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		log.Debug("No controlling terminal to attach the script to", "error", err)
+		return
+	}
+
+	if !isTerminal(cmd.Stdin) {
+		cmd.Stdin = tty
+	}
+	if !isTerminal(cmd.Stdout) {
+		cmd.Stdout = tty
+	}
+	if !isTerminal(cmd.Stderr) {
+		cmd.Stderr = tty
+	}
+}
+
+func isTerminal(stream any) bool {
+	file, ok := stream.(*os.File)
+	if !ok {
+		return false
+	}
+
+	// Only terminals have a foreground process group, anything else fails with ENOTTY
+	_, err := unix.IoctlGetInt(int(file.Fd()), unix.TIOCGPGRP)
+	return err == nil
+}
+
+// restoreForeground takes the terminal back once the script is done with it.
+func restoreForeground(ttyFd int) {
+	// We're a background process until this succeeds. The terminal only lets a background process take it
+	// while SIGTTOU is ignored, and would otherwise stop us, or fail if our process group is orphaned
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	if err := unix.IoctlSetPointerInt(ttyFd, unix.TIOCSPGRP, syscall.Getpgrp()); err != nil {
+		log.Debug("Failed to restore the terminal's foreground process group", "error", err)
+	}
+}
+
+// withTerminal runs fn while the CLI has the terminal, e.g. to prompt the user on behalf of the script,
+// and then hands the terminal back to the script.
+func withTerminal(cmd *exec.Cmd, ttyFd int, foreground bool, fn func()) {
+	if !foreground || cmd.Process == nil {
+		fn()
+		return
+	}
+
+	restoreForeground(ttyFd)
+	defer func() {
+		// The script's process group has the script's pid as its id
+		if err := unix.IoctlSetPointerInt(ttyFd, unix.TIOCSPGRP, cmd.Process.Pid); err != nil {
+			log.Debug("Failed to hand the terminal back to the script", "error", err)
+		}
+	}()
+
+	fn()
+}
+
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	// A negative pid addresses the whole process group, which has the script's pid as its id
+	return syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+}
+
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func getProcessExitCode(err *exec.ExitError) int {
+	if status, ok := err.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return ExitCodeSignalBase + int(status.Signal())
+	}
+
+	return err.ExitCode()
+}
+
+func execProcess(cmd *exec.Cmd, env []string) error {
+	return syscall.Exec(cmd.Path, cmd.Args, env)
+}
+
+// isProcessRunning reports whether a process with the given ID exists.
+func isProcessRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,216 @@
+//go:build !windows
+
+package executable
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptCmd runs script with `sh -c`, with DIR set to a directory of its own.
+func scriptCmd(t *testing.T, script string) (*exec.Cmd, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Env = append(os.Environ(), "DIR="+dir)
+	return cmd, dir
+}
+
+// waitForFile waits until the script creates a file, which tells the test it's ready, and reports
+// whether it did.
+func waitForFile(path string) bool {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// signalWhenReady sends a signal to the test process once the script is ready, which Run then forwards.
+func signalWhenReady(dir string, sig syscall.Signal) {
+	go func() {
+		if waitForFile(filepath.Join(dir, "ready")) {
+			syscall.Kill(os.Getpid(), sig)
+		}
+	}()
+}
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		code   int
+	}{
+		{"success", "exit 0", ExitCodeOK},
+		{"failure", "exit 3", 3},
+		{"highest code", "exit 255", 255},
+		{"terminated", "kill -TERM $$", ExitCodeSignalBase + int(syscall.SIGTERM)},
+		{"killed", "kill -KILL $$", ExitCodeSignalBase + int(syscall.SIGKILL)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, _ := scriptCmd(t, tt.script)
+
+			err := Run(cmd, RunOptions{})
+			assert.Equal(t, tt.code, GetExitCode(err))
+			if tt.code != ExitCodeOK {
+				// The script reported its failure already
+				assert.True(t, IsSilent(err))
+				assert.False(t, IsInterrupted(err))
+			}
+		})
+	}
+}
+
+func TestRunForwardsSignalsToProcessGroup(t *testing.T) {
+	// The script and the script it starts in the background both record the signal
+	cmd, dir := scriptCmd(t, `
+		trap 'echo script >> "$DIR/signals"; wait; exit 3' TERM
+		sh -c 'trap "echo child >> \"\$DIR/signals\"; exit 0" TERM; while :; do sleep 0.05; done' &
+		touch "$DIR/ready"
+		wait
+	`)
+	signalWhenReady(dir, syscall.SIGTERM)
+
+	err := Run(cmd, RunOptions{KillTimeout: 5 * time.Second})
+	assert.Equal(t, 3, GetExitCode(err))
+	assert.True(t, IsInterrupted(err))
+
+	signals, readErr := os.ReadFile(filepath.Join(dir, "signals"))
+	require.NoError(t, readErr)
+	assert.ElementsMatch(t, []string{"script", "child"}, strings.Fields(string(signals)))
+}
+
+func TestRunKillsScriptsThatIgnoreSignals(t *testing.T) {
+	cmd, dir := scriptCmd(t, `trap '' TERM; touch "$DIR/ready"; while :; do sleep 0.05; done`)
+	signalWhenReady(dir, syscall.SIGTERM)
+
+	start := time.Now()
+	err := Run(cmd, RunOptions{KillTimeout: 200 * time.Millisecond})
+	assert.Equal(t, ExitCodeSignalBase+int(syscall.SIGKILL), GetExitCode(err))
+	assert.True(t, IsInterrupted(err))
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "killed before the kill timeout")
+}
+
+func TestRunTimeout(t *testing.T) {
+	// Scripts that exit on SIGTERM are stopped by it
+	cmd, _ := scriptCmd(t, "sleep 5")
+	start := time.Now()
+	err := Run(cmd, RunOptions{Timeout: 100 * time.Millisecond, KillTimeout: 5 * time.Second})
+	assert.Equal(t, ExitCodeTimeout, GetExitCode(err))
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// Others are killed after the kill timeout
+	cmd, _ = scriptCmd(t, "trap '' TERM; while :; do sleep 0.05; done")
+	err = Run(cmd, RunOptions{Timeout: 100 * time.Millisecond, KillTimeout: 100 * time.Millisecond})
+	assert.Equal(t, ExitCodeTimeout, GetExitCode(err))
+}
+
+func TestRunCancel(t *testing.T) {
+	cmd, dir := scriptCmd(t, `touch "$DIR/ready"; sleep 5`)
+	cancel := make(chan struct{})
+	go func() {
+		waitForFile(filepath.Join(dir, "ready"))
+		close(cancel)
+	}()
+
+	err := Run(cmd, RunOptions{Cancel: cancel, KillTimeout: 5 * time.Second})
+	assert.Equal(t, ExitCodeSignalBase+int(syscall.SIGTERM), GetExitCode(err))
+	assert.True(t, IsInterrupted(err))
+}
+
+func TestRunPassesStdin(t *testing.T) {
+	// From a pipe, like `cat data.csv | mycli import`
+	cmd, _ := scriptCmd(t, `read first; echo "got $first"; cat`)
+	cmd.Stdin = strings.NewReader("line 1\nline 2\n")
+	var output strings.Builder
+	cmd.Stdout = &output
+
+	require.NoError(t, Run(cmd, RunOptions{}))
+	assert.Equal(t, "got line 1\nline 2\n", output.String())
+
+	// From a file, like `mycli import < data.csv`
+	input := filepath.Join(t.TempDir(), "data.csv")
+	require.NoError(t, os.WriteFile(input, []byte("a,b\n"), 0644))
+	file, err := os.Open(input)
+	require.NoError(t, err)
+	defer file.Close()
+
+	cmd, _ = scriptCmd(t, "cat")
+	cmd.Stdin = file
+	output.Reset()
+	cmd.Stdout = &output
+
+	require.NoError(t, Run(cmd, RunOptions{}))
+	assert.Equal(t, "a,b\n", output.String())
+}
+
+// TestExecHelperProcess isn't a test of its own. TestExec runs the test binary with it, so Exec has a
+// process to replace.
+func TestExecHelperProcess(t *testing.T) {
+	dir := os.Getenv("CMDEAGLE_TEST_EXEC_DIR")
+	if dir == "" {
+		t.Skip("only run by TestExec")
+	}
+
+	os.WriteFile(filepath.Join(dir, "pid"), []byte(strconv.Itoa(os.Getpid())), 0644)
+	cmd := exec.Command("sh", "-c", `echo "pid=$$ dir=$(pwd) greeting=$GREETING"; cat; exit 7`)
+	cmd.Dir = dir
+	cmd.Env = []string{"GREETING=hello"}
+
+	err := Exec(cmd)
+	// Only reached when the process couldn't be replaced
+	fmt.Fprintln(os.Stderr, "exec failed:", err)
+	os.Exit(99)
+}
+
+func TestExec(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExecHelperProcess$")
+	cmd.Env = append(os.Environ(), "CMDEAGLE_TEST_EXEC_DIR="+dir)
+	cmd.Stdin = strings.NewReader("from stdin\n")
+	output, err := cmd.Output()
+
+	// The script replaced the process, with its directory, environment and stdin, and its exit code
+	// is the process's
+	assert.Equal(t, 7, GetExitCode(err))
+	pid, readErr := os.ReadFile(filepath.Join(dir, "pid"))
+	require.NoError(t, readErr)
+	assert.Equal(t, fmt.Sprintf("pid=%s dir=%s greeting=hello\nfrom stdin\n", pid, dir), string(output))
+}
+
+func TestExecWithoutExecutable(t *testing.T) {
+	cmd := exec.Command("cmdeagle-test-no-such-executable")
+	assert.Error(t, Exec(cmd))
+}
+
+func TestRetryWaitIsInterrupted(t *testing.T) {
+	policy := RetryPolicy{Attempts: 2, Backoff: time.Minute}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}()
+
+	start := time.Now()
+	err := policy.Wait(1)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.True(t, IsInterrupted(err))
+	assert.Equal(t, ExitCodeSignalBase+int(syscall.SIGTERM), GetExitCode(err))
+	assert.False(t, policy.ShouldRetry(1, err))
+}
@@ -0,0 +1,68 @@
+//go:build windows
+
+package executable
+
+import (
+	"io"
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows has no process groups or signals in the POSIX sense. Ctrl-C is delivered to every process
+// attached to the console, so the only signal we relay is the interrupt itself.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+func setupProcessGroup(cmd *exec.Cmd, ttyFd int, foreground bool) {}
+
+// The console is shared by every process attached to it, so there's no terminal to hand over.
+func foregroundTerminal(stdin io.Reader) (int, bool) {
+	return 0, false
+}
+
+func attachTerminal(cmd *exec.Cmd) {}
+
+func restoreForeground(ttyFd int) {}
+
+func withTerminal(cmd *exec.Cmd, ttyFd int, foreground bool, fn func()) {
+	fn()
+}
+
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return nil
+}
+
+// Windows has no way to ask a process to exit, so it's killed right away.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func getProcessExitCode(err *exec.ExitError) int {
+	return err.ExitCode()
+}
+
+// Windows can't replace a running process, so the script runs as a child instead.
+func execProcess(cmd *exec.Cmd, env []string) error {
+	cmd.Env = env
+	return Run(cmd, RunOptions{KillTimeout: DefaultKillTimeout})
+}
+
+// isProcessRunning reports whether a process with the given ID exists.
+func isProcessRunning(pid int) bool {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(handle)
+
+	var code uint32
+	return windows.GetExitCodeProcess(handle, &code) == nil && code == stillActive
+}
+
+// Exit code of processes that haven't exited yet
+const stillActive = 259
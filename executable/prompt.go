@@ -0,0 +1,26 @@
+package executable
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// CanPrompt reports whether the user can be asked for input, i.e. stdin is a terminal.
+func CanPrompt() bool {
+	return term.IsTerminal(os.Stdin.Fd())
+}
+
+// ReadSecret asks the user for a value on the terminal without echoing what they type.
+func ReadSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	value, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read from terminal: %w", err)
+	}
+
+	return strings.TrimRight(string(value), "\r\n"), nil
+}
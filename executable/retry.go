@@ -0,0 +1,81 @@
+package executable
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides whether a failed script is run again, and how long to wait before it is.
+type RetryPolicy struct {
+	// Total number of times the script may run, including the first. Zero or one means no retries.
+	Attempts int
+	// Delay before the second attempt, doubled before every attempt after that
+	Backoff time.Duration
+	// Upper bound for the delay. Zero means no bound.
+	MaxDelay time.Duration
+	// Only these exit codes are retried when set. Otherwise any failure of the script is.
+	OnExitCodes []int
+}
+
+// ShouldRetry reports whether the script should run again after the given attempt, counted from one,
+// failed with err. Failures to start the script aren't retried, and neither are scripts the user
+// interrupted.
+func (policy RetryPolicy) ShouldRetry(attempt int, err error) bool {
+	if err == nil || attempt >= policy.Attempts || IsInterrupted(err) {
+		return false
+	}
+
+	if _, ok := err.(*ExitError); !ok {
+		return false
+	}
+
+	if len(policy.OnExitCodes) == 0 {
+		return true
+	}
+
+	return slices.Contains(policy.OnExitCodes, GetExitCode(err))
+}
+
+// Delay returns how long to wait after the given attempt failed.
+func (policy RetryPolicy) Delay(attempt int) time.Duration {
+	delay := policy.Backoff
+	for i := 1; i < attempt; i++ {
+		if (policy.MaxDelay > 0 && delay >= policy.MaxDelay) || delay > math.MaxInt64/2 {
+			break
+		}
+		delay *= 2
+	}
+
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		return policy.MaxDelay
+	}
+
+	return delay
+}
+
+// Wait waits for the delay after the given attempt failed. SIGINT, SIGTERM and SIGHUP end the wait early
+// with an interrupted ExitError, whose code is 128 plus the signal number, so no attempt runs after them.
+func (policy RetryPolicy) Wait(attempt int) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	timer := time.NewTimer(policy.Delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case sig := <-signals:
+		code := ExitCodeError
+		if number, ok := sig.(syscall.Signal); ok {
+			code = ExitCodeSignalBase + int(number)
+		}
+		return &ExitError{Code: code, Err: fmt.Errorf("interrupted by %s while waiting to retry", sig), Interrupted: true}
+	}
+}
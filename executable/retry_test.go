@@ -0,0 +1,36 @@
+package executable
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3}
+	failed := &ExitError{Code: 2, Silent: true}
+
+	assert.True(t, policy.ShouldRetry(1, failed))
+	assert.True(t, policy.ShouldRetry(2, failed))
+	assert.False(t, policy.ShouldRetry(3, failed), "stops after the last attempt")
+	assert.False(t, policy.ShouldRetry(1, nil), "doesn't retry success")
+	assert.False(t, policy.ShouldRetry(1, errors.New("exec: not found")), "doesn't retry scripts that didn't start")
+	assert.False(t, policy.ShouldRetry(1, &ExitError{Code: 130, Interrupted: true}), "doesn't retry interrupted scripts")
+	assert.True(t, policy.ShouldRetry(1, &ExitError{Code: ExitCodeTimeout}), "retries timeouts")
+
+	policy.OnExitCodes = []int{75}
+	assert.False(t, policy.ShouldRetry(1, failed))
+	assert.True(t, policy.ShouldRetry(1, &ExitError{Code: 75}))
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Attempts: 10, Backoff: time.Second, MaxDelay: 5 * time.Second}
+
+	assert.Equal(t, time.Second, policy.Delay(1))
+	assert.Equal(t, 2*time.Second, policy.Delay(2))
+	assert.Equal(t, 4*time.Second, policy.Delay(3))
+	assert.Equal(t, 5*time.Second, policy.Delay(4))
+	assert.Equal(t, 5*time.Second, policy.Delay(60), "doesn't overflow")
+}
@@ -0,0 +1,72 @@
+package executable
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RemoveBundles removes the bundles that were extracted into the data directory of a CLI, which are
+// extracted again the next time it runs. The lock file is kept, since other CLIs may be waiting on it.
+func RemoveBundles(appDataDir string) error {
+	entries, err := os.ReadDir(appDataDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list data directory: %w", err)
+	}
+
+	release, err := acquireLock(filepath.Join(appDataDir, LockFileName))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	for _, entry := range entries {
+		if entry.Name() == LockFileName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(appDataDir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// FindCompletionScripts returns the completion scripts of a CLI that were installed where the instructions
+// of its `completion` command, or of the cmdeagle docs, suggest. Only scripts that name the CLI are returned, so that files of
+// another program by the same name are left alone.
+func FindCompletionScripts(appName string) []string {
+	candidates := []string{
+		filepath.Join("/etc/bash_completion.d", appName),
+		filepath.Join("/usr/local/etc/bash_completion.d", appName),
+		filepath.Join("/opt/homebrew/etc/bash_completion.d", appName),
+		filepath.Join("/usr/local/share/zsh/site-functions", "_"+appName),
+		filepath.Join("/opt/homebrew/share/zsh/site-functions", "_"+appName),
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates,
+			filepath.Join(homeDir, ".local", "share", "bash-completion", "completions", appName),
+			filepath.Join(homeDir, ".bash_completion.d", appName),
+			filepath.Join(homeDir, ".zsh", "completion", "_"+appName),
+			filepath.Join(homeDir, ".zsh", "completions", "_"+appName),
+			filepath.Join(homeDir, ".oh-my-zsh", "completions", "_"+appName),
+			filepath.Join(homeDir, ".config", "fish", "completions", appName+".fish"),
+		)
+	}
+
+	scripts := []string{}
+	for _, path := range candidates {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if bytes.Contains(content, []byte("completion")) && bytes.Contains(content, []byte(appName)) {
+			scripts = append(scripts, path)
+		}
+	}
+	return scripts
+}
@@ -0,0 +1,49 @@
+package executable
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveBundles(t *testing.T) {
+	appDataDir := t.TempDir()
+
+	_, err := InstallBundle(testBundle("echo hi"), appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+	_, err = InstallBundle(testBundle("echo bye"), appDataDir, "1.0.0", "bbb", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, RemoveBundles(appDataDir))
+
+	entries, err := os.ReadDir(appDataDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, LockFileName, entries[0].Name())
+
+	// The bundle is extracted again next time
+	dir, err := InstallBundle(testBundle("echo hi"), appDataDir, "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "scripts", "greet.sh"))
+
+	assert.NoError(t, RemoveBundles(filepath.Join(appDataDir, "missing")))
+}
+
+func TestFindCompletionScripts(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+
+	fishPath := filepath.Join(homeDir, ".config", "fish", "completions", "mycli.fish")
+	require.NoError(t, os.MkdirAll(filepath.Dir(fishPath), 0755))
+	require.NoError(t, os.WriteFile(fishPath, []byte("# fish completion for mycli\n"), 0644))
+
+	// A file of another program by the same name is left alone
+	bashPath := filepath.Join(homeDir, ".bash_completion.d", "mycli")
+	require.NoError(t, os.MkdirAll(filepath.Dir(bashPath), 0755))
+	require.NoError(t, os.WriteFile(bashPath, []byte("alias mycli=ls\n"), 0644))
+
+	assert.Equal(t, []string{fishPath}, FindCompletionScripts("mycli"))
+}
@@ -0,0 +1,156 @@
+package executable
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Ways a CLI can extract its bundle, as declared by its `extraction` setting
+const (
+	// Into its data directory, once per version
+	ExtractionDisk = "disk"
+	// Into a temporary directory that's removed when the CLI exits, which is in memory where the OS offers one
+	ExtractionMemory = "memory"
+)
+
+// temporaryBundleDirName is the directory of a temporary bundle that the bundle is extracted into. Its
+// parent is private to the CLI that extracted it, and holds the lock file as well.
+const temporaryBundleDirName = "bundle"
+
+// ValidateExtraction checks the value of an `extraction` setting.
+func ValidateExtraction(extraction string) error {
+	switch extraction {
+	case "", ExtractionDisk, ExtractionMemory:
+		return nil
+	default:
+		return fmt.Errorf("invalid extraction %q: must be %s or %s", extraction, ExtractionDisk, ExtractionMemory)
+	}
+}
+
+// NeedsTemporaryBundle reports why the bundle of this version of the CLI can't be used from the data
+// directory, if it can't: the data directory doesn't allow running executables and the bundle includes
+// some, or the bundle isn't completely extracted yet and the data directory isn't writable.
+func NeedsTemporaryBundle(fsys fs.FS, appDataDir string, version string, hash string) (string, error) {
+	files, err := ReadFilesManifest(fsys)
+	if err != nil {
+		return "", err
+	}
+
+	dir := BundleDir(appDataDir, version, hash)
+	if !isInstalled(dir, hash) || len(missingFiles(dir, files.allFiles())) > 0 {
+		if err := os.MkdirAll(appDataDir, 0755); err != nil {
+			return fmt.Sprintf("the data directory can't be created: %v", err), nil
+		}
+		if !isWritable(appDataDir) {
+			return "the data directory isn't writable", nil
+		}
+	}
+
+	if files.hasExecutables() && isNoExec(appDataDir) {
+		return "the data directory doesn't allow running executables", nil
+	}
+
+	return "", nil
+}
+
+// InstallTemporaryBundle extracts the bundle into a temporary directory of its own, and returns the
+// directory along with a function that removes it. Like with InstallBundle, the files of
+// commands are extracted by ExtractCommandFiles when they run. Temporary bundles left behind by CLIs that
+// didn't get to remove them are removed first.
+func InstallTemporaryBundle(fsys fs.FS, appName string) (string, func(), error) {
+	files, err := ReadFilesManifest(fsys)
+	if err != nil {
+		return "", nil, err
+	}
+
+	prefix := "cmdeagle-" + appName + "-"
+	root, err := temporaryRoot(files.hasExecutables())
+	if err != nil {
+		return "", nil, err
+	}
+	removeStaleTemporaryBundles(root, prefix)
+
+	parent, err := os.MkdirTemp(root, fmt.Sprintf("%s%d-", prefix, os.Getpid()))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create a temporary directory for the bundle: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(parent) }
+
+	dir := filepath.Join(parent, temporaryBundleDirName)
+	if err := extract(fsys, parent, dir, BundleManifest{}); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return dir, cleanup, nil
+}
+
+// temporaryRoot returns where temporary bundles are created: a directory in memory such as
+// XDG_RUNTIME_DIR or `/dev/shm` when there's a writable one, or the temporary directory of the OS
+// otherwise. Bundles that run executables from there skip directories that don't allow it.
+func temporaryRoot(needsExec bool) (string, error) {
+	candidates := []string{}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, runtimeDir)
+	}
+	candidates = append(candidates, "/dev/shm", os.TempDir())
+
+	for _, candidate := range candidates {
+		if !isWritable(candidate) {
+			continue
+		}
+		if needsExec && isNoExec(candidate) {
+			continue
+		}
+		return candidate, nil
+	}
+
+	if needsExec {
+		return "", fmt.Errorf("no writable temporary directory that allows running the executables of the bundle, tried %s", strings.Join(candidates, ", "))
+	}
+	return "", fmt.Errorf("no writable temporary directory for the bundle, tried %s", strings.Join(candidates, ", "))
+}
+
+// removeStaleTemporaryBundles removes the temporary bundles of CLIs that are no longer running, which is
+// the case when they were killed, or replaced by a script with `exec`.
+func removeStaleTemporaryBundles(root string, prefix string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.SplitN(strings.TrimPrefix(entry.Name(), prefix), "-", 2)[0])
+		if err != nil || isProcessRunning(pid) {
+			continue
+		}
+		os.RemoveAll(filepath.Join(root, entry.Name()))
+	}
+}
+
+func isWritable(dir string) bool {
+	temp, err := os.CreateTemp(dir, ".write-check-")
+	if err != nil {
+		return false
+	}
+	temp.Close()
+	os.Remove(temp.Name())
+	return true
+}
+
+// hasExecutables reports whether the bundle includes files that are installed as executables.
+func (manifest *FilesManifest) hasExecutables() bool {
+	for path := range manifest.Modes {
+		if mode, err := manifest.Mode(path); err == nil && mode&0111 != 0 {
+			return true
+		}
+	}
+	return false
+}
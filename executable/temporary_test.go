@@ -0,0 +1,57 @@
+package executable
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallTemporaryBundle(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", root)
+
+	// Bundles left behind by CLIs that are gone are removed, unlike the ones of CLIs still running
+	stale := filepath.Join(root, "cmdeagle-mycli-99999999-123")
+	running := filepath.Join(root, fmt.Sprintf("cmdeagle-mycli-%d-456", os.Getpid()))
+	other := filepath.Join(root, "cmdeagle-othercli-99999999-789")
+	for _, dir := range []string{stale, running, other} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+	}
+
+	dir, cleanup, err := InstallTemporaryBundle(testBundle("echo hi"), "mycli")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(dir, filepath.Join(root, "cmdeagle-mycli-")))
+	assert.FileExists(t, filepath.Join(dir, "scripts", "greet.sh"))
+	assert.NoDirExists(t, stale)
+	assert.DirExists(t, running)
+	assert.DirExists(t, other)
+
+	cleanup()
+	assert.NoDirExists(t, filepath.Dir(dir))
+}
+
+func TestNeedsTemporaryBundle(t *testing.T) {
+	appDataDir := filepath.Join(t.TempDir(), "mycli")
+
+	reason, err := NeedsTemporaryBundle(testBundle("echo hi"), appDataDir, "1.0.0", "aaa")
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// A data directory that can't be created
+	blocked := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(blocked, nil, 0644))
+	reason, err = NeedsTemporaryBundle(testBundle("echo hi"), filepath.Join(blocked, "mycli"), "1.0.0", "aaa")
+	require.NoError(t, err)
+	assert.Contains(t, reason, "can't be created")
+}
+
+func TestValidateExtraction(t *testing.T) {
+	assert.NoError(t, ValidateExtraction(""))
+	assert.NoError(t, ValidateExtraction(ExtractionMemory))
+	assert.ErrorContains(t, ValidateExtraction("tmpfs"), "invalid extraction")
+}
@@ -0,0 +1,154 @@
+package executable
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// VerifyCommandFiles returns the files a command needs that were changed since they were extracted. Files
+// with the size and time they were extracted with are taken to be intact, unless full is set, and the
+// others are checked against their hash. Files that aren't there are left to ExtractCommandFiles.
+func VerifyCommandFiles(fsys fs.FS, dir string, commandPath string, full bool) ([]string, error) {
+	files, err := ReadFilesManifest(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := files.CommandFiles(commandPath)
+	if files.Commands == nil {
+		manifest, err := readManifest(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the manifest of %s: %w", dir, err)
+		}
+		paths = manifest.Files
+	}
+
+	return verifyFiles(fsys, dir, files, paths, full)
+}
+
+// VerifyBundle checks every extracted file of the bundle against its hash, and returns the ones that were
+// changed since they were extracted, as well as the ones that were removed from bundles extracted at once.
+func VerifyBundle(fsys fs.FS, dir string) ([]string, error) {
+	files, err := ReadFilesManifest(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return verifyBundle(fsys, dir, files)
+}
+
+// RepairBundle extracts the files that VerifyBundle finds again, and returns them.
+func RepairBundle(fsys fs.FS, dir string) ([]string, error) {
+	files, err := ReadFilesManifest(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := acquireLock(filepath.Join(filepath.Dir(dir), LockFileName))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	changed, err := verifyBundle(fsys, dir, files)
+	if err != nil {
+		return nil, err
+	}
+
+	return changed, extractFiles(fsys, dir, files, changed)
+}
+
+func verifyBundle(fsys fs.FS, dir string, files *FilesManifest) ([]string, error) {
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest of %s: %w", dir, err)
+	}
+
+	changed, err := verifyFiles(fsys, dir, files, manifest.Files, true)
+	if err != nil {
+		return nil, err
+	}
+	if files.Commands == nil {
+		// Bundles with commands extract the files that are missing on their own
+		changed = append(changed, missingFiles(dir, manifest.Files)...)
+	}
+
+	return changed, nil
+}
+
+func verifyFiles(fsys fs.FS, dir string, files *FilesManifest, paths []string, full bool) ([]string, error) {
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest of %s: %w", dir, err)
+	}
+
+	changed := []string{}
+	for _, path := range paths {
+		ok, err := verifyFile(fsys, dir, files, path, manifest.Time, full)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			changed = append(changed, path)
+		}
+	}
+
+	return changed, nil
+}
+
+func verifyFile(fsys fs.FS, dir string, files *FilesManifest, path string, extractedAt time.Time, full bool) (bool, error) {
+	targetPath := filepath.Join(dir, filepath.FromSlash(path))
+	info, err := os.Lstat(targetPath)
+	if err != nil {
+		// Missing files aren't changed ones
+		return true, nil
+	}
+
+	embedded, err := fs.Stat(fsys, path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read embedded file %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() || info.Size() != embedded.Size() {
+		return false, nil
+	}
+	if !full && info.ModTime().Equal(extractedAt) {
+		return true, nil
+	}
+
+	expected, ok := files.Hashes[path]
+	if !ok {
+		// Bundles built without hashes can only be checked by size
+		return true, nil
+	}
+	actual, err := HashFile(targetPath)
+	if err != nil {
+		return false, err
+	}
+	if actual != expected {
+		return false, nil
+	}
+
+	// The file was only touched, so it takes the fast path again next time
+	os.Chtimes(targetPath, extractedAt, extractedAt)
+	return true, nil
+}
+
+// HashFile returns the SHA-256 hash of a file, as recorded in the files manifest of a bundle.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
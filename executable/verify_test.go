@@ -0,0 +1,119 @@
+package executable
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hashOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifiedBundle has a hash for each of its files, and a command that needs all of them.
+func verifiedBundle(t *testing.T) fstest.MapFS {
+	t.Helper()
+
+	files := map[string]string{"greet.sh": "echo hi", "data/names.txt": "ada\ngrace\n"}
+	manifest := FilesManifest{Modes: map[string]string{}, Hashes: map[string]string{}, Commands: map[string][]string{}}
+	bundle := fstest.MapFS{}
+	for path, content := range files {
+		bundle[path] = &fstest.MapFile{Data: []byte(content)}
+		manifest.Hashes[path] = hashOf(content)
+		manifest.Commands["greet"] = append(manifest.Commands["greet"], path)
+	}
+
+	content, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	bundle[FilesManifestName] = &fstest.MapFile{Data: content}
+	return bundle
+}
+
+func TestVerifyCommandFiles(t *testing.T) {
+	bundle := verifiedBundle(t)
+	dir, err := InstallBundle(bundle, t.TempDir(), "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+	require.NoError(t, ExtractCommandFiles(bundle, dir, "greet"))
+
+	changed, err := VerifyCommandFiles(bundle, dir, "greet", true)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	// Touching a file doesn't change it
+	greetPath := filepath.Join(dir, "greet.sh")
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(greetPath, later, later))
+	changed, err = VerifyCommandFiles(bundle, dir, "greet", false)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	// An edit of the same size is caught by its time, or by its hash once the time is restored
+	info, err := os.Stat(greetPath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(greetPath, []byte("echo HI"), 0755))
+	changed, err = VerifyCommandFiles(bundle, dir, "greet", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"greet.sh"}, changed)
+
+	require.NoError(t, os.Chtimes(greetPath, info.ModTime(), info.ModTime()))
+	changed, err = VerifyCommandFiles(bundle, dir, "greet", false)
+	require.NoError(t, err)
+	assert.Empty(t, changed, "the fast path only looks at the size and time")
+	changed, err = VerifyCommandFiles(bundle, dir, "greet", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"greet.sh"}, changed)
+
+	// Missing files are extracted again rather than reported
+	require.NoError(t, os.Remove(filepath.Join(dir, "data", "names.txt")))
+	changed, err = VerifyCommandFiles(bundle, dir, "greet", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"greet.sh"}, changed)
+}
+
+func TestRepairBundle(t *testing.T) {
+	bundle := verifiedBundle(t)
+	dir, err := InstallBundle(bundle, t.TempDir(), "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+	require.NoError(t, ExtractCommandFiles(bundle, dir, "greet"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data", "names.txt"), []byte("nobody\n"), 0644))
+
+	repaired, err := RepairBundle(bundle, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data/names.txt"}, repaired)
+
+	content, err := os.ReadFile(filepath.Join(dir, "data", "names.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "ada\ngrace\n", string(content))
+
+	// Repaired files take the fast path again
+	changed, err := VerifyCommandFiles(bundle, dir, "greet", false)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	repaired, err = RepairBundle(bundle, dir)
+	require.NoError(t, err)
+	assert.Empty(t, repaired)
+}
+
+func TestRepairBundleExtractedAtOnce(t *testing.T) {
+	bundle := testBundle("echo hi")
+	dir, err := InstallBundle(bundle, t.TempDir(), "1.0.0", "aaa", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "scripts", "greet.sh")))
+
+	repaired, err := RepairBundle(bundle, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"scripts/greet.sh"}, repaired)
+	assert.FileExists(t, filepath.Join(dir, "scripts", "greet.sh"))
+}
@@ -0,0 +1,167 @@
+package explain
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/migsc/cmdeagle/params"
+	"github.com/migsc/cmdeagle/types"
+)
+
+//go:embed *
+var PackageFS embed.FS
+
+// Report describes what a command would do, for `--dry-run` and `--explain`.
+type Report struct {
+	Command  string
+	Dir      string
+	Requires []Requirement
+	Validate *Script
+	Start    *Script
+	Calls    []Script
+	Steps    []Script
+	Hooks    []Script
+	Env      []types.EnvVar
+
+	// Only reported with `--explain`
+	Params []Param
+	Checks []params.Check
+}
+
+// Script is a script or executable along with the arguments it would run with. Inline scripts are given
+// separately from the interpreter's arguments so they can be printed as they are.
+type Script struct {
+	Name   string
+	Argv   []string
+	Script string
+	// When the script runs, for hooks that only run in some cases
+	When string
+}
+
+// Requirement is a `requires` entry along with what was found on the system.
+type Requirement struct {
+	Name     string
+	Declared string
+	Path     string
+	Version  string
+	Err      error
+}
+
+// Param is the value of an argument or flag and where it came from.
+type Param struct {
+	Name   string
+	Kind   string
+	Value  any
+	Source string
+	// The variable the value was read from, when it came from the environment
+	Env string
+}
+
+// Write prints the report in a readable form.
+func (report *Report) Write(w io.Writer) error {
+	// Scripts and env values may contain the values of secret args and flags
+	out := &writer{w: params.RedactWriter(w)}
+
+	out.line("Command: %s", report.Command)
+	out.line("Working directory: %s", report.Dir)
+
+	if len(report.Params) > 0 {
+		out.section("Params")
+		for _, param := range report.Params {
+			source := param.Source
+			if param.Env != "" && param.Source == params.SourceEnv {
+				source += " $" + param.Env
+			}
+			out.line("  %s %s = %v (from %s)", param.Kind, param.Name, param.Value, source)
+		}
+	}
+
+	if len(report.Checks) > 0 {
+		out.section("Checks")
+		for _, check := range report.Checks {
+			result := "ok"
+			if check.Err != nil {
+				result = "failed: " + check.Err.Error()
+			}
+			out.line("  %s [%s] %v: %s", check.Param, check.Rules, check.Value, result)
+		}
+	}
+
+	if len(report.Requires) > 0 {
+		out.section("Requires")
+		for _, requirement := range report.Requires {
+			switch {
+			case requirement.Err != nil:
+				out.line("  %s %s: %v", requirement.Name, requirement.Declared, requirement.Err)
+			case requirement.Version != "":
+				out.line("  %s %s: found %s at %s", requirement.Name, requirement.Declared, requirement.Version, requirement.Path)
+			default:
+				out.line("  %s %s: found at %s", requirement.Name, requirement.Declared, requirement.Path)
+			}
+		}
+	}
+
+	if report.Validate != nil {
+		out.script(*report.Validate)
+	}
+	if report.Start != nil {
+		out.script(*report.Start)
+	}
+	for _, call := range report.Calls {
+		out.script(call)
+	}
+	for _, step := range report.Steps {
+		out.script(step)
+	}
+	for _, hook := range report.Hooks {
+		out.script(hook)
+	}
+
+	if len(report.Env) > 0 {
+		env := append([]types.EnvVar{}, report.Env...)
+		sort.Slice(env, func(i, j int) bool { return env[i].Name < env[j].Name })
+
+		out.section("Environment")
+		for _, envVar := range env {
+			out.line("  %s=%s", envVar.Name, envVar.Value)
+		}
+	}
+
+	return out.err
+}
+
+// writer keeps the first error so the report can be written without checking every line.
+type writer struct {
+	w   io.Writer
+	err error
+}
+
+func (out *writer) line(format string, a ...any) {
+	if out.err != nil {
+		return
+	}
+	_, out.err = fmt.Fprintf(out.w, format+"\n", a...)
+}
+
+func (out *writer) section(title string) {
+	out.line("")
+	out.line("%s:", title)
+}
+
+func (out *writer) script(script Script) {
+	title := script.Name
+	if script.When != "" {
+		title += " (" + script.When + ")"
+	}
+	out.section(title)
+
+	out.line("  $ %s", strings.Join(script.Argv, " "))
+	if script.Script != "" {
+		for _, line := range strings.Split(strings.TrimRight(script.Script, "\n"), "\n") {
+			out.line("  | %s", line)
+		}
+	}
+}
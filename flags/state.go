@@ -2,13 +2,20 @@ package flags
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/migsc/cmdeagle/envvar"
+	"github.com/migsc/cmdeagle/interpolation"
+	"github.com/migsc/cmdeagle/params"
 	"github.com/migsc/cmdeagle/types"
 
 	"github.com/charmbracelet/log"
+	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -19,17 +26,34 @@ type FlagsStateStore struct {
 	cobraCommand *cobra.Command
 	pFlagSet     *pflag.FlagSet
 	flagDefMap   map[string]*types.FlagDefinition
+	// Flags whose value was read from their `env` variable
+	fromEnv map[string]string
+	// Secret flags whose value was read from a file or a prompt, and where from
+	fromInput map[string]string
+	// Defaults of secret flags, which are hidden from the help
+	secretDefaults map[string]string
 }
 
+// Flags with this annotation belong to the CLI itself, like `--dry-run`, and aren't exposed to scripts.
+const InternalAnnotation = "cmdeagle_internal"
+
 func CreateFlagsStore(cobraCommand *cobra.Command, commandDef *types.CommandDefinition) *FlagsStateStore {
 	// TODO handle persistent flags
 	// https://cobra.dev/#persistent-flags
 
 	store := &FlagsStateStore{
-		cobraCommand: cobraCommand,
-		pFlagSet:     cobraCommand.Flags(),
-		flagDefMap:   make(map[string]*types.FlagDefinition),
+		cobraCommand:   cobraCommand,
+		pFlagSet:       pflag.NewFlagSet("", pflag.ContinueOnError),
+		flagDefMap:     make(map[string]*types.FlagDefinition),
+		fromEnv:        make(map[string]string),
+		fromInput:      make(map[string]string),
+		secretDefaults: make(map[string]string),
+	}
+
+	if cobraCommand == nil || commandDef == nil {
+		return store
 	}
+	store.pFlagSet = cobraCommand.Flags()
 
 	for _, flagDef := range commandDef.Flags {
 		log.Debug("\tGetting flag definition", "name", flagDef.Name)
@@ -40,6 +64,10 @@ func CreateFlagsStore(cobraCommand *cobra.Command, commandDef *types.CommandDefi
 		flagType.Bind(flagVal, store.pFlagSet, &flagDef)
 
 		store.flagDefMap[flagDef.Name] = &flagDef
+
+		if flagDef.Secret {
+			store.bindSecretFile(&flagDef)
+		}
 	}
 
 	return store
@@ -62,23 +90,238 @@ func (store *FlagsStateStore) GetDef(key string) *types.FlagDefinition {
 	return store.flagDefMap[key]
 }
 
+// VisitAll calls fn for every flag that scripts can see.
 func (store *FlagsStateStore) VisitAll(fn func(flag *pflag.Flag)) {
-	store.pFlagSet.VisitAll(fn)
+	store.pFlagSet.VisitAll(func(flag *pflag.Flag) {
+		if _, internal := flag.Annotations[InternalAnnotation]; internal {
+			return
+		}
+		fn(flag)
+	})
 }
 
-func (store *FlagsStateStore) Interpolate(script string) string {
-	store.pFlagSet.VisitAll(func(flag *pflag.Flag) {
-		placeholder := fmt.Sprintf("{{flags.%s}}", flag.Name)
-		script = strings.ReplaceAll(script, placeholder, fmt.Sprint(flag.Value))
+// ApplyEnv sets the flags that weren't given on the command line from their `env` variable, if it's set.
+// It must be called once the command line has been parsed.
+func (store *FlagsStateStore) ApplyEnv() error {
+	for name, flagDef := range store.flagDefMap {
+		flag := store.pFlagSet.Lookup(name)
+		if flagDef.Env == "" || flag == nil || flag.Changed {
+			continue
+		}
+
+		value, ok := envvar.Lookup(flagDef.Env)
+		if !ok {
+			continue
+		}
+
+		if err := flag.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid value %q for flag --%s from $%s: %w", value, name, flagDef.Env, err)
+		}
+		store.fromEnv[name] = flagDef.Env
+	}
+
+	return nil
+}
+
+// bindSecretFile hides the default of a secret flag from the help, and adds a `--<name>-file` flag to read
+// its value from a file, so it doesn't have to be typed on the command line.
+func (store *FlagsStateStore) bindSecretFile(flagDef *types.FlagDefinition) {
+	flag := store.pFlagSet.Lookup(flagDef.Name)
+	if flag == nil {
+		return
+	}
+	store.secretDefaults[flagDef.Name] = flag.DefValue
+	flag.DefValue = ""
+
+	fileFlagName := flagDef.Name + "-file"
+	if store.pFlagSet.Lookup(fileFlagName) != nil {
+		return
+	}
+	store.pFlagSet.String(fileFlagName, "", fmt.Sprintf("Read --%s from a file, or from stdin with -", flagDef.Name))
+	store.pFlagSet.SetAnnotation(fileFlagName, InternalAnnotation, []string{"true"})
+}
+
+// ApplySecretInputs reads the secret flags that weren't given on the command line or through their `env`
+// variable from their `--<name>-file` flag, or asks for the required ones with prompt if it isn't nil.
+// The values of all secret flags are then masked wherever the CLI shows them.
+func (store *FlagsStateStore) ApplySecretInputs(prompt func(name string) (string, error)) error {
+	names := make([]string, 0, len(store.secretDefaults))
+	for name := range store.secretDefaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		flag := store.pFlagSet.Lookup(name)
+		_, fromEnv := store.fromEnv[name]
+
+		if !flag.Changed && !fromEnv {
+			value, source := "", ""
+
+			if fileFlag := store.pFlagSet.Lookup(name + "-file"); fileFlag != nil && fileFlag.Changed {
+				content, err := readSecretFile(fileFlag.Value.String())
+				if err != nil {
+					return fmt.Errorf("failed to read --%s: %w", fileFlag.Name, err)
+				}
+				value, source = content, params.SourceFile
+			} else if store.flagDefMap[name].Required && prompt != nil {
+				input, err := prompt(name)
+				if err != nil {
+					return err
+				}
+				value, source = input, params.SourcePrompt
+			}
+
+			if source != "" {
+				if err := flag.Value.Set(value); err != nil {
+					return fmt.Errorf("invalid value for flag --%s from %s: %w", name, source, err)
+				}
+				store.fromInput[name] = source
+			}
+		}
+
+		// A declared default, like a token for development, is as secret as the values that replace it
+		if _, fromInput := store.fromInput[name]; flag.Changed || fromEnv || fromInput || store.flagDefMap[name].Default != nil {
+			params.AddSecret(flag.Value.String())
+		}
+	}
+
+	return nil
+}
+
+// readSecretFile reads a secret from a file, or from stdin if the path is `-`. A trailing newline is
+// dropped, since editors and `echo` add one.
+func readSecretFile(path string) (string, error) {
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// Secrets returns the values of the secret flags.
+func (store *FlagsStateStore) Secrets() map[string]any {
+	secrets := map[string]any{}
+	for name := range store.secretDefaults {
+		if flag := store.pFlagSet.Lookup(name); flag != nil {
+			secrets[name] = getTypedVal(flag)
+		}
+	}
+	return secrets
+}
+
+// Reset puts the flags that scripts can see back to their defaults, so that the command's flags can be
+// parsed again when another command calls it.
+func (store *FlagsStateStore) Reset() error {
+	var errs []error
+
+	reset := func(flag *pflag.Flag) {
+		_, fromEnv := store.fromEnv[flag.Name]
+		_, fromInput := store.fromInput[flag.Name]
+		if !flag.Changed && !fromEnv && !fromInput {
+			return
+		}
+
+		defValue := flag.DefValue
+		if secretDefault, secret := store.secretDefaults[flag.Name]; secret {
+			defValue = secretDefault
+		}
+
+		if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+			defaults := []string{}
+			if trimmed := strings.Trim(defValue, "[]"); trimmed != "" {
+				defaults = strings.Split(trimmed, ",")
+			}
+			errs = append(errs, sliceValue.Replace(defaults))
+		} else {
+			errs = append(errs, flag.Value.Set(defValue))
+		}
+		flag.Changed = false
+	}
+
+	store.VisitAll(reset)
+	for name := range store.secretDefaults {
+		if fileFlag := store.pFlagSet.Lookup(name + "-file"); fileFlag != nil {
+			reset(fileFlag)
+		}
+	}
+
+	store.fromEnv = make(map[string]string)
+	store.fromInput = make(map[string]string)
+	return errors.Join(errs...)
+}
+
+// GetSource returns where the value of a flag came from: params.SourceCLI, SourceEnv, SourceFile,
+// SourcePrompt or SourceDefault.
+func (store *FlagsStateStore) GetSource(name string) string {
+	if _, ok := store.fromEnv[name]; ok {
+		return params.SourceEnv
+	}
+
+	if source, ok := store.fromInput[name]; ok {
+		return source
+	}
+
+	if flag := store.pFlagSet.Lookup(name); flag != nil && flag.Changed {
+		return params.SourceCLI
+	}
+
+	return params.SourceDefault
+}
+
+// GetContext returns the flag values that scripts can reference as `{{flags.*}}`. Values keep their type
+// so templates can use them in conditions, e.g. `{{if flags.verbose}}`.
+func (store *FlagsStateStore) GetContext() interpolation.Context {
+	ctx := interpolation.NewContext()
+
+	store.VisitAll(func(flag *pflag.Flag) {
+		ctx.Set("flags."+flag.Name, getTypedVal(flag))
 	})
+	ctx.Set("flags.json", store.ToJSONString())
 
-	return script
+	return ctx
+}
+
+func (store *FlagsStateStore) Interpolate(script string) (string, error) {
+	return interpolation.Render(script, store.GetContext())
+}
+
+func getTypedVal(flag *pflag.Flag) any {
+	if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+		return sliceValue.GetSlice()
+	}
+
+	var val any
+	var err error
+
+	switch flagType := flag.Value.Type(); {
+	case flagType == "bool":
+		val, err = cast.ToBoolE(flag.Value.String())
+	case strings.HasPrefix(flagType, "int") || strings.HasPrefix(flagType, "uint"):
+		val, err = cast.ToInt64E(flag.Value.String())
+	case strings.HasPrefix(flagType, "float"):
+		val, err = cast.ToFloat64E(flag.Value.String())
+	default:
+		return flag.Value.String()
+	}
+
+	if err != nil {
+		return flag.Value.String()
+	}
+	return val
 }
 
 func (store *FlagsStateStore) GetEnvVariables() []types.EnvVar {
 	envVars := make([]types.EnvVar, 0)
 
-	store.pFlagSet.VisitAll(func(flag *pflag.Flag) {
+	store.VisitAll(func(flag *pflag.Flag) {
 		envVars = append(envVars, types.EnvVar{Name: "FLAGS_" + envvar.GetEnvVariableNameFromStateKey(flag.Name), Value: fmt.Sprint(flag.Value)})
 	})
 
@@ -88,7 +331,11 @@ func (store *FlagsStateStore) GetEnvVariables() []types.EnvVar {
 func (store *FlagsStateStore) ToJSON() map[string]any {
 	result := make(map[string]any)
 
-	store.pFlagSet.VisitAll(func(flag *pflag.Flag) {
+	store.VisitAll(func(flag *pflag.Flag) {
+		if _, secret := store.secretDefaults[flag.Name]; secret {
+			result[flag.Name] = params.Redacted
+			return
+		}
 		result[flag.Name] = flag.Value.String()
 	})
 
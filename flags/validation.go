@@ -38,7 +38,7 @@ func ValidateFlags(cobraCmd *cobra.Command, flagsConfigDefs []types.FlagDefiniti
 			continue
 		}
 
-		err := params.ValidateConstraint(flagDef.Constraints, flag.Value)
+		err := params.ValidateParamConstraint(flagDef.Name, flagDef.Constraints, flag.Value)
 		if err != nil {
 			return err
 		}
@@ -56,9 +56,9 @@ func ValidateFlags(cobraCmd *cobra.Command, flagsConfigDefs []types.FlagDefiniti
 
 		if flagDef.DependsOn != nil {
 			for _, dependency := range flagDef.DependsOn {
-				err := params.ValidateConstraint(dependency.When, store.GetVal(dependency.Name))
+				err := params.ValidateParamConstraint(dependency.Name, dependency.When, store.GetVal(dependency.Name))
 				if err != nil {
-					foundErr = err
+					foundErr = params.NewDependencyError(flagDef.Name, dependency.Name, err)
 				}
 			}
 		}
@@ -68,16 +68,12 @@ func ValidateFlags(cobraCmd *cobra.Command, flagsConfigDefs []types.FlagDefiniti
 				otherFlag := store.Get(conflict)
 
 				// Only check for conflicts if both flags were explicitly set by the user
+				var err error
 				if otherFlag != nil && otherFlag.Changed && flag.Changed {
-					foundErr = fmt.Errorf("Argument %s conflicts with %s", flagDef.Name, conflict)
+					err = params.NewParamError("conflicts-with", flagDef.Name, flag.Value, conflict)
+					foundErr = err
 				}
-			}
-		}
-
-		if flagDef.Constraints != nil {
-			err := params.ValidateConstraint(flagDef.Constraints, flag.Value)
-			if err != nil {
-				foundErr = err
+				params.RecordCheck(flagDef.Name, "conflicts-with", flag.Value, err)
 			}
 		}
 
@@ -99,8 +95,10 @@ func ValidateFlags(cobraCmd *cobra.Command, flagsConfigDefs []types.FlagDefiniti
 			log.Debug("Validating pattern for argument", "pattern", pattern, "value", flag.Value, "match", match, "err", err)
 
 			if !match {
-				foundErr = fmt.Errorf("pattern validation failed for argument %s: %v", flagDef.Name, flag.Value)
+				err = params.NewParamError("pattern", flagDef.Name, flag.Value, flagDef.Pattern)
+				foundErr = err
 			}
+			params.RecordCheck(flagDef.Name, "pattern", flag.Value, err)
 		}
 
 	})
@@ -0,0 +1,452 @@
+package interpolation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Quoting selects how interpolated values are escaped for the interpreter that runs the script.
+type Quoting int
+
+const (
+	// Values are inserted as they are, for text that isn't code such as file paths passed as arguments
+	QuoteNone Quoting = iota
+	// sh, bash, zsh and other POSIX shells
+	QuotePOSIX
+	// pwsh and powershell
+	QuotePowerShell
+	// String literals as understood by JavaScript, Python, Ruby and most other languages
+	QuoteLiteral
+)
+
+// Contexts of an action: the kind of string literal, if any, it appears in
+const (
+	ContextUnquoted = "unquoted"
+	ContextSingle   = "single"
+	ContextDouble   = "double"
+	ContextBacktick = "backtick"
+	// The body of a shell heredoc whose delimiter isn't quoted, where `$` and backticks are expanded
+	ContextHeredoc = "heredoc"
+	// The body of a shell heredoc with a quoted delimiter, like `<<'EOF'`, which is taken as it is
+	ContextQuotedHeredoc = "quoted-heredoc"
+)
+
+// Raw marks a value that is inserted into a script as it is, without escaping. Lists are joined with
+// spaces so the shell splits them back into words.
+type Raw struct {
+	Value any
+}
+
+func (raw Raw) String() string {
+	return joinWords(raw.Value)
+}
+
+// frame is a string literal, heredoc or command substitution that's open at some point of a script.
+// Command substitutions like `$(...)` and the expressions of template literals are code of their own, so
+// they're unquoted frames even inside a string.
+type frame struct {
+	context string
+	// What ends a frame that's nested in something else: `)`, `}` or a backtick
+	closer byte
+	// How many of the brackets that end the frame are open inside it
+	depth int
+	// Arithmetic expansions, like `$((1 << 2))`, which have no heredocs
+	arithmetic bool
+	heredoc    *heredoc
+}
+
+// heredoc is a heredoc whose body starts on the line after its operator.
+type heredoc struct {
+	delimiter string
+	// Whether the delimiter is quoted, in which case the body is taken as it is
+	quoted bool
+	// `<<-` strips leading tabs from the lines of the body, including the delimiter
+	stripTabs bool
+}
+
+// scanner follows the quotes, command substitutions and heredocs in the literal text of a script, to find
+// out what the actions between them are inside of. Comments are skipped since they commonly contain
+// apostrophes.
+type scanner struct {
+	quoting Quoting
+	// The frames that are open, the innermost last
+	frames []frame
+	// Heredocs whose bodies start after the current line
+	pending []heredoc
+	// The current line of a heredoc body, to tell when it's the delimiter
+	line strings.Builder
+}
+
+func newScanner(quoting Quoting) *scanner {
+	return &scanner{quoting: quoting, frames: []frame{{context: ContextUnquoted}}}
+}
+
+// context returns the context of the text scanned last.
+func (s *scanner) context() string {
+	return s.frames[len(s.frames)-1].context
+}
+
+// delimiter returns the delimiter of the heredoc the text scanned last is in, if any.
+func (s *scanner) delimiter() string {
+	if heredoc := s.frames[len(s.frames)-1].heredoc; heredoc != nil {
+		return heredoc.delimiter
+	}
+	return ""
+}
+
+// substitution reports whether the text scanned last is inside a command substitution, or the expression of
+// a template literal, which is itself inside a string or heredoc.
+func (s *scanner) substitution() bool {
+	quoted := false
+	for _, frame := range s.frames {
+		if frame.context != ContextUnquoted {
+			quoted = true
+		} else if quoted && frame.closer != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// action records that an action was inserted, so the line it's on is never the end of a heredoc.
+func (s *scanner) action() {
+	s.line.WriteByte(0)
+}
+
+func (s *scanner) push(f frame) {
+	s.frames = append(s.frames, f)
+	s.line.WriteByte(0)
+}
+
+func (s *scanner) pop() {
+	if len(s.frames) > 1 {
+		s.frames = s.frames[:len(s.frames)-1]
+	}
+}
+
+// startHeredoc opens the body of the next pending heredoc, if there is one.
+func (s *scanner) startHeredoc() {
+	if len(s.pending) == 0 {
+		return
+	}
+
+	heredoc := s.pending[0]
+	s.pending = s.pending[1:]
+	context := ContextHeredoc
+	if heredoc.quoted {
+		context = ContextQuotedHeredoc
+	}
+	s.frames = append(s.frames, frame{context: context, heredoc: &heredoc})
+	s.line.Reset()
+}
+
+// scan follows a piece of literal script text.
+func (s *scanner) scan(text string) {
+	escapeChar := byte('\\')
+	if s.quoting == QuotePowerShell {
+		escapeChar = '`'
+	}
+	posix := s.quoting == QuotePOSIX
+	startsWith := func(i int, prefix string) bool {
+		return strings.HasPrefix(text[i:], prefix)
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		f := &s.frames[len(s.frames)-1]
+
+		switch f.context {
+		case ContextUnquoted:
+			switch {
+			case f.closer != 0 && c == f.closer && f.depth == 0:
+				s.pop()
+			case f.closer == ')' && c == '(', f.closer == '}' && c == '{':
+				f.depth++
+			case f.closer == ')' && c == ')', f.closer == '}' && c == '}':
+				f.depth--
+			case c == escapeChar:
+				i++
+			case c == '#' && (i == 0 || isWordBoundary(text[i-1])) && !f.arithmetic,
+				c == '/' && s.quoting == QuoteLiteral && startsWith(i, "//"):
+				end := strings.IndexByte(text[i:], '\n')
+				if end < 0 {
+					return
+				}
+				// The newline is scanned next, since heredocs start after it
+				i += end - 1
+			case c == '\n':
+				s.startHeredoc()
+			case c == '\'':
+				s.push(frame{context: ContextSingle})
+			case c == '"':
+				s.push(frame{context: ContextDouble})
+			case c == '`' && s.quoting == QuoteLiteral:
+				s.push(frame{context: ContextBacktick})
+			case c == '<' && posix && startsWith(i, "<<<"):
+				// Here-strings are words like any other
+				i += 2
+			case c == '<' && posix && !f.arithmetic && startsWith(i, "<<"):
+				i = s.readHeredoc(text, i)
+			default:
+				i = s.openSubstitution(text, i)
+			}
+
+		case ContextSingle:
+			// Only programming languages have escapes inside single quotes
+			if c == '\\' && s.quoting == QuoteLiteral {
+				i++
+			} else if c == '\'' {
+				s.pop()
+			}
+
+		case ContextDouble:
+			switch {
+			case c == escapeChar:
+				i++
+			case f.closer != 0 && c == f.closer && f.depth == 0:
+				s.pop()
+			case f.closer == '}' && c == '{':
+				f.depth++
+			case f.closer == '}' && c == '}':
+				f.depth--
+			case c == '"' && f.closer != 0:
+				// Quotes inside a parameter expansion start a string of their own
+				s.push(frame{context: ContextDouble})
+			case c == '"':
+				s.pop()
+			default:
+				i = s.openSubstitution(text, i)
+			}
+
+		case ContextBacktick:
+			switch {
+			case c == '\\':
+				i++
+			case c == '`':
+				s.pop()
+			case startsWith(i, "${"):
+				s.push(frame{context: ContextUnquoted, closer: '}'})
+				i++
+			}
+
+		case ContextHeredoc, ContextQuotedHeredoc:
+			if c == '\n' {
+				line := s.line.String()
+				s.line.Reset()
+				if f.heredoc.stripTabs {
+					line = strings.TrimLeft(line, "\t")
+				}
+				if line == f.heredoc.delimiter {
+					// The delimiter ends any parameter expansion that's still open in the body, too
+					for heredoc := f.heredoc; s.frames[len(s.frames)-1].heredoc == heredoc; {
+						s.pop()
+					}
+					s.startHeredoc()
+				}
+				continue
+			}
+
+			s.line.WriteByte(c)
+			if f.context == ContextHeredoc {
+				switch {
+				case c == '\\' && i+1 < len(text) && text[i+1] != '\n':
+					i++
+					s.line.WriteByte(text[i])
+				case f.closer != 0 && c == f.closer && f.depth == 0:
+					s.pop()
+				case f.closer == '}' && c == '{':
+					f.depth++
+				case f.closer == '}' && c == '}':
+					f.depth--
+				default:
+					i = s.openSubstitution(text, i)
+				}
+			}
+		}
+	}
+}
+
+// openSubstitution opens the command substitution or parameter expansion that starts at i, if any, and
+// returns the position of its last opening character.
+func (s *scanner) openSubstitution(text string, i int) int {
+	switch s.quoting {
+	case QuotePOSIX:
+		switch {
+		case strings.HasPrefix(text[i:], "$(("):
+			s.push(frame{context: ContextUnquoted, closer: ')', depth: 1, arithmetic: true})
+			return i + 2
+		case strings.HasPrefix(text[i:], "$("):
+			s.push(frame{context: ContextUnquoted, closer: ')'})
+			return i + 1
+		case strings.HasPrefix(text[i:], "${"):
+			// Unlike command substitutions, parameter expansions are part of the string or heredoc they're
+			// in, so single quotes inside them are taken as they are
+			f := s.frames[len(s.frames)-1]
+			s.push(frame{context: f.context, closer: '}', heredoc: f.heredoc})
+			return i + 1
+		case text[i] == '`':
+			s.push(frame{context: ContextUnquoted, closer: '`'})
+		}
+
+	case QuotePowerShell:
+		if strings.HasPrefix(text[i:], "$(") {
+			s.push(frame{context: ContextUnquoted, closer: ')'})
+			return i + 1
+		}
+	}
+
+	return i
+}
+
+// readHeredoc reads the heredoc operator at i, such as `<<EOF`, `<<-EOF` or `<<'EOF'`, and returns the
+// position of its end.
+func (s *scanner) readHeredoc(text string, i int) int {
+	j := i + 2
+	heredoc := heredoc{}
+	if j < len(text) && text[j] == '-' {
+		heredoc.stripTabs = true
+		j++
+	}
+	for j < len(text) && (text[j] == ' ' || text[j] == '\t') {
+		j++
+	}
+
+	var delimiter strings.Builder
+	for ; j < len(text) && !isWordBoundary(text[j]) && !strings.ContainsRune("&|<>()", rune(text[j])); j++ {
+		switch c := text[j]; c {
+		case '\'', '"':
+			heredoc.quoted = true
+			end := strings.IndexByte(text[j+1:], c)
+			if end < 0 {
+				return len(text)
+			}
+			delimiter.WriteString(text[j+1 : j+1+end])
+			j += end + 1
+		case '\\':
+			heredoc.quoted = true
+			if j+1 < len(text) {
+				j++
+				delimiter.WriteByte(text[j])
+			}
+		default:
+			delimiter.WriteByte(c)
+		}
+	}
+
+	if delimiter.Len() == 0 {
+		return i + 1
+	}
+	heredoc.delimiter = delimiter.String()
+	s.pending = append(s.pending, heredoc)
+	return j - 1
+}
+
+func isWordBoundary(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ';'
+}
+
+var (
+	posixDoubleQuoteEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	heredocEscaper               = strings.NewReplacer(`\`, `\\`, "$", `\$`, "`", "\\`")
+	powerShellSingleQuoteEscaper = strings.NewReplacer("'", "''", "‘", "‘‘", "’", "’’", "‚", "‚‚", "‛", "‛‛")
+	powerShellDoubleQuoteEscaper = strings.NewReplacer("`", "``", "$", "`$", `"`, "`\"", "“", "`“", "”", "`”", "„", "`„")
+	backtickEscaper              = strings.NewReplacer(`\`, `\\`, "`", "\\`", "${", `\${`)
+)
+
+// checkHeredocValue returns an error for a value with a line that would end the heredoc it's inserted in,
+// since nothing can escape it.
+func checkHeredocValue(delimiter string, value string) error {
+	for _, line := range strings.Split(value, "\n") {
+		if strings.TrimLeft(line, "\t") == delimiter {
+			return fmt.Errorf("value would end the heredoc %s", delimiter)
+		}
+	}
+	return nil
+}
+
+// escape makes a value safe to insert into a script at a position with the given context.
+func escape(quoting Quoting, context string, value any) string {
+	if raw, ok := value.(Raw); ok {
+		return raw.String()
+	}
+
+	switch quoting {
+	case QuotePOSIX:
+		switch context {
+		case ContextSingle:
+			return strings.ReplaceAll(joinWords(value), "'", `'\''`)
+		case ContextDouble:
+			return posixDoubleQuoteEscaper.Replace(joinWords(value))
+		case ContextHeredoc:
+			return heredocEscaper.Replace(joinWords(value))
+		case ContextQuotedHeredoc:
+			return joinWords(value)
+		default:
+			return ShellQuote(value)
+		}
+
+	case QuotePowerShell:
+		switch context {
+		case ContextSingle:
+			return powerShellSingleQuoteEscaper.Replace(joinWords(value))
+		case ContextDouble:
+			return powerShellDoubleQuoteEscaper.Replace(joinWords(value))
+		default:
+			if items, ok := toList(value); ok {
+				quoted := make([]string, len(items))
+				for i, item := range items {
+					quoted[i] = "'" + powerShellSingleQuoteEscaper.Replace(toString(item)) + "'"
+				}
+				return strings.Join(quoted, " ")
+			}
+			return "'" + powerShellSingleQuoteEscaper.Replace(toString(value)) + "'"
+		}
+
+	case QuoteLiteral:
+		switch context {
+		case ContextSingle:
+			content := jsonStringContent(joinWords(value))
+			return strings.ReplaceAll(strings.ReplaceAll(content, `\"`, `"`), "'", `\'`)
+		case ContextDouble:
+			return jsonStringContent(joinWords(value))
+		case ContextBacktick:
+			return backtickEscaper.Replace(joinWords(value))
+		default:
+			if items, ok := toList(value); ok {
+				strs := make([]string, len(items))
+				for i, item := range items {
+					strs[i] = toString(item)
+				}
+				return encodeJSON(strs)
+			}
+			return encodeJSON(toString(value))
+		}
+	}
+
+	return toString(value)
+}
+
+// joinWords turns lists into a single string, the way a shell expands `"$@"` inside a string.
+func joinWords(value any) string {
+	if items, ok := toList(value); ok {
+		return join(" ", items)
+	}
+	return toString(value)
+}
+
+func encodeJSON(value any) string {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return `""`
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+func jsonStringContent(value string) string {
+	encoded := encodeJSON(value)
+	return encoded[1 : len(encoded)-1]
+}
@@ -0,0 +1,107 @@
+package interpolation
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScannerContexts(t *testing.T) {
+	tests := []struct {
+		name         string
+		quoting      Quoting
+		text         string
+		context      string
+		substitution bool
+	}{
+		{"unquoted", QuotePOSIX, "echo ", ContextUnquoted, false},
+		{"double quotes", QuotePOSIX, `echo "hi `, ContextDouble, false},
+		{"command substitution in double quotes", QuotePOSIX, `echo "$(echo `, ContextUnquoted, true},
+		{"backticks in double quotes", QuotePOSIX, "echo \"`echo ", ContextUnquoted, true},
+		{"parameter expansion in double quotes", QuotePOSIX, `echo "${name:-`, ContextDouble, false},
+		{"quotes inside a parameter expansion", QuotePOSIX, `echo "${name:-"`, ContextDouble, false},
+		{"command substitution in a parameter expansion", QuotePOSIX, `echo "${name:-$(echo `, ContextUnquoted, true},
+		{"after a parameter expansion", QuotePOSIX, `echo "${name:-${other}} ${#name} `, ContextDouble, false},
+		{"unquoted parameter expansion", QuotePOSIX, `echo ${name:-`, ContextUnquoted, false},
+		{"quotes inside a command substitution", QuotePOSIX, `echo "$(echo "`, ContextDouble, true},
+		{"after a command substitution", QuotePOSIX, `echo "$(echo (a) ")") `, ContextDouble, false},
+		{"after an arithmetic expansion", QuotePOSIX, `echo "$((1 << 2)) `, ContextDouble, false},
+		{"command substitution in pwsh strings", QuotePowerShell, `"$(Get-Date `, ContextUnquoted, true},
+		{"pwsh variables in braces", QuotePowerShell, `"${env:HOME} `, ContextDouble, false},
+		{"template literal expressions", QuoteLiteral, "`${f(", ContextUnquoted, true},
+		{"after template literal expressions", QuoteLiteral, "`${f({})} ", ContextBacktick, false},
+		{"heredoc bodies", QuotePOSIX, "cat <<EOF\nvalue=", ContextHeredoc, false},
+		{"heredoc bodies after a comment", QuotePOSIX, "cat <<EOF # it's\nvalue=", ContextHeredoc, false},
+		{"quoted heredoc bodies", QuotePOSIX, "cat <<'EOF'\nvalue=", ContextQuotedHeredoc, false},
+		{"escaped heredoc delimiters", QuotePOSIX, "cat <<\\EOF\nvalue=", ContextQuotedHeredoc, false},
+		{"heredoc delimiter on the operator line", QuotePOSIX, "cat <<EOF | grep x\n", ContextHeredoc, false},
+		{"quotes in heredoc bodies", QuotePOSIX, "cat <<EOF\nit's \"", ContextHeredoc, false},
+		{"command substitution in heredoc bodies", QuotePOSIX, "cat <<EOF\n$(echo ", ContextUnquoted, true},
+		{"parameter expansion in heredoc bodies", QuotePOSIX, "cat <<EOF\n${name:-", ContextHeredoc, false},
+		{"after a parameter expansion in heredoc bodies", QuotePOSIX, "cat <<EOF\n${name:-x}\nEOF\necho ", ContextUnquoted, false},
+		{"after heredocs", QuotePOSIX, "cat <<EOF\nx\nEOF\necho ", ContextUnquoted, false},
+		{"after heredocs with tabs", QuotePOSIX, "cat <<-EOF\n\tx\n\tEOF\necho \"", ContextDouble, false},
+		{"consecutive heredocs", QuotePOSIX, "cat <<A <<'B'\nx\nA\ny", ContextQuotedHeredoc, false},
+		{"here-strings", QuotePOSIX, "cat <<< \"", ContextDouble, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scanner := newScanner(test.quoting)
+			scanner.scan(test.text)
+			assert.Equal(t, test.context, scanner.context())
+			assert.Equal(t, test.substitution, scanner.substitution())
+		})
+	}
+}
+
+func TestRenderScriptInSubstitutions(t *testing.T) {
+	ctx := NewContext()
+	ctx.Set("args.x", "a; echo INJECTED")
+	ctx.Set("args.words", "hello world")
+	ctx.Set("args.code", "$(echo INJECTED) `echo INJECTED` \\ \"")
+	ctx.Set("args.subs", "$(echo INJECTED) `echo INJECTED`")
+	ctx.Set("args.end", "line\nEOF\necho INJECTED")
+
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{"command substitution in double quotes", `echo "$(echo {{args.x}})"`, `echo "$(echo 'a; echo INJECTED')"`},
+		{"backticks in double quotes", "echo \"`echo {{args.x}}`\"", "echo \"`echo 'a; echo INJECTED'`\""},
+		{"parameter expansion in double quotes", `echo "${UNSET:-{{args.x}}}"`, `echo "${UNSET:-a; echo INJECTED}"`},
+		{"code in parameter expansions", `echo "${UNSET:-{{args.code}}}"`, "echo \"${UNSET:-\\$(echo INJECTED) \\`echo INJECTED\\` \\\\ \\\"}\""},
+		{"alternative values", `SET=1; echo "${SET:+{{args.code}}}"`, "SET=1; echo \"${SET:+\\$(echo INJECTED) \\`echo INJECTED\\` \\\\ \\\"}\""},
+		{"quotes in parameter expansions", `echo "${UNSET:-"{{args.code}}"}"`, "echo \"${UNSET:-\"\\$(echo INJECTED) \\`echo INJECTED\\` \\\\ \\\"\"}\""},
+		{"command substitution in parameter expansions", `echo "${UNSET:-$(echo {{args.x}})}"`, `echo "${UNSET:-$(echo 'a; echo INJECTED')}"`},
+		{"parameter expansion in heredoc bodies", "cat <<EOF\n${UNSET:-{{args.subs}}}\nEOF", "cat <<EOF\n${UNSET:-\\$(echo INJECTED) \\`echo INJECTED\\`}\nEOF"},
+		{"double quotes after a command substitution", `echo "$(true) {{args.x}}"`, `echo "$(true) a; echo INJECTED"`},
+		{"heredoc bodies", "cat <<EOF\nvalue={{args.words}}\nEOF", "cat <<EOF\nvalue=hello world\nEOF"},
+		{"code in heredoc bodies", "cat <<EOF\n{{args.code}}\nEOF", "cat <<EOF\n\\$(echo INJECTED) \\`echo INJECTED\\` \\\\ \"\nEOF"},
+		{"quoted heredoc bodies", "cat <<'EOF'\n{{args.code}}\nEOF", "cat <<'EOF'\n$(echo INJECTED) `echo INJECTED` \\ \"\nEOF"},
+		{"after heredocs", "cat <<EOF\nx\nEOF\necho {{args.words}}", "cat <<EOF\nx\nEOF\necho 'hello world'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := RenderScript(test.script, ctx, QuotePOSIX)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+
+			// The script prints the values it was given, and runs nothing else
+			for _, shell := range []string{"sh", "bash"} {
+				output, err := exec.Command(shell, "-c", result).CombinedOutput()
+				require.NoError(t, err, string(output))
+				assert.NotRegexp(t, "(?m)^'?INJECTED'?$", string(output), shell)
+			}
+		})
+	}
+
+	t.Run("rejects values that end heredocs", func(t *testing.T) {
+		_, err := RenderScript("cat <<EOF\n{{args.end}}\nEOF", ctx, QuotePOSIX)
+		assert.ErrorContains(t, err, "value would end the heredoc EOF")
+	})
+}
@@ -0,0 +1,124 @@
+package interpolation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Funcs are the functions available in script templates, in addition to the ones text/template provides.
+var Funcs = template.FuncMap{
+	"raw":        func(value any) Raw { return Raw{Value: value} },
+	"default":    defaultValue,
+	"quote":      quote,
+	"shellquote": shellQuote,
+	"json":       toJSON,
+	"join":       join,
+	"upper":      func(value any) string { return strings.ToUpper(toString(value)) },
+	"lower":      func(value any) string { return strings.ToLower(toString(value)) },
+	"env":        os.Getenv,
+}
+
+// defaultValue returns the fallback when the value is empty, as in `{{flags.name | default "world"}}`.
+func defaultValue(fallback any, value any) any {
+	if isEmpty(value) {
+		return fallback
+	}
+	return value
+}
+
+func quote(value any) string {
+	return strconv.Quote(toString(value))
+}
+
+// ShellQuote quotes a value for POSIX shells, so it's passed to the script as a single word no matter
+// what it contains. Lists are quoted item by item.
+func ShellQuote(value any) string {
+	if items, ok := toList(value); ok {
+		quoted := make([]string, len(items))
+		for i, item := range items {
+			quoted[i] = ShellQuote(item)
+		}
+		return strings.Join(quoted, " ")
+	}
+
+	return "'" + strings.ReplaceAll(toString(value), "'", `'\''`) + "'"
+}
+
+// Values quoted by hand are already safe, so they're not escaped again
+func shellQuote(value any) Raw {
+	return Raw{Value: ShellQuote(value)}
+}
+
+func toJSON(value any) (string, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func join(separator string, value any) string {
+	items, ok := toList(value)
+	if !ok {
+		return toString(value)
+	}
+
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = toString(item)
+	}
+	return strings.Join(parts, separator)
+}
+
+func toString(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func toList(value any) ([]any, bool) {
+	if value == nil {
+		return nil, false
+	}
+
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() != reflect.Slice && reflected.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	items := make([]any, reflected.Len())
+	for i := range items {
+		items[i] = reflected.Index(i).Interface()
+	}
+	return items, true
+}
+
+func isEmpty(value any) bool {
+	if value == nil {
+		return true
+	}
+
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return reflected.Len() == 0
+	case reflect.Bool:
+		return !reflected.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflected.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return reflected.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return reflected.Float() == 0
+	case reflect.Pointer, reflect.Interface:
+		return reflected.IsNil()
+	}
+
+	return false
+}
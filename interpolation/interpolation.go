@@ -0,0 +1,357 @@
+package interpolation
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed *
+var PackageFS embed.FS
+
+// Namespaces that scripts can reference values from, as in `{{args.name}}` or `{{cli.bin_dir}}`. `outputs`
+// holds the values earlier scripts set through the control channel.
+var Namespaces = []string{"args", "flags", "params", "cli", "outputs"}
+
+// Context holds the values a script can reference, by namespace and key.
+type Context map[string]map[string]any
+
+func NewContext() Context {
+	ctx := Context{}
+	for _, namespace := range Namespaces {
+		ctx[namespace] = map[string]any{}
+	}
+	return ctx
+}
+
+// Set stores a value under a `namespace.key` name such as `cli.bin_dir`.
+func (ctx Context) Set(name string, value any) {
+	namespace, key, _ := strings.Cut(name, ".")
+	if ctx[namespace] == nil {
+		ctx[namespace] = map[string]any{}
+	}
+	ctx[namespace][key] = value
+}
+
+func (ctx Context) Lookup(ref Reference) (any, error) {
+	values, ok := ctx[ref.Namespace]
+	if !ok {
+		return nil, &UndefinedError{Ref: ref}
+	}
+
+	value, ok := values[ref.Key]
+	if !ok {
+		return nil, &UndefinedError{Ref: ref}
+	}
+
+	return value, nil
+}
+
+// Merge copies the values of another context into this one.
+func (ctx Context) Merge(other Context) {
+	for namespace, values := range other {
+		for key, value := range values {
+			ctx.Set(namespace+"."+key, value)
+		}
+	}
+}
+
+// Reference is a `namespace.key` reference found in a script.
+type Reference struct {
+	Namespace string
+	Key       string
+}
+
+func (ref Reference) String() string {
+	return ref.Namespace + "." + ref.Key
+}
+
+// UndefinedError is returned when a script references a value that doesn't exist.
+type UndefinedError struct {
+	Ref Reference
+}
+
+func (err *UndefinedError) Error() string {
+	return fmt.Sprintf("undefined reference `%s`", err.Ref)
+}
+
+var (
+	actionPattern = regexp.MustCompile(`(?s)\{\{(.*?)\}\}`)
+	// String literals inside actions, which are left as they are
+	literalPattern = regexp.MustCompile("\"(?:[^\"\\\\]|\\\\.)*\"|`[^`]*`")
+	// Keys may contain dashes, like flag names do, and end with an index, like `list[0]`
+	referencePattern = regexp.MustCompile(`(^|[^\w.$])(` + strings.Join(Namespaces, "|") + `)\.([A-Za-z0-9_][A-Za-z0-9_\-]*(?:\[\d+\])?)`)
+)
+
+// Action is an action of a script template that outputs a value.
+type Action struct {
+	Text string
+	Line int
+	// Whether the action is inside a string literal of the script: `unquoted`, `single`, `double`,
+	// `backtick`, or a heredoc body, `heredoc` or `quoted-heredoc`
+	Context string
+	// Whether the action is inside a command substitution that is itself inside a string literal or
+	// heredoc, like `"$(echo {{args.name}})"`, where it's quoted for the nested command
+	Substitution bool
+	// Whether the value is explicitly inserted without escaping
+	Raw bool
+}
+
+var (
+	// Actions that don't output anything
+	controlActionPattern = regexp.MustCompile(`^(/\*|(if|else|end|range|with|define|template|block|break|continue)\b|\$\w*\s*:?=)`)
+	rawPattern           = regexp.MustCompile(`(^|[\s(|])raw\b`)
+	// Fields of the dot, like `.Names` or `.`, which cmdeagle's values are never referenced as
+	dotPattern     = regexp.MustCompile(`(^|[^\w)\]])\.`)
+	keywordPattern = regexp.MustCompile(`^[a-z]+\b`)
+)
+
+// block is a block opened by an action, like `{{if ...}}` or `{{range ...}}`.
+type block struct {
+	// Whether the block belongs to the script's template rather than to another tool's
+	own bool
+	// Whether the dot inside the block is one of the script's values, as in `{{range args.list}}`
+	ownDot bool
+}
+
+// isOwnAction reports whether an action belongs to the script's template. Scripts often hold templates
+// of other tools, like `docker ps --format '{{.Names}}'`, whose actions refer to fields of the dot. Those
+// are left alone, unless they're inside a block of the script that sets the dot to one of its values.
+func isOwnAction(body string, blocks []block) bool {
+	if strings.HasPrefix(body, "/*") {
+		return true
+	}
+
+	switch keywordPattern.FindString(body) {
+	case "else", "end", "break", "continue":
+		if len(blocks) > 0 {
+			return blocks[len(blocks)-1].own
+		}
+	}
+
+	code := literalPattern.ReplaceAllString(body, `""`)
+	if referencePattern.MatchString(code) {
+		return true
+	}
+	if dotPattern.MatchString(code) {
+		return len(blocks) > 0 && blocks[len(blocks)-1].ownDot
+	}
+	return true
+}
+
+// rewrite prepares a script for text/template. References to `namespace.key` inside actions become calls
+// of the `ref` function, since keys like `dry-run` or `list[0]` aren't valid template syntax, and actions
+// of other tools' templates become string literals of themselves, as told by isOwnAction. Unless
+// quoting is QuoteNone, the output of every action is piped through `autoquote` so values are escaped for
+// the position they're inserted at: a value inside a command substitution is quoted for the nested
+// command even when the substitution is inside a string. It returns the rewritten script along with the
+// references and the output actions it found.
+func rewrite(script string, quoting Quoting) (string, []Reference, []Action) {
+	refs := []Reference{}
+	actions := []Action{}
+
+	var out strings.Builder
+	scanner := newScanner(quoting)
+	blocks := []block{}
+	last := 0
+
+	for _, loc := range actionPattern.FindAllStringSubmatchIndex(script, -1) {
+		text := script[last:loc[0]]
+		out.WriteString(text)
+		scanner.scan(text)
+		scanner.action()
+		last = loc[1]
+
+		body := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(script[loc[2]:loc[3]], "-"), "-"))
+		own := isOwnAction(body, blocks)
+		switch keywordPattern.FindString(body) {
+		case "if":
+			ownDot := len(blocks) > 0 && blocks[len(blocks)-1].ownDot
+			blocks = append(blocks, block{own: own, ownDot: ownDot})
+		case "range", "with", "define", "block":
+			blocks = append(blocks, block{own: own, ownDot: own})
+		case "end":
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+		}
+		if !own {
+			out.WriteString("{{" + strconv.Quote(script[loc[0]:loc[1]]) + "}}")
+			continue
+		}
+
+		inner := rewriteReferences(script[loc[2]:loc[3]], &refs)
+
+		trimLeft, trimRight := "", ""
+		if strings.HasPrefix(inner, "- ") {
+			trimLeft, inner = "- ", inner[2:]
+		}
+		if strings.HasSuffix(inner, " -") {
+			trimRight, inner = " -", inner[:len(inner)-2]
+		}
+
+		if body := strings.TrimSpace(inner); !controlActionPattern.MatchString(body) {
+			actions = append(actions, Action{
+				Text:         script[loc[0]:loc[1]],
+				Line:         strings.Count(script[:loc[0]], "\n") + 1,
+				Context:      scanner.context(),
+				Substitution: scanner.substitution(),
+				Raw:          rawPattern.MatchString(body),
+			})
+
+			if quoting != QuoteNone {
+				inner = fmt.Sprintf("(%s) | autoquote %q %q", body, scanner.context(), scanner.delimiter())
+			}
+		}
+
+		out.WriteString("{{" + trimLeft + inner + trimRight + "}}")
+	}
+	out.WriteString(script[last:])
+
+	return out.String(), refs, actions
+}
+
+func rewriteReferences(action string, refs *[]Reference) string {
+	var out strings.Builder
+	last := 0
+
+	rewriteCode := func(code string) {
+		out.WriteString(referencePattern.ReplaceAllStringFunc(code, func(match string) string {
+			parts := referencePattern.FindStringSubmatch(match)
+			ref := Reference{Namespace: parts[2], Key: parts[3]}
+			*refs = append(*refs, ref)
+			return fmt.Sprintf("%s(ref %q %q)", parts[1], ref.Namespace, ref.Key)
+		}))
+	}
+
+	for _, loc := range literalPattern.FindAllStringIndex(action, -1) {
+		rewriteCode(action[last:loc[0]])
+		out.WriteString(action[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	rewriteCode(action[last:])
+
+	return out.String()
+}
+
+func parse(script string, quoting Quoting, ref func(namespace string, key string) (any, error)) (*template.Template, []Reference, []Action, error) {
+	rewritten, refs, actions := rewrite(script, quoting)
+
+	funcs := template.FuncMap{
+		"ref": ref,
+		"autoquote": func(context string, delimiter string, value any) (string, error) {
+			escaped := escape(quoting, context, value)
+			if delimiter != "" {
+				if err := checkHeredocValue(delimiter, escaped); err != nil {
+					return "", err
+				}
+			}
+			return escaped, nil
+		},
+	}
+	for name, fn := range Funcs {
+		funcs[name] = fn
+	}
+
+	tmpl, err := template.New("script").Option("missingkey=error").Funcs(funcs).Parse(rewritten)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	return tmpl, refs, actions, nil
+}
+
+// References parses a script and returns the references it makes, so they can be checked before the
+// script ever runs.
+func References(script string) ([]Reference, error) {
+	_, refs, _, err := parse(script, QuoteNone, func(string, string) (any, error) { return nil, nil })
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// OutputActions parses a script and returns the actions that insert values into it.
+func OutputActions(script string, quoting Quoting) ([]Action, error) {
+	_, _, actions, err := parse(script, quoting, func(string, string) (any, error) { return nil, nil })
+	if err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// Render executes a template against the context, inserting values as they are. Referencing a value that
+// doesn't exist is an error rather than leaving the placeholder in place.
+func Render(script string, ctx Context) (string, error) {
+	return RenderScript(script, ctx, QuoteNone)
+}
+
+// RenderScript executes a script template against the context, escaping every inserted value for the
+// given quoting unless it's marked with `raw`.
+func RenderScript(script string, ctx Context, quoting Quoting) (string, error) {
+	if !strings.Contains(script, "{{") {
+		return script, nil
+	}
+
+	tmpl, _, _, err := parse(script, quoting, func(namespace string, key string) (any, error) {
+		return ctx.Lookup(Reference{Namespace: namespace, Key: key})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, map[string]map[string]any(ctx)); err != nil {
+		var undefinedErr *UndefinedError
+		if errors.As(err, &undefinedErr) {
+			return "", undefinedErr
+		}
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// CheckReferences returns an error for the first reference in the script to a key that isn't known. Only
+// the namespaces present in `known` are checked.
+func CheckReferences(script string, known map[string][]string) error {
+	refs, err := References(script)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		keys, checked := known[ref.Namespace]
+		if !checked {
+			continue
+		}
+
+		if !isKnownKey(keys, ref.Key) {
+			sort.Strings(keys)
+			return fmt.Errorf("%w. Known %s are: %s", &UndefinedError{Ref: ref}, ref.Namespace, strings.Join(keys, ", "))
+		}
+	}
+
+	return nil
+}
+
+func isKnownKey(keys []string, key string) bool {
+	// Any index into a list is accepted since the number of values is only known at runtime
+	base, _, indexed := strings.Cut(key, "[")
+
+	for _, known := range keys {
+		if known == key || (indexed && known == base) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,129 @@
+package interpolation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	ctx := NewContext()
+	ctx.Set("args.name", "O'Brien")
+	ctx.Set("args.list[0]", "O'Brien")
+	ctx.Set("args.list", []any{"a", "b c"})
+	ctx.Set("flags.dry-run", true)
+	ctx.Set("flags.greeting", "")
+	ctx.Set("cli.name", "mycli")
+
+	tests := []struct {
+		name     string
+		script   string
+		expected string
+	}{
+		{"keeps the original syntax", "echo {{args.name}} from {{cli.name}}", "echo O'Brien from mycli"},
+		{"supports dashes and indexes", "{{flags.dry-run}} {{args.list[0]}}", "true O'Brien"},
+		{"supports conditionals", "{{if flags.dry-run}}echo{{else}}rm{{end}}", "echo"},
+		{"supports defaults", `{{flags.greeting | default "hello"}}`, "hello"},
+		{"quotes for the shell", "echo {{shellquote args.name}}", `echo 'O'\''Brien'`},
+		{"quotes lists item by item", "ls {{args.list | shellquote}}", `ls 'a' 'b c'`},
+		{"joins lists", `{{args.list | join ","}}`, "a,b c"},
+		{"loops over lists", "{{range args.list}}[{{.}}]{{end}}", "[a][b c]"},
+		{"encodes json", "{{json args.list}}", `["a","b c"]`},
+		{"changes case", "{{upper cli.name}}", "MYCLI"},
+		{"leaves string literals alone", `{{"args.name"}}`, "args.name"},
+		{"leaves scripts without actions alone", "echo ${HOME}", "echo ${HOME}"},
+		{"doesn't depend on the order of values", "{{args.name}}{{args.list[0]}}", "O'BrienO'Brien"},
+		{"leaves other tools' templates alone", `docker ps --format '{{.Names}}\t{{json .Labels}}'`, `docker ps --format '{{.Names}}\t{{json .Labels}}'`},
+		{"leaves other tools' blocks alone", "{{range .items}}{{.name}}{{else}}none{{end}}", "{{range .items}}{{.name}}{{else}}none{{end}}"},
+		{"renders values inside other tools' blocks", "{{with .x}}{{cli.name}}{{end}}", "{{with .x}}mycli{{end}}"},
+		{"leaves other tools' templates inside blocks alone", "{{if flags.dry-run}}-f '{{.ID}}'{{end}}", "-f '{{.ID}}'"},
+		{"supports literal braces", `{{"{{"}}x}}`, "{{x}}"},
+		{"ignores comments", "{{/* not .Names */}}x", "x"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := Render(test.script, ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+
+	t.Run("reports undefined references", func(t *testing.T) {
+		_, err := Render("echo {{args.typo}}", ctx)
+		assert.EqualError(t, err, "undefined reference `args.typo`")
+	})
+
+	t.Run("reports syntax errors", func(t *testing.T) {
+		_, err := Render("echo {{if args.name}}", ctx)
+		assert.ErrorContains(t, err, "invalid template")
+	})
+}
+
+func TestCheckReferences(t *testing.T) {
+	known := map[string][]string{
+		"args":  {"name", "list"},
+		"flags": {"dry-run"},
+	}
+
+	assert.NoError(t, CheckReferences("{{args.name}} {{args.list[3]}} {{flags.dry-run}}", known))
+	// Namespaces that aren't known aren't checked
+	assert.NoError(t, CheckReferences("{{cli.anything}}", known))
+
+	err := CheckReferences("{{if flags.dryrun}}x{{end}}", known)
+	assert.ErrorContains(t, err, "undefined reference `flags.dryrun`")
+	assert.ErrorContains(t, err, "Known flags are: dry-run")
+}
+
+func TestRenderScript(t *testing.T) {
+	ctx := NewContext()
+	ctx.Set("args.name", "$(rm -rf ~); it's \"quoted\"")
+	ctx.Set("args.list", []any{"a b", "c"})
+	ctx.Set("flags.dry-run", true)
+
+	tests := []struct {
+		name     string
+		quoting  Quoting
+		script   string
+		expected string
+	}{
+		{"quotes unquoted values for sh", QuotePOSIX, "echo {{args.name}}", `echo '$(rm -rf ~); it'\''s "quoted"'`},
+		{"quotes lists word by word for sh", QuotePOSIX, "ls {{args.list}}", `ls 'a b' 'c'`},
+		{"escapes inside double quotes for sh", QuotePOSIX, `echo "Hi {{args.name}}"`, `echo "Hi \$(rm -rf ~); it's \"quoted\""`},
+		{"escapes inside single quotes for sh", QuotePOSIX, `echo 'Hi {{args.name}}'`, `echo 'Hi $(rm -rf ~); it'\''s "quoted"'`},
+		{"ignores apostrophes in comments", QuotePOSIX, "# don't\necho {{args.list}}", "# don't\necho 'a b' 'c'"},
+		{"doesn't quote control actions", QuotePOSIX, "{{if flags.dry-run}}echo{{end}}", "echo"},
+		{"doesn't quote raw values", QuotePOSIX, "{{raw args.list}}", "a b c"},
+		{"doesn't quote twice", QuotePOSIX, "echo {{shellquote args.list}}", `echo 'a b' 'c'`},
+		{"quotes for pwsh", QuotePowerShell, "Write-Output {{args.name}}", `Write-Output '$(rm -rf ~); it''s "quoted"'`},
+		{"escapes inside double quotes for pwsh", QuotePowerShell, `"{{args.name}}"`, "\"`$(rm -rf ~); it's `\"quoted`\"\""},
+		{"inserts literals for languages", QuoteLiteral, "console.log({{args.name}})", `console.log("$(rm -rf ~); it's \"quoted\"")`},
+		{"inserts lists as arrays", QuoteLiteral, "print({{args.list}})", `print(["a b","c"])`},
+		{"escapes inside single quoted literals", QuoteLiteral, "print('{{args.name}}')", `print('$(rm -rf ~); it\'s "quoted"')`},
+		{"escapes inside template literals", QuoteLiteral, "`${x} {{args.list}}`", "`${x} a b c`"},
+		{"leaves other tools' templates alone", QuotePOSIX, `kubectl get pods -o go-template='{{range .items}}{{.metadata.name}} {{end}}' {{args.list}}`, `kubectl get pods -o go-template='{{range .items}}{{.metadata.name}} {{end}}' 'a b' 'c'`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := RenderScript(test.script, ctx, test.quoting)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestOutputActions(t *testing.T) {
+	actions, err := OutputActions("echo {{raw args.a}}\necho \"{{raw args.b}}\" {{args.c}}{{if args.d}}{{end}}", QuotePOSIX)
+	assert.NoError(t, err)
+	assert.Equal(t, []Action{
+		{Text: "{{raw args.a}}", Line: 1, Context: ContextUnquoted, Raw: true},
+		{Text: "{{raw args.b}}", Line: 2, Context: ContextDouble, Raw: true},
+		{Text: "{{args.c}}", Line: 2, Context: ContextUnquoted, Raw: false},
+	}, actions)
+
+	// Actions of other tools' templates aren't the script's
+	actions, err = OutputActions("docker ps --format {{.Names}}", QuotePOSIX)
+	assert.NoError(t, err)
+	assert.Empty(t, actions)
+}
@@ -0,0 +1,352 @@
+package output
+
+import (
+	"bytes"
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/x/term"
+	"gopkg.in/yaml.v3"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+//go:embed *
+var PackageFS embed.FS
+
+// JSON is the only format scripts can print their output in, as declared by a command's `output` setting.
+const JSON = "json"
+
+// Formats the output of a command can be rendered in, as chosen with `--output`
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatCSV   = "csv"
+	// Renders the output with a Go template, given as `template=<template>`
+	FormatTemplate = "template"
+)
+
+// Renderer renders the JSON a script printed in one of the formats of `--output`.
+type Renderer struct {
+	format   string
+	template *template.Template
+	columns  []column
+	// Whether tables are drawn with borders and colors, rather than as plain aligned text
+	styled bool
+}
+
+type column struct {
+	field  string
+	header string
+	format *template.Template
+}
+
+// NewRenderer creates a renderer for the value of the `--output` flag, which defaults to a table. Tables
+// are styled when they're shown on a terminal.
+func NewRenderer(format string, columnDefs []types.ColumnDefinition, styled bool) (*Renderer, error) {
+	renderer := &Renderer{format: format, styled: styled}
+	if format == "" {
+		renderer.format = FormatTable
+	}
+
+	if name, text, ok := strings.Cut(format, "="); ok && name == FormatTemplate {
+		tmpl, err := template.New("output").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output template: %w", err)
+		}
+		renderer.format = FormatTemplate
+		renderer.template = tmpl
+	}
+
+	switch renderer.format {
+	case FormatTable, FormatJSON, FormatYAML, FormatCSV, FormatTemplate:
+	default:
+		return nil, fmt.Errorf("output must be %s, %s, %s, %s or %s=<go-template>, got %q", FormatTable, FormatJSON, FormatYAML, FormatCSV, FormatTemplate, format)
+	}
+
+	columns, err := parseColumns(columnDefs)
+	if err != nil {
+		return nil, err
+	}
+	renderer.columns = columns
+
+	return renderer, nil
+}
+
+// ValidateColumns checks the `columns` of a command, including the templates of their formats.
+func ValidateColumns(columnDefs []types.ColumnDefinition) error {
+	_, err := parseColumns(columnDefs)
+	return err
+}
+
+func parseColumns(columnDefs []types.ColumnDefinition) ([]column, error) {
+	columns := make([]column, 0, len(columnDefs))
+	for i, def := range columnDefs {
+		if strings.TrimSpace(def.Field) == "" {
+			return nil, fmt.Errorf("column %d needs a field", i+1)
+		}
+
+		col := column{field: def.Field, header: def.Header}
+		if col.header == "" {
+			col.header = def.Field
+		}
+
+		if def.Format != "" {
+			tmpl, err := template.New(def.Field).Parse(def.Format)
+			if err != nil {
+				return nil, fmt.Errorf("invalid format of column %s: %w", def.Field, err)
+			}
+			col.format = tmpl
+		}
+
+		columns = append(columns, col)
+	}
+
+	return columns, nil
+}
+
+// IsTerminal reports whether a file, usually stdout, is a terminal.
+func IsTerminal(file *os.File) bool {
+	return term.IsTerminal(file.Fd())
+}
+
+// Render decodes the JSON a script printed and writes it to w in the renderer's format.
+func (renderer *Renderer) Render(w io.Writer, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keeps numbers as they were printed, rather than turning large ones into floats
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("the start script didn't print valid JSON: %w", err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("the start script printed more than one JSON value")
+	}
+
+	switch renderer.format {
+	case FormatJSON:
+		out, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", out)
+		return err
+
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(yamlNumbers(value)); err != nil {
+			return err
+		}
+		return encoder.Close()
+
+	case FormatTemplate:
+		return renderer.template.Execute(w, value)
+	}
+
+	headers, rows, err := renderer.table(value)
+	if err != nil {
+		return err
+	}
+
+	if renderer.format == FormatCSV {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(headers); err != nil {
+			return err
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	}
+
+	if renderer.styled {
+		headerStyle := lipgloss.NewStyle().Bold(true).Padding(0, 1)
+		cellStyle := lipgloss.NewStyle().Padding(0, 1)
+		styledTable := table.New().
+			Border(lipgloss.RoundedBorder()).
+			BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("8"))).
+			StyleFunc(func(row, col int) lipgloss.Style {
+				if row == 0 {
+					return headerStyle
+				}
+				return cellStyle
+			}).
+			Headers(headers...).
+			Rows(rows...)
+		_, err := fmt.Fprintln(w, styledTable.Render())
+		return err
+	}
+
+	var aligned strings.Builder
+	tabWriter := tabwriter.NewWriter(&aligned, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tabWriter, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tabWriter, strings.Join(row, "\t"))
+	}
+	if err := tabWriter.Flush(); err != nil {
+		return err
+	}
+
+	// Rows whose last cells are empty are padded all the same
+	for _, line := range strings.SplitAfter(aligned.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line, " \n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// yamlNumbers turns the numbers of a decoded JSON value into YAML numbers, which would otherwise be
+// encoded as strings.
+func yamlNumbers(value any) any {
+	switch typed := value.(type) {
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(string(typed), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(typed)}
+	case map[string]any:
+		converted := make(map[string]any, len(typed))
+		for key, item := range typed {
+			converted[key] = yamlNumbers(item)
+		}
+		return converted
+	case []any:
+		converted := make([]any, len(typed))
+		for i, item := range typed {
+			converted[i] = yamlNumbers(item)
+		}
+		return converted
+	default:
+		return value
+	}
+}
+
+// table turns the output into rows, one per item of an array or a single one for anything else, and
+// picks the cells of the columns from them. Without declared columns, every field of the rows is shown.
+func (renderer *Renderer) table(value any) ([]string, [][]string, error) {
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+
+	columns := renderer.columns
+	if len(columns) == 0 {
+		columns = inferColumns(items)
+	}
+
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = col.header
+	}
+
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			cell, err := col.render(lookup(item, col.field))
+			if err != nil {
+				return nil, nil, err
+			}
+			row[i] = cell
+		}
+		rows = append(rows, row)
+	}
+
+	return headers, rows, nil
+}
+
+// inferColumns returns a column for every field of the rows, in alphabetical order, or a single `value`
+// column when the rows aren't objects.
+func inferColumns(items []any) []column {
+	seen := map[string]bool{}
+	fields := []string{}
+	for _, item := range items {
+		object, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		for field := range object {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	sort.Strings(fields)
+
+	if len(fields) == 0 {
+		return []column{{header: "value"}}
+	}
+
+	columns := make([]column, len(fields))
+	for i, field := range fields {
+		columns[i] = column{field: field, header: field}
+	}
+	return columns
+}
+
+// lookup returns the value at a dotted path in a decoded JSON value, where numbers index arrays. An
+// empty path returns the value itself.
+func lookup(value any, path string) any {
+	if path == "" {
+		return value
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch typed := value.(type) {
+		case map[string]any:
+			value = typed[key]
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(typed) {
+				return nil
+			}
+			value = typed[index]
+		default:
+			return nil
+		}
+	}
+
+	return value
+}
+
+func (col column) render(value any) (string, error) {
+	if col.format != nil {
+		var out strings.Builder
+		if err := col.format.Execute(&out, value); err != nil {
+			return "", fmt.Errorf("failed to format column %s: %w", col.header, err)
+		}
+		return out.String(), nil
+	}
+
+	switch typed := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return typed, nil
+	case map[string]any, []any:
+		out, err := json.Marshal(typed)
+		return string(out), err
+	default:
+		return fmt.Sprint(typed), nil
+	}
+}
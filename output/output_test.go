@@ -0,0 +1,89 @@
+package output
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+const repos = `[
+	{"name": "cmdeagle", "stars": 120, "owner": {"login": "migsc"}, "topics": ["cli", "go"]},
+	{"name": "other, \"quoted\"", "stars": 12345678901234567890, "owner": {"login": "someone"}}
+]`
+
+func render(t *testing.T, format string, columns []types.ColumnDefinition, data string) string {
+	t.Helper()
+
+	renderer, err := NewRenderer(format, columns, false)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, renderer.Render(&out, []byte(data)))
+	return out.String()
+}
+
+func TestRenderTable(t *testing.T) {
+	columns := []types.ColumnDefinition{
+		{Field: "name", Header: "NAME"},
+		{Field: "owner.login", Header: "OWNER"},
+		{Field: "stars", Format: "{{.}}★"},
+	}
+
+	assert.Equal(t, `NAME              OWNER     stars
+cmdeagle          migsc     120★
+other, "quoted"   someone   12345678901234567890★
+`, render(t, "", columns, repos))
+}
+
+func TestRenderInferredColumns(t *testing.T) {
+	assert.Equal(t, `name              owner                 stars                  topics
+cmdeagle          {"login":"migsc"}     120                    ["cli","go"]
+other, "quoted"   {"login":"someone"}   12345678901234567890
+`, render(t, FormatTable, nil, repos), "fields are sorted, and nested values shown as JSON")
+
+	assert.Equal(t, "value\na\nb\n", render(t, FormatTable, nil, `["a", "b"]`))
+	assert.Equal(t, "id   ok\n7    true\n", render(t, FormatTable, nil, `{"id": 7, "ok": true}`), "an object is a single row")
+}
+
+func TestRenderFormats(t *testing.T) {
+	columns := []types.ColumnDefinition{{Field: "name"}, {Field: "stars"}}
+
+	assert.Equal(t, "name,stars\ncmdeagle,120\n\"other, \"\"quoted\"\"\",12345678901234567890\n", render(t, FormatCSV, columns, repos))
+
+	assert.Equal(t, "{\n  \"id\": 12345678901234567890\n}\n", render(t, FormatJSON, columns, `{"id":12345678901234567890}`), "large numbers are kept")
+
+	assert.Equal(t, "- id: 1\n  ratio: 0.5\n  tags:\n    - a\n", render(t, FormatYAML, nil, `[{"id": 1, "ratio": 0.5, "tags": ["a"]}]`))
+
+	assert.Equal(t, "cmdeagle by migsc\nother, \"quoted\" by someone\n",
+		render(t, `template={{range .}}{{.name}} by {{.owner.login}}{{"\n"}}{{end}}`, nil, repos))
+}
+
+func TestRenderStyledTable(t *testing.T) {
+	renderer, err := NewRenderer(FormatTable, []types.ColumnDefinition{{Field: "name"}}, true)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, renderer.Render(&out, []byte(repos)))
+	assert.Contains(t, out.String(), "╭")
+	assert.Contains(t, out.String(), "cmdeagle")
+}
+
+func TestRenderErrors(t *testing.T) {
+	_, err := NewRenderer("xml", nil, false)
+	assert.EqualError(t, err, `output must be table, json, yaml, csv or template=<go-template>, got "xml"`)
+
+	_, err = NewRenderer("template={{.name", nil, false)
+	assert.ErrorContains(t, err, "invalid output template")
+
+	assert.EqualError(t, ValidateColumns([]types.ColumnDefinition{{Header: "Name"}}), "column 1 needs a field")
+	assert.ErrorContains(t, ValidateColumns([]types.ColumnDefinition{{Field: "x", Format: "{{"}}), "invalid format of column x")
+
+	renderer, err := NewRenderer(FormatJSON, nil, false)
+	require.NoError(t, err)
+	assert.ErrorContains(t, renderer.Render(&strings.Builder{}, []byte("not json")), "didn't print valid JSON")
+	assert.EqualError(t, renderer.Render(&strings.Builder{}, []byte("{} {}")), "the start script printed more than one JSON value")
+}
@@ -0,0 +1,228 @@
+package params
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/migsc/cmdeagle/types"
+
+	"github.com/charmbracelet/log"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed messages/*.yaml
+var builtinCatalogFS embed.FS
+
+var DefaultLocale = "en"
+
+// MessageCatalog holds the message templates used to render validation errors, keyed by constraint name
+// (e.g. `in`, `min-length`, `file-exists`).
+type MessageCatalog struct {
+	Locale  string
+	entries map[string]string
+}
+
+// Messages is the catalog used when rendering a ConstraintError. It starts out with the built-in English
+// messages and can be switched to another locale with LoadLocale.
+var Messages = NewMessageCatalog()
+
+func NewMessageCatalog() *MessageCatalog {
+	catalog := &MessageCatalog{
+		Locale:  DefaultLocale,
+		entries: make(map[string]string),
+	}
+
+	if err := catalog.loadFile(builtinCatalogFS, path.Join("messages", DefaultLocale+".yaml")); err != nil {
+		panic(fmt.Sprintf("failed to load built-in message catalog: %v", err))
+	}
+
+	return catalog
+}
+
+func (catalog *MessageCatalog) Get(key string) string {
+	return catalog.entries[key]
+}
+
+func (catalog *MessageCatalog) Set(key string, message string) {
+	catalog.entries[key] = message
+}
+
+// Merge overrides the catalog's messages with the given entries.
+func (catalog *MessageCatalog) Merge(entries map[string]string) {
+	for key, message := range entries {
+		catalog.entries[key] = message
+	}
+}
+
+// LoadLocale layers the messages for the given locale on top of the English defaults. The built-in catalogs
+// are consulted first, followed by any `<locale>.yaml` files the CLI bundled in `dir` of `fsys`. Both the
+// language (`de`) and the full locale (`de_CH`) are tried so a CLI can ship regional overrides.
+func (catalog *MessageCatalog) LoadLocale(locale string, fsys fs.FS, dir string) error {
+	catalog.Locale = locale
+
+	for _, name := range localeCandidates(locale) {
+		if err := catalog.loadFile(builtinCatalogFS, path.Join("messages", name+".yaml")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if fsys == nil || dir == "" {
+		return nil
+	}
+
+	for _, name := range localeCandidates(locale) {
+		if err := catalog.loadFile(fsys, path.Join(dir, name+".yaml")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (catalog *MessageCatalog) loadFile(fsys fs.FS, filePath string) error {
+	content, err := fs.ReadFile(fsys, filePath)
+	if err != nil {
+		return err
+	}
+
+	entries := map[string]string{}
+	if err := yaml.Unmarshal(content, &entries); err != nil {
+		return fmt.Errorf("error parsing message catalog %s: %w", filePath, err)
+	}
+
+	log.Debug("Loaded message catalog", "path", filePath, "entries", len(entries))
+	catalog.Merge(entries)
+
+	return nil
+}
+
+// Render executes the message template for the given constraint against the error's data.
+func (catalog *MessageCatalog) Render(key string, override string, data any) string {
+	message := override
+	if message == "" {
+		message = catalog.Get(key)
+	}
+	if message == "" {
+		message = fmt.Sprintf("{{.Name}}: failed the `%s` constraint", key)
+	}
+
+	tmpl, err := template.New(key).Parse(message)
+	if err != nil {
+		log.Debug("Invalid message template", "constraint", key, "error", err)
+		return message
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		log.Debug("Failed to render message template", "constraint", key, "error", err)
+		return message
+	}
+
+	return out.String()
+}
+
+// DetectLocale determines the user's locale from the environment the same way gettext does, with LC_ALL
+// taking precedence over LC_MESSAGES and LANG. Encodings and modifiers are stripped, so `de_DE.UTF-8`
+// becomes `de_DE`.
+func DetectLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+
+		if i := strings.IndexAny(value, ".@"); i >= 0 {
+			value = value[:i]
+		}
+
+		if value == "C" || value == "POSIX" || value == "" {
+			return DefaultLocale
+		}
+
+		return value
+	}
+
+	return DefaultLocale
+}
+
+// localeCandidates returns the catalog names to try for a locale, from least to most specific.
+func localeCandidates(locale string) []string {
+	locale = strings.ReplaceAll(locale, "-", "_")
+	language, _, hasRegion := strings.Cut(locale, "_")
+
+	if !hasRegion {
+		return []string{language}
+	}
+
+	return []string{language, locale}
+}
+
+// ConstraintError is returned when a value fails one of its constraints. Its message is rendered from the
+// constraint's own `message` template when set, or from the active message catalog otherwise.
+type ConstraintError struct {
+	Constraint string // Name of the failing constraint, as used in the config and catalog
+	Name       string // Name of the argument or flag being validated
+	Value      any
+	Expected   any
+	Reason     string // Extra detail for constraints that have one
+	Message    string // Custom message template from the config
+}
+
+func newConstraintError(constraints *types.ParamConstraints, constraint string, value any, expected any) *ConstraintError {
+	err := &ConstraintError{
+		Constraint: constraint,
+		Value:      value,
+		Expected:   expected,
+	}
+	if constraints != nil {
+		err.Message = constraints.Message
+	}
+	return err
+}
+
+func (err *ConstraintError) Error() string {
+	data := *err
+	if data.Name == "" {
+		data.Name = "value"
+	}
+	return Messages.Render(err.Constraint, err.Message, data)
+}
+
+// NameError sets the parameter name on a ConstraintError that doesn't have one yet, so the rendered
+// message can refer to the argument or flag that failed.
+func NameError(err error, name string) error {
+	var constraintErr *ConstraintError
+	if errors.As(err, &constraintErr) && constraintErr.Name == "" {
+		constraintErr.Name = name
+	}
+	return err
+}
+
+// NewDependencyError creates an error for a `depends-on` condition that failed, named after the argument or
+// flag that depends on the other one, with the failed condition as the reason.
+func NewDependencyError(name string, dependency string, err error) error {
+	return &ConstraintError{
+		Constraint: "depends-on",
+		Name:       name,
+		Expected:   dependency,
+		Reason:     err.Error(),
+	}
+}
+
+// NewParamError creates an error for a parameter-level rule such as `required` or `conflicts-with`, rendered
+// through the message catalog like any other constraint.
+func NewParamError(constraint string, name string, value any, expected any) error {
+	return &ConstraintError{
+		Constraint: constraint,
+		Name:       name,
+		Value:      value,
+		Expected:   expected,
+	}
+}
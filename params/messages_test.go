@@ -0,0 +1,120 @@
+package params
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/migsc/cmdeagle/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstraintMessages(t *testing.T) {
+	t.Run("names the parameter in the default message", func(t *testing.T) {
+		constraints := &types.ParamConstraints{In: []any{"dev", "prod"}}
+
+		err := ValidateParamConstraint("env", constraints, "staging")
+		assert.Error(t, err)
+		assert.Equal(t, "env: value staging is not in the list of [dev prod]", err.Error())
+	})
+
+	t.Run("renders a custom message template", func(t *testing.T) {
+		constraints := &types.ParamConstraints{
+			In:      []any{"dev", "prod"},
+			Message: "{{.Name}} must be one of {{.Expected}}, not {{.Value}}",
+		}
+
+		err := ValidateParamConstraint("env", constraints, "staging")
+		assert.Error(t, err)
+		assert.Equal(t, "env must be one of [dev prod], not staging", err.Error())
+	})
+
+	t.Run("applies the custom message to registered validators", func(t *testing.T) {
+		constraints := &types.ParamConstraints{Gte: 18, Message: "{{.Name}} too small"}
+
+		err := ValidateParamConstraint("age", constraints, 12)
+		assert.Error(t, err)
+		assert.Equal(t, "age too small", err.Error())
+	})
+
+	t.Run("keeps the name of nested constraints", func(t *testing.T) {
+		minLength := 3
+		constraints := &types.ParamConstraints{
+			And: []*types.ParamConstraints{{MinLength: &minLength}},
+		}
+
+		err := ValidateParamConstraint("name", constraints, "ab")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "name: value is less than the minimum character length of 3")
+	})
+}
+
+func TestNewDependencyError(t *testing.T) {
+	inner := ValidateParamConstraint("region", &types.ParamConstraints{In: []any{"us"}}, "eu")
+	assert.Error(t, inner)
+
+	err := NewDependencyError("deploy-key", "region", inner)
+	assert.Equal(t, "deploy-key: its dependency region is invalid (region: value eu is not in the list of [us])", err.Error())
+}
+
+func TestMessageCatalog(t *testing.T) {
+	t.Cleanup(func() { Messages = NewMessageCatalog() })
+
+	t.Run("loads the built-in catalog for a locale", func(t *testing.T) {
+		Messages = NewMessageCatalog()
+		assert.NoError(t, Messages.LoadLocale("de_DE", nil, ""))
+
+		err := NewParamError("required", "name", nil, nil)
+		assert.Equal(t, "fehlender Pflichtwert: name", err.Error())
+	})
+
+	t.Run("layers bundled catalogs over the built-in ones", func(t *testing.T) {
+		bundleFS := fstest.MapFS{
+			"locales/de.yaml":    {Data: []byte(`required: "{{.Name}} fehlt"`)},
+			"locales/de_CH.yaml": {Data: []byte(`conflicts-with: "{{.Name}} und {{.Expected}} gehen nicht zusammen"`)},
+		}
+
+		Messages = NewMessageCatalog()
+		assert.NoError(t, Messages.LoadLocale("de_CH", bundleFS, "locales"))
+
+		assert.Equal(t, "name fehlt", NewParamError("required", "name", nil, nil).Error())
+		assert.Equal(t, "a und b gehen nicht zusammen", NewParamError("conflicts-with", "a", nil, "b").Error())
+		// Falls back to the built-in German catalog for everything else
+		assert.Contains(t, NewParamError("pattern", "a", "x", "^y$").Error(), "entspricht nicht dem Muster")
+	})
+
+	t.Run("falls back to English for unknown locales", func(t *testing.T) {
+		Messages = NewMessageCatalog()
+		assert.NoError(t, Messages.LoadLocale("xx", nil, ""))
+
+		assert.Equal(t, "missing required value: name", NewParamError("required", "name", nil, nil).Error())
+	})
+
+	t.Run("rejects malformed catalogs", func(t *testing.T) {
+		bundleFS := fstest.MapFS{"locales/fr.yaml": {Data: []byte("- not a map")}}
+
+		Messages = NewMessageCatalog()
+		assert.Error(t, Messages.LoadLocale("fr", bundleFS, "locales"))
+	})
+}
+
+func TestDetectLocale(t *testing.T) {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value, ok := os.LookupEnv(name)
+		os.Unsetenv(name)
+		if ok {
+			t.Cleanup(func() { os.Setenv(name, value) })
+		}
+	}
+
+	assert.Equal(t, "en", DetectLocale())
+
+	t.Setenv("LANG", "de_DE.UTF-8")
+	assert.Equal(t, "de_DE", DetectLocale())
+
+	t.Setenv("LC_MESSAGES", "fr_FR@euro")
+	assert.Equal(t, "fr_FR", DetectLocale())
+
+	t.Setenv("LC_ALL", "C")
+	assert.Equal(t, "en", DetectLocale())
+}
@@ -0,0 +1,86 @@
+package params
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted is shown in place of the value of a secret argument or flag.
+const Redacted = "***"
+
+// minSecretLength is the length below which values aren't masked in text, since they'd match unrelated
+// text like `exit status 1`. The fields that hold secrets are masked whatever their length.
+const minSecretLength = 4
+
+var (
+	secrets   []string
+	secretsMu sync.RWMutex
+)
+
+// AddSecret registers the value of a secret argument or flag, so that Redact masks it from then on. Short
+// values and ones like `true` are left out, since they're as likely to be any other word of the text.
+func AddSecret(value string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	// Multi-line secrets are also masked line by line, since logs may split them
+	values := append([]string{value}, strings.Split(value, "\n")...)
+	for _, value := range values {
+		if isTrivialSecret(value) {
+			continue
+		}
+		secrets = append(secrets, value)
+	}
+
+	// The longest values are masked first, so a secret that contains another is masked as a whole
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// ResetSecrets forgets the secrets registered so far.
+func ResetSecrets() {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secrets = nil
+}
+
+func isTrivialSecret(value string) bool {
+	trimmed := strings.TrimSpace(value)
+	if len(trimmed) < minSecretLength {
+		return true
+	}
+	switch strings.ToLower(trimmed) {
+	case "true", "false", "null", "none":
+		return true
+	}
+	return false
+}
+
+// Redact masks the values of every secret registered so far.
+func Redact(text string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, Redacted)
+	}
+	return text
+}
+
+// RedactWriter masks secrets in everything written to w. Each write is masked on its own, which suits
+// writers that receive whole lines, like loggers.
+func RedactWriter(w io.Writer) io.Writer {
+	return &redactWriter{w: w}
+}
+
+type redactWriter struct {
+	w io.Writer
+}
+
+func (writer *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(writer.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
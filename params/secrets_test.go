@@ -0,0 +1,47 @@
+package params
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	defer ResetSecrets()
+
+	AddSecret("")
+	AddSecret("tok-123")
+	AddSecret("tok-123-456")
+	AddSecret("first line\nsecond line")
+
+	assert.Equal(t, "key=*** and ***", Redact("key=tok-123-456 and tok-123"), "longer secrets are masked as a whole")
+	assert.Equal(t, "*** / ***", Redact("second line / first line"), "lines of multi-line secrets are masked on their own")
+	assert.Equal(t, "nothing to hide", Redact("nothing to hide"))
+}
+
+func TestRedactSkipsTrivialValues(t *testing.T) {
+	defer ResetSecrets()
+
+	for _, value := range []string{"1", "0", "abc", "true", "False", "null", "  ab  "} {
+		AddSecret(value)
+	}
+	assert.Equal(t, "exit status 1: abc is true", Redact("exit status 1: abc is true"))
+
+	ResetSecrets()
+	AddSecret("hunter2")
+	ResetSecrets()
+	assert.Equal(t, "hunter2", Redact("hunter2"), "reset secrets are no longer masked")
+}
+
+func TestRedactWriter(t *testing.T) {
+	defer ResetSecrets()
+	AddSecret("hunter2")
+
+	var out bytes.Buffer
+	n, err := fmt.Fprint(RedactWriter(&out), "password: hunter2")
+	assert.NoError(t, err)
+	assert.Equal(t, len("password: hunter2"), n)
+	assert.Equal(t, "password: ***", out.String())
+}
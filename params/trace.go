@@ -0,0 +1,69 @@
+package params
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+// Where the value of an argument or flag came from
+const (
+	SourceCLI     = "cli"
+	SourceEnv     = "env"
+	SourceDefault = "default"
+	// Secrets can also be read from a file with `--<flag>-file` or typed in at a prompt
+	SourceFile   = "file"
+	SourcePrompt = "prompt"
+)
+
+// Check records a rule that was evaluated while validating an argument or flag, so that `--explain` can
+// show why a value was accepted or rejected.
+type Check struct {
+	Param string
+	// Names of the rules as written in the config, e.g. `required`, `pattern` or `min, max`
+	Rules string
+	Value any
+	Err   error
+}
+
+// Checks collects the rules evaluated since the last reset. Recording is off until TraceChecks is called.
+var Checks []Check
+
+var tracing bool
+
+// TraceChecks starts recording the rules that are evaluated.
+func TraceChecks() {
+	tracing = true
+	Checks = nil
+}
+
+// RecordCheck records a rule that was evaluated for a param, along with its outcome.
+func RecordCheck(param string, rules string, value any, err error) {
+	if !tracing || rules == "" {
+		return
+	}
+
+	Checks = append(Checks, Check{Param: param, Rules: rules, Value: value, Err: err})
+}
+
+// ConstraintNames lists the constraints that are set, by the names they have in the config.
+func ConstraintNames(constraints *types.ParamConstraints) string {
+	if constraints == nil {
+		return ""
+	}
+
+	names := []string{}
+	value := reflect.ValueOf(*constraints)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+
+		if name == "" || name == "message" || value.Field(i).IsZero() {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	return strings.Join(names, ", ")
+}
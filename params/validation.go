@@ -1,6 +1,7 @@
 package params
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -69,7 +70,7 @@ func init() {
 		testValAsInt, testCastErr := cast.ToIntE(rawConfigVal)
 		if inputCastErr == nil && testCastErr == nil {
 			if inputValAsInt < testValAsInt {
-				return fmt.Errorf("input value of `%f` is less than the minimum value of `%f`", rawInputVal, rawConfigVal)
+				return newConstraintError(nil, "gte", rawInputVal, rawConfigVal)
 			} else {
 				return nil
 			}
@@ -79,7 +80,7 @@ func init() {
 		testValAsFloat, testCastErr := cast.ToFloat64E(rawConfigVal)
 		if inputCastErr == nil && testCastErr == nil {
 			if inputValAsFloat < testValAsFloat {
-				return fmt.Errorf("input value of `%f` is less than the minimum value of `%f`", rawInputVal, rawConfigVal)
+				return newConstraintError(nil, "gte", rawInputVal, rawConfigVal)
 			} else {
 				return nil
 			}
@@ -90,7 +91,7 @@ func init() {
 		if inputCastErr == nil && testCastErr == nil {
 			// TODO: Compare the strings alphabetically here
 			if inputValAsStr < testValAsStr {
-				return fmt.Errorf("input value of `%s` is less than the minimum value of `%s`", rawInputVal, rawConfigVal)
+				return newConstraintError(nil, "gte", rawInputVal, rawConfigVal)
 			} else {
 				return nil
 			}
@@ -140,6 +141,14 @@ func ForEachField(obj any, fn func(fieldName string, fieldValue any) error) erro
 	return nil
 }
 
+// ValidateParamConstraint validates the value of a named argument or flag, so that any error it returns
+// refers to the parameter by name.
+func ValidateParamConstraint(name string, constraints *types.ParamConstraints, value any) error {
+	err := NameError(ValidateConstraint(constraints, value), name)
+	RecordCheck(name, ConstraintNames(constraints), value, err)
+	return err
+}
+
 // Returns a boolean and a reason in the case of failing the constraints
 func ValidateConstraint(constraints *types.ParamConstraints, value any, useMemMapFs ...bool) error {
 
@@ -162,7 +171,15 @@ func ValidateConstraint(constraints *types.ParamConstraints, value any, useMemMa
 
 		log.Debug("Validating constraint", "fieldName", fieldName, "configVal", configVal, "testFn", testFn)
 
-		return testFn(value, configVal)
+		err := testFn(value, configVal)
+
+		// Validators registered in the lookup don't know about the constraint's custom message
+		var constraintErr *ConstraintError
+		if errors.As(err, &constraintErr) && constraintErr.Message == "" {
+			constraintErr.Message = constraints.Message
+		}
+
+		return err
 	})
 
 	if err != nil {
@@ -171,13 +188,13 @@ func ValidateConstraint(constraints *types.ParamConstraints, value any, useMemMa
 
 	if constraints.Eq != nil {
 		if value != constraints.Eq {
-			return fmt.Errorf("Value is not equal to %v", constraints.Eq)
+			return newConstraintError(constraints, "eq", value, constraints.Eq)
 		}
 	}
 
 	if constraints.Gt != nil {
 		if cast.ToInt(value) <= cast.ToInt(constraints.Gt) {
-			return fmt.Errorf("Value is not greater than %v", constraints.Gt)
+			return newConstraintError(constraints, "gt", value, constraints.Gt)
 		}
 	}
 
@@ -189,37 +206,37 @@ func ValidateConstraint(constraints *types.ParamConstraints, value any, useMemMa
 
 	if constraints.Lt != nil {
 		if cast.ToInt(value) >= cast.ToInt(constraints.Lt) {
-			return fmt.Errorf("Value is not less than %v", constraints.Lt)
+			return newConstraintError(constraints, "lt", value, constraints.Lt)
 		}
 	}
 
 	if constraints.Lte != nil {
 		if cast.ToInt(value) > cast.ToInt(constraints.Lte) {
-			return fmt.Errorf("Value is not less than or equal to %v", constraints.Lte)
+			return newConstraintError(constraints, "lte", value, constraints.Lte)
 		}
 	}
 
 	if constraints.In != nil {
 		if !slices.Contains(constraints.In, value) {
-			return fmt.Errorf("Value is not in the list of %v", constraints.In)
+			return newConstraintError(constraints, "in", value, constraints.In)
 		}
 	}
 
 	if constraints.MinLength != nil {
 		if len(cast.ToString(value)) < cast.ToInt(constraints.MinLength) {
-			return fmt.Errorf("Value is less than the minimum character length of %v", constraints.MinLength)
+			return newConstraintError(constraints, "min-length", value, *constraints.MinLength)
 		}
 	}
 
 	if constraints.MaxLength != nil {
 		if len(cast.ToString(value)) > cast.ToInt(constraints.MaxLength) {
-			return fmt.Errorf("Value is greater than the maximum character length of %v", constraints.MaxLength)
+			return newConstraintError(constraints, "max-length", value, *constraints.MaxLength)
 		}
 	}
 
 	if constraints.Pattern != "" {
 		if !regexp.MustCompile(constraints.Pattern).MatchString(cast.ToString(value)) {
-			return fmt.Errorf("Value does not match pattern: %v", constraints.Pattern)
+			return newConstraintError(constraints, "pattern", value, constraints.Pattern)
 		}
 	}
 
@@ -251,7 +268,7 @@ func ValidateConstraint(constraints *types.ParamConstraints, value any, useMemMa
 		for _, constraint := range constraints.Nand {
 			err := ValidateConstraint(constraint, value)
 			if err == nil {
-				return fmt.Errorf("Validation failed on `nand` for constraint %v", constraint)
+				return newConstraintError(constraints, "nand", value, constraint)
 			}
 		}
 	}
@@ -278,7 +295,7 @@ func ValidateConstraint(constraints *types.ParamConstraints, value any, useMemMa
 	if constraints.Not != nil {
 		err := ValidateConstraint(constraints.Not, value)
 		if err == nil {
-			return fmt.Errorf("Condition is true for `not` constraint: %v", constraints.Not)
+			return newConstraintError(constraints, "not", value, constraints.Not)
 		}
 	}
 
@@ -335,7 +352,7 @@ func validateFileConstraints(fs afero.Fs, constraint *types.ParamConstraints, va
 	if constraint.DirExists != "" {
 		isDir, err := afero.IsDir(fs, filePath)
 		if err != nil || !isDir {
-			return fmt.Errorf("Value is not a directory: %v", value)
+			return newConstraintError(constraint, "dir-exists", value, constraint.DirExists)
 		}
 	}
 
@@ -343,13 +360,13 @@ func validateFileConstraints(fs afero.Fs, constraint *types.ParamConstraints, va
 	if constraint.FileExists != "" {
 		exists, err := afero.Exists(fs, filePath)
 		if err != nil || !exists {
-			return fmt.Errorf("File does not exist: %v", filePath)
+			return newConstraintError(constraint, "file-exists", filePath, constraint.FileExists)
 		}
 
 		// Verify it's not a directory
 		isDir, err := afero.IsDir(fs, filePath)
 		if err != nil || isDir {
-			return fmt.Errorf("Path is a directory, not a file: %v", filePath)
+			return newConstraintError(constraint, "file-exists-is-dir", filePath, constraint.FileExists)
 		}
 
 		// If we're only checking existence, we can return here
@@ -373,15 +390,18 @@ func validateFileConstraints(fs afero.Fs, constraint *types.ParamConstraints, va
 		}
 
 		if info.Mode().Perm() != os.FileMode(wantPerm) {
-			return fmt.Errorf("File has incorrect permissions. Want: %v, Got: %v",
-				os.FileMode(wantPerm), info.Mode().Perm())
+			err := newConstraintError(constraint, "has-permissions", filePath, os.FileMode(wantPerm))
+			err.Reason = info.Mode().Perm().String()
+			return err
 		}
 	}
 
 	// Check IsFileType constraint
 	if constraint.IsFileType != "" {
 		if err := validateFileType(fs, filePath, constraint.IsFileType); err != nil {
-			return fmt.Errorf("File type validation failed: %v", err)
+			constraintErr := newConstraintError(constraint, "is-file-type", filePath, constraint.IsFileType)
+			constraintErr.Reason = err.Error()
+			return constraintErr
 		}
 	}
 
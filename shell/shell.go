@@ -0,0 +1,125 @@
+package shell
+
+import (
+	"embed"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/migsc/cmdeagle/interpolation"
+	"github.com/migsc/cmdeagle/types"
+)
+
+//go:embed *
+var PackageFS embed.FS
+
+// DefaultShell is used when neither the command nor any of its parents declare a `shell`.
+var DefaultShell = "sh"
+
+// Interpreter describes how to hand a script to a shell or language runtime.
+type Interpreter struct {
+	Name string
+	// Arguments that precede a script given as a string, e.g. `sh -c <script>`
+	Inline []string
+	// Arguments that precede the path of a script file, e.g. `node <file>`
+	File []string
+	// How values interpolated into the interpreter's scripts are escaped
+	Quoting interpolation.Quoting
+	// Whether the first argument after an inline script becomes its name (`$0`) rather than its first
+	// argument, as with `sh -c`
+	NamedScript bool
+	// Whether inline scripts can't receive arguments, since they would become part of the script
+	NoInlineArgs bool
+}
+
+var interpreters = map[string]Interpreter{
+	"sh":         {Inline: []string{"sh", "-c"}, File: []string{"sh"}, Quoting: interpolation.QuotePOSIX, NamedScript: true},
+	"bash":       {Inline: []string{"bash", "-c"}, File: []string{"bash"}, Quoting: interpolation.QuotePOSIX, NamedScript: true},
+	"zsh":        {Inline: []string{"zsh", "-c"}, File: []string{"zsh"}, Quoting: interpolation.QuotePOSIX, NamedScript: true},
+	"pwsh":       {Inline: []string{"pwsh", "-NoProfile", "-NonInteractive", "-Command"}, File: []string{"pwsh", "-NoProfile", "-NonInteractive", "-File"}, Quoting: interpolation.QuotePowerShell, NoInlineArgs: true},
+	"powershell": {Inline: []string{"powershell", "-NoProfile", "-NonInteractive", "-Command"}, File: []string{"powershell", "-NoProfile", "-NonInteractive", "-File"}, Quoting: interpolation.QuotePowerShell, NoInlineArgs: true},
+	"node":       {Inline: []string{"node", "-e"}, File: []string{"node"}, Quoting: interpolation.QuoteLiteral},
+	"deno":       {Inline: []string{"deno", "eval"}, File: []string{"deno", "run", "--allow-all"}, Quoting: interpolation.QuoteLiteral},
+	"bun":        {Inline: []string{"bun", "-e"}, File: []string{"bun", "run"}, Quoting: interpolation.QuoteLiteral},
+	"python":     {Inline: []string{"python", "-c"}, File: []string{"python"}, Quoting: interpolation.QuoteLiteral},
+	"python3":    {Inline: []string{"python3", "-c"}, File: []string{"python3"}, Quoting: interpolation.QuoteLiteral},
+	"ruby":       {Inline: []string{"ruby", "-e"}, File: []string{"ruby"}, Quoting: interpolation.QuoteLiteral},
+	"perl":       {Inline: []string{"perl", "-e"}, File: []string{"perl"}, Quoting: interpolation.QuoteLiteral},
+}
+
+func AddInterpreter(name string, inline []string, file []string, quoting interpolation.Quoting) {
+	if _, ok := interpreters[name]; ok {
+		panic(fmt.Sprintf("Interpreter `%s` already exists", name))
+	}
+
+	interpreters[name] = Interpreter{Inline: inline, File: file, Quoting: quoting}
+}
+
+func GetInterpreter(name string) (*Interpreter, error) {
+	interpreter, ok := interpreters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown shell or runtime `%s`. Use a custom argv template such as [\"%s\", \"-c\"] instead", name, name)
+	}
+
+	interpreter.Name = name
+	return &interpreter, nil
+}
+
+// Resolve returns the interpreter for a `shell` setting, falling back to DefaultShell when it's not set.
+func Resolve(def *types.ShellDefinition) (*Interpreter, error) {
+	if def == nil || (def.Name == "" && len(def.Argv) == 0) {
+		return GetInterpreter(DefaultShell)
+	}
+
+	if len(def.Argv) > 0 {
+		// Custom argv templates usually just pass extra options to a known shell, whose quoting rules we
+		// can use. For anything else, values are inserted as JSON string literals.
+		known, ok := interpreters[strings.TrimSuffix(filepath.Base(def.Argv[0]), ".exe")]
+		if !ok {
+			known = Interpreter{Quoting: interpolation.QuoteLiteral}
+		}
+
+		return &Interpreter{
+			Name:         def.Argv[0],
+			Inline:       def.Argv,
+			File:         def.Argv[:1],
+			Quoting:      known.Quoting,
+			NamedScript:  known.NamedScript,
+			NoInlineArgs: known.NoInlineArgs,
+		}, nil
+	}
+
+	return GetInterpreter(def.Name)
+}
+
+// Executable is the name of the program the interpreter runs, which must be available on the PATH.
+func (interpreter *Interpreter) Executable() string {
+	return interpreter.Inline[0]
+}
+
+// Argv returns the full argument list for running a script given as a string, with the given arguments.
+func (interpreter *Interpreter) Argv(script string, args ...string) []string {
+	argv := append(append([]string{}, interpreter.Inline...), script)
+	if len(args) > 0 && interpreter.NamedScript {
+		argv = append(argv, interpreter.Executable())
+	}
+	return append(argv, args...)
+}
+
+// FileArgv returns the full argument list for running a script file.
+func (interpreter *Interpreter) FileArgv(filePath string, args ...string) []string {
+	return append(append(append([]string{}, interpreter.File...), filePath), args...)
+}
+
+// Command creates a command that runs the given script with the interpreter and the given arguments.
+func (interpreter *Interpreter) Command(script string, args ...string) *exec.Cmd {
+	argv := interpreter.Argv(script, args...)
+	return exec.Command(argv[0], argv[1:]...)
+}
+
+// FileCommand creates a command that runs the given script file with the interpreter.
+func (interpreter *Interpreter) FileCommand(filePath string, args ...string) *exec.Cmd {
+	argv := interpreter.FileArgv(filePath, args...)
+	return exec.Command(argv[0], argv[1:]...)
+}
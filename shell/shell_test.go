@@ -0,0 +1,122 @@
+package shell
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/migsc/cmdeagle/interpolation"
+	"github.com/migsc/cmdeagle/types"
+)
+
+func TestInterpreters(t *testing.T) {
+	tests := []struct {
+		name    string
+		quoting interpolation.Quoting
+		// The argument lists for the script `S` with the argument `a`, given as a string and as the file `f`
+		inline []string
+		file   []string
+		// Whether the inline form takes no arguments
+		noInlineArgs bool
+	}{
+		{"sh", interpolation.QuotePOSIX, []string{"sh", "-c", "S", "sh", "a"}, []string{"sh", "f", "a"}, false},
+		{"bash", interpolation.QuotePOSIX, []string{"bash", "-c", "S", "bash", "a"}, []string{"bash", "f", "a"}, false},
+		{"zsh", interpolation.QuotePOSIX, []string{"zsh", "-c", "S", "zsh", "a"}, []string{"zsh", "f", "a"}, false},
+		{"pwsh", interpolation.QuotePowerShell, []string{"pwsh", "-NoProfile", "-NonInteractive", "-Command", "S"}, []string{"pwsh", "-NoProfile", "-NonInteractive", "-File", "f", "a"}, true},
+		{"powershell", interpolation.QuotePowerShell, []string{"powershell", "-NoProfile", "-NonInteractive", "-Command", "S"}, []string{"powershell", "-NoProfile", "-NonInteractive", "-File", "f", "a"}, true},
+		{"node", interpolation.QuoteLiteral, []string{"node", "-e", "S", "a"}, []string{"node", "f", "a"}, false},
+		{"deno", interpolation.QuoteLiteral, []string{"deno", "eval", "S", "a"}, []string{"deno", "run", "--allow-all", "f", "a"}, false},
+		{"bun", interpolation.QuoteLiteral, []string{"bun", "-e", "S", "a"}, []string{"bun", "run", "f", "a"}, false},
+		{"python", interpolation.QuoteLiteral, []string{"python", "-c", "S", "a"}, []string{"python", "f", "a"}, false},
+		{"python3", interpolation.QuoteLiteral, []string{"python3", "-c", "S", "a"}, []string{"python3", "f", "a"}, false},
+		{"ruby", interpolation.QuoteLiteral, []string{"ruby", "-e", "S", "a"}, []string{"ruby", "f", "a"}, false},
+		{"perl", interpolation.QuoteLiteral, []string{"perl", "-e", "S", "a"}, []string{"perl", "f", "a"}, false},
+	}
+	require.Len(t, tests, len(interpreters), "every interpreter is tested")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interpreter, err := GetInterpreter(tt.name)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.name, interpreter.Name)
+			assert.Equal(t, tt.name, interpreter.Executable())
+			assert.Equal(t, tt.quoting, interpreter.Quoting)
+			assert.Equal(t, tt.noInlineArgs, interpreter.NoInlineArgs)
+			assert.Equal(t, tt.file, interpreter.FileArgv("f", "a"))
+			assert.Equal(t, tt.file, interpreter.FileCommand("f", "a").Args)
+
+			if tt.noInlineArgs {
+				assert.Equal(t, tt.inline, interpreter.Argv("S"))
+			} else {
+				assert.Equal(t, tt.inline, interpreter.Argv("S", "a"))
+				assert.Equal(t, tt.inline, interpreter.Command("S", "a").Args)
+			}
+
+			// Without arguments, the script is the last argument, even for shells that name it
+			assert.Equal(t, "S", interpreter.Argv("S")[len(interpreter.Argv("S"))-1])
+		})
+	}
+}
+
+func TestNamedScriptArguments(t *testing.T) {
+	for _, name := range []string{"sh", "bash"} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := exec.LookPath(name); err != nil {
+				t.Skipf("%s isn't installed", name)
+			}
+			interpreter, err := GetInterpreter(name)
+			require.NoError(t, err)
+
+			// The arguments are the script's positional parameters, starting at $1
+			output, err := interpreter.Command(`echo "$0|$1|$2|$#"`, "a b", "c").Output()
+			require.NoError(t, err)
+			assert.Equal(t, name+"|a b|c|2\n", string(output))
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	interpreter, err := Resolve(nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultShell, interpreter.Name)
+
+	interpreter, err = Resolve(&types.ShellDefinition{Name: "bash"})
+	require.NoError(t, err)
+	assert.Equal(t, "bash", interpreter.Name)
+
+	// Custom argument lists take the quoting and `$0` handling of the shell they start
+	interpreter, err = Resolve(&types.ShellDefinition{Argv: []string{"/bin/bash", "-eu", "-c"}})
+	require.NoError(t, err)
+	assert.Equal(t, interpolation.QuotePOSIX, interpreter.Quoting)
+	assert.True(t, interpreter.NamedScript)
+	assert.Equal(t, []string{"/bin/bash", "-eu", "-c", "S", "/bin/bash", "a"}, interpreter.Argv("S", "a"))
+	assert.Equal(t, []string{"/bin/bash", "f", "a"}, interpreter.FileArgv("f", "a"))
+
+	interpreter, err = Resolve(&types.ShellDefinition{Argv: []string{"pwsh.exe", "-Command"}})
+	require.NoError(t, err)
+	assert.Equal(t, interpolation.QuotePowerShell, interpreter.Quoting)
+	assert.True(t, interpreter.NoInlineArgs)
+
+	// And values are inserted as string literals for anything else
+	interpreter, err = Resolve(&types.ShellDefinition{Argv: []string{"mytool", "run"}})
+	require.NoError(t, err)
+	assert.Equal(t, interpolation.QuoteLiteral, interpreter.Quoting)
+	assert.False(t, interpreter.NamedScript)
+
+	_, err = Resolve(&types.ShellDefinition{Name: "fish"})
+	assert.ErrorContains(t, err, "unknown shell or runtime `fish`")
+}
+
+func TestAddInterpreter(t *testing.T) {
+	AddInterpreter("lua-test", []string{"lua", "-e"}, []string{"lua"}, interpolation.QuoteLiteral)
+	t.Cleanup(func() { delete(interpreters, "lua-test") })
+
+	interpreter, err := GetInterpreter("lua-test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lua", "-e", "S", "a"}, interpreter.Argv("S", "a"))
+
+	assert.Panics(t, func() { AddInterpreter("sh", []string{"sh", "-c"}, []string{"sh"}, interpolation.QuotePOSIX) })
+}
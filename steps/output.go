@@ -0,0 +1,122 @@
+package steps
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Ways to keep the output of steps that run at the same time apart
+const (
+	// Every line is prefixed with the name of its step as soon as it's complete
+	OutputPrefix = "prefix"
+	// The output of each step is held back and printed in one piece when the step is done
+	OutputGroup = "group"
+)
+
+// Output hands out writers for the output of each step, and serializes what they write to the real
+// stdout and stderr.
+type Output struct {
+	mode   string
+	stdout io.Writer
+	stderr io.Writer
+	width  int
+	mu     sync.Mutex
+}
+
+func NewOutput(mode string, stdout io.Writer, stderr io.Writer, names []string) (*Output, error) {
+	if mode == "" {
+		mode = OutputPrefix
+	}
+	if mode != OutputPrefix && mode != OutputGroup {
+		return nil, fmt.Errorf("step-output must be %s or %s, got %q", OutputPrefix, OutputGroup, mode)
+	}
+
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+
+	return &Output{mode: mode, stdout: stdout, stderr: stderr, width: width}, nil
+}
+
+// StepWriters returns the writers for the stdout and stderr of a step, and a function that must be called
+// once the step is done to write what's left.
+func (output *Output) StepWriters(name string) (io.Writer, io.Writer, func()) {
+	if output.mode == OutputGroup {
+		group := &groupWriter{output: output, name: name}
+		return &group.stdout, &group.stderr, group.flush
+	}
+
+	prefix := fmt.Sprintf("[%-*s] ", output.width, name)
+	stdout := &prefixWriter{output: output, dst: output.stdout, prefix: prefix}
+	stderr := &prefixWriter{output: output, dst: output.stderr, prefix: prefix}
+
+	return stdout, stderr, func() {
+		stdout.flush()
+		stderr.flush()
+	}
+}
+
+type prefixWriter struct {
+	output  *Output
+	dst     io.Writer
+	prefix  string
+	partial []byte
+}
+
+func (writer *prefixWriter) Write(p []byte) (int, error) {
+	writer.partial = append(writer.partial, p...)
+
+	end := bytes.LastIndexByte(writer.partial, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+
+	lines := strings.SplitAfter(string(writer.partial[:end+1]), "\n")
+	writer.partial = append([]byte{}, writer.partial[end+1:]...)
+
+	var out strings.Builder
+	for _, line := range lines {
+		if line != "" {
+			out.WriteString(writer.prefix + line)
+		}
+	}
+
+	writer.output.mu.Lock()
+	defer writer.output.mu.Unlock()
+	if _, err := io.WriteString(writer.dst, out.String()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// flush writes a last line that didn't end with a newline.
+func (writer *prefixWriter) flush() {
+	if len(writer.partial) > 0 {
+		writer.Write([]byte("\n"))
+	}
+}
+
+type groupWriter struct {
+	output *Output
+	name   string
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+func (writer *groupWriter) flush() {
+	if writer.stdout.Len() == 0 && writer.stderr.Len() == 0 {
+		return
+	}
+
+	writer.output.mu.Lock()
+	defer writer.output.mu.Unlock()
+
+	fmt.Fprintf(writer.output.stdout, "==> %s\n", writer.name)
+	writer.output.stdout.Write(writer.stdout.Bytes())
+	writer.output.stderr.Write(writer.stderr.Bytes())
+}
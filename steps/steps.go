@@ -0,0 +1,296 @@
+package steps
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+//go:embed *
+var PackageFS embed.FS
+
+// Statuses of a step once the command is done
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+	// The step was stopped because another step failed
+	StatusCancelled = "cancelled"
+	// The step never started because a step it needs failed, or another step failed first
+	StatusNotRun = "not run"
+)
+
+const statusRunning = "running"
+
+// ErrSkipped is returned by a RunFunc for a step whose condition is false. Steps that need it still run.
+var ErrSkipped = errors.New("skipped")
+
+// Step is a node of the graph: a step and the steps it needs.
+type Step struct {
+	Name  string
+	Needs []string
+}
+
+// Plan resolves the dependencies of the steps and checks that they form a graph that can run. Steps
+// without `needs` depend on the step before them. Consecutive `parallel` steps form a group that shares
+// the dependencies of its first step, and the step after the group depends on all of them.
+func Plan(defs []types.StepDefinition) ([]Step, error) {
+	plan := make([]Step, 0, len(defs))
+	names := map[string]bool{}
+
+	previous := []string{}
+	var group, groupNeeds []string
+	inGroup := false
+
+	for _, def := range defs {
+		if def.Name == "" {
+			return nil, fmt.Errorf("every step needs a name")
+		}
+		if names[def.Name] {
+			return nil, fmt.Errorf("step %s is defined more than once", def.Name)
+		}
+		names[def.Name] = true
+
+		if def.Parallel && !inGroup {
+			inGroup, group, groupNeeds = true, nil, previous
+		} else if !def.Parallel && inGroup {
+			inGroup, previous = false, group
+		}
+
+		needs := previous
+		if inGroup {
+			needs = groupNeeds
+		}
+		if def.Needs != nil {
+			needs = def.Needs
+		}
+
+		plan = append(plan, Step{Name: def.Name, Needs: append([]string{}, needs...)})
+
+		if inGroup {
+			group = append(group, def.Name)
+		} else {
+			previous = []string{def.Name}
+		}
+	}
+
+	for _, step := range plan {
+		for _, need := range step.Needs {
+			if !names[need] {
+				return nil, fmt.Errorf("step %s needs unknown step %s", step.Name, need)
+			}
+		}
+	}
+
+	if cycle := findCycle(plan); cycle != nil {
+		return nil, fmt.Errorf("steps depend on each other in a cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	return plan, nil
+}
+
+func findCycle(plan []Step) []string {
+	needs := map[string][]string{}
+	for _, step := range plan {
+		needs[step.Name] = step.Needs
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	path := []string{}
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, step := range path {
+				if step == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, need := range needs[name] {
+			if cycle := visit(need); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		return nil
+	}
+
+	for _, step := range plan {
+		if cycle := visit(step.Name); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// Condition turns the `if` of a step into a template that renders `true` when the step should run.
+func Condition(expression string) string {
+	return "{{if " + expression + "}}true{{end}}"
+}
+
+// RunFunc runs a single step. It should stop the step when the context is cancelled.
+type RunFunc func(ctx context.Context, name string) error
+
+type Options struct {
+	// How many steps may run at the same time. Defaults to the number of CPUs.
+	Jobs int
+	// Keep running the steps that don't depend on a failed step
+	ContinueOnError bool
+}
+
+// Result is the outcome of a step.
+type Result struct {
+	Name     string
+	Status   string
+	Duration time.Duration
+	Err      error
+}
+
+type finished struct {
+	index    int
+	err      error
+	duration time.Duration
+}
+
+// Execute runs the planned steps, each as soon as the steps it needs are done and a job is free. When a
+// step fails, the steps that need it don't run. Unless ContinueOnError is set, the steps still running
+// are cancelled and no more steps start. The results are in the order of the plan.
+func Execute(ctx context.Context, plan []Step, run RunFunc, opts Options) []Result {
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]Result, len(plan))
+	index := map[string]int{}
+	for i, step := range plan {
+		results[i].Name = step.Name
+		index[step.Name] = i
+	}
+
+	done := make(chan finished)
+	running := 0
+	stopping := false
+
+	for {
+		// Start every step that's ready, and give up on the ones that can't run anymore. Giving up on a step
+		// can block steps that come before it in the plan, so this repeats until nothing changes.
+		for changed := true; changed; {
+			changed = false
+
+			for i, step := range plan {
+				if results[i].Status != "" {
+					continue
+				}
+
+				ready, blocked := true, stopping
+				for _, need := range step.Needs {
+					switch results[index[need]].Status {
+					case StatusSucceeded, StatusSkipped:
+					case "", statusRunning:
+						ready = false
+					default:
+						blocked = true
+					}
+				}
+
+				if blocked {
+					results[i].Status = StatusNotRun
+					changed = true
+					continue
+				}
+				if !ready || running >= jobs {
+					continue
+				}
+
+				results[i].Status = statusRunning
+				running++
+				go func(i int, name string) {
+					started := time.Now()
+					err := run(ctx, name)
+					done <- finished{index: i, err: err, duration: time.Since(started)}
+				}(i, step.Name)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-done
+		running--
+
+		results[result.index].Duration = result.duration
+		results[result.index].Err = result.err
+
+		switch {
+		case result.err == nil:
+			results[result.index].Status = StatusSucceeded
+		case errors.Is(result.err, ErrSkipped):
+			results[result.index].Status = StatusSkipped
+			results[result.index].Err = nil
+		case stopping:
+			results[result.index].Status = StatusCancelled
+		default:
+			results[result.index].Status = StatusFailed
+			if !opts.ContinueOnError {
+				stopping = true
+				cancel()
+			}
+		}
+	}
+
+	return results
+}
+
+// FirstError returns the error of the first step that failed, if any.
+func FirstError(results []Result) error {
+	for _, result := range results {
+		if result.Status == StatusFailed {
+			return fmt.Errorf("step %s failed: %w", result.Name, result.Err)
+		}
+	}
+
+	return nil
+}
+
+// WriteSummary prints a table with the status and duration of every step.
+func WriteSummary(w io.Writer, results []Result) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "STEP\tSTATUS\tDURATION")
+
+	for _, result := range results {
+		duration := "-"
+		if result.Status != StatusNotRun {
+			duration = result.Duration.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", result.Name, result.Status, duration)
+	}
+
+	return table.Flush()
+}
@@ -0,0 +1,177 @@
+package steps
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+func TestPlan(t *testing.T) {
+	plan, err := Plan([]types.StepDefinition{
+		{Name: "deps"},
+		{Name: "lint", Parallel: true},
+		{Name: "test", Parallel: true},
+		{Name: "build"},
+		{Name: "docs", Needs: []string{}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []Step{
+		{Name: "deps", Needs: []string{}},
+		{Name: "lint", Needs: []string{"deps"}},
+		{Name: "test", Needs: []string{"deps"}},
+		{Name: "build", Needs: []string{"lint", "test"}},
+		{Name: "docs", Needs: []string{}},
+	}, plan)
+}
+
+func TestPlanErrors(t *testing.T) {
+	_, err := Plan([]types.StepDefinition{{Name: "a", Needs: []string{"b"}}})
+	assert.ErrorContains(t, err, "unknown step b")
+
+	_, err = Plan([]types.StepDefinition{{Name: "a"}, {Name: "a"}})
+	assert.ErrorContains(t, err, "more than once")
+
+	_, err = Plan([]types.StepDefinition{{Run: "true"}})
+	assert.ErrorContains(t, err, "needs a name")
+
+	_, err = Plan([]types.StepDefinition{
+		{Name: "a", Needs: []string{"c"}},
+		{Name: "b", Needs: []string{"a"}},
+		{Name: "c", Needs: []string{"b"}},
+	})
+	assert.ErrorContains(t, err, "a -> c -> b -> a")
+}
+
+func TestExecuteOrder(t *testing.T) {
+	plan := []Step{
+		{Name: "build", Needs: []string{"lint", "test"}},
+		{Name: "lint", Needs: []string{}},
+		{Name: "test", Needs: []string{}},
+	}
+
+	var mu sync.Mutex
+	ran := []string{}
+	results := Execute(context.Background(), plan, func(ctx context.Context, name string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, name)
+		return nil
+	}, Options{})
+
+	assert.Equal(t, "build", ran[2])
+	for _, result := range results {
+		assert.Equal(t, StatusSucceeded, result.Status, result.Name)
+	}
+	assert.NoError(t, FirstError(results))
+}
+
+func TestExecuteFailFast(t *testing.T) {
+	plan := []Step{
+		{Name: "slow", Needs: []string{}},
+		{Name: "broken", Needs: []string{}},
+		{Name: "after", Needs: []string{"slow"}},
+	}
+
+	results := Execute(context.Background(), plan, func(ctx context.Context, name string) error {
+		if name == "broken" {
+			return errors.New("exit status 1")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}, Options{Jobs: 2})
+
+	assert.Equal(t, StatusCancelled, results[0].Status)
+	assert.Equal(t, StatusFailed, results[1].Status)
+	assert.Equal(t, StatusNotRun, results[2].Status)
+	assert.EqualError(t, FirstError(results), "step broken failed: exit status 1")
+}
+
+func TestExecuteContinueOnError(t *testing.T) {
+	plan := []Step{
+		{Name: "broken", Needs: []string{}},
+		{Name: "after", Needs: []string{"broken"}},
+		{Name: "other", Needs: []string{}},
+		{Name: "skipped", Needs: []string{}},
+		{Name: "last", Needs: []string{"skipped"}},
+	}
+
+	results := Execute(context.Background(), plan, func(ctx context.Context, name string) error {
+		switch name {
+		case "broken":
+			return errors.New("exit status 1")
+		case "skipped":
+			return ErrSkipped
+		}
+		return nil
+	}, Options{Jobs: 1, ContinueOnError: true})
+
+	statuses := []string{}
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	assert.Equal(t, []string{StatusFailed, StatusNotRun, StatusSucceeded, StatusSkipped, StatusSucceeded}, statuses)
+}
+
+func TestExecuteJobs(t *testing.T) {
+	plan := []Step{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		plan = append(plan, Step{Name: name, Needs: []string{}})
+	}
+
+	var running, most atomic.Int32
+	Execute(context.Background(), plan, func(ctx context.Context, name string) error {
+		now := running.Add(1)
+		for {
+			seen := most.Load()
+			if now <= seen || most.CompareAndSwap(seen, now) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	}, Options{Jobs: 2})
+
+	assert.Equal(t, int32(2), most.Load())
+}
+
+func TestOutputPrefix(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	output, err := NewOutput(OutputPrefix, &stdout, &stderr, []string{"a", "long"})
+	require.NoError(t, err)
+
+	out, errOut, flush := output.StepWriters("a")
+	out.Write([]byte("one\ntw"))
+	errOut.Write([]byte("oops\n"))
+	out.Write([]byte("o\nthree"))
+	flush()
+
+	assert.Equal(t, "[a   ] one\n[a   ] two\n[a   ] three\n", stdout.String())
+	assert.Equal(t, "[a   ] oops\n", stderr.String())
+}
+
+func TestOutputGroup(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	output, err := NewOutput(OutputGroup, &stdout, &stderr, []string{"a"})
+	require.NoError(t, err)
+
+	out, _, flush := output.StepWriters("a")
+	out.Write([]byte("one\n"))
+	assert.Empty(t, stdout.String(), "holds output back until the step is done")
+	flush()
+
+	assert.Equal(t, "==> a\none\n", stdout.String())
+
+	_, err = NewOutput("columns", &stdout, &stderr, nil)
+	assert.Error(t, err)
+}
@@ -16,6 +16,10 @@ type ArgDefinition struct {
 	// Description string `yaml:"description"`
 	Required bool `yaml:"required,omitempty"`
 	Default  any  `yaml:"default,omitempty"`
+	// Environment variable that provides the value when it's not given on the command line
+	Env string `yaml:"env,omitempty"`
+	// Mask the value wherever the CLI shows it, and ask for it without echo when it's required and missing
+	Secret bool `yaml:"secret,omitempty"`
 	// Optional validation for this specific argument
 	// TODO: rename this to rules? right?
 	Constraints ParamConstraints `yaml:"validation,omitempty"`
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CallDefinition invokes another command of the same CLI. In YAML it is either the path of the command
+// (`call: [test, db migrate]`) or an object that also gives its args and flags.
+type CallDefinition struct {
+	// Path of the command from the root, with subcommands separated by spaces, e.g. `db migrate`
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args,omitempty"`
+	Flags   map[string]string `yaml:"flags,omitempty"`
+}
+
+func (def *CallDefinition) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Decode(&def.Command)
+	case yaml.MappingNode:
+		// Decoding into an alias type skips this method
+		type callDefinition CallDefinition
+		return node.Decode((*callDefinition)(def))
+	default:
+		return fmt.Errorf("line %d: call must be a command or an object with a command, args and flags", node.Line)
+	}
+}
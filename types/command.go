@@ -11,8 +11,53 @@ type CommandDefinition struct {
 	Flags    []FlagDefinition    `yaml:"flags,omitempty"`
 	Commands []CommandDefinition `yaml:"commands,omitempty"`
 	Requires map[string]string   `yaml:"requires,omitempty"`
-	Includes []string            `yaml:"includes,omitempty"`
+	Includes []IncludeDefinition `yaml:"includes,omitempty"`
 	Build    string              `yaml:"build,omitempty"`
 	Validate string              `yaml:"validate,omitempty"`
 	Start    string              `yaml:"start,omitempty"`
+	// Interpreter for the inline scripts of this command and its subcommands. Defaults to `sh`.
+	Shell *ShellDefinition `yaml:"shell,omitempty"`
+	// Shorthand for a `start` that runs a bundled file with a runtime, e.g. `run: {node: greet.js}`
+	Run *RunDefinition `yaml:"run,omitempty"`
+	// Alternative to `start` that runs an executable directly, with each entry rendered as a single
+	// argument and no shell in between, e.g. `argv: [git, clone, "{{args.url}}"]`
+	Argv []string `yaml:"argv,omitempty"`
+	// Alternative to `start` that runs other commands of the CLI in order, in the same process
+	Call []CallDefinition `yaml:"call,omitempty"`
+	// Alternative to `start` that runs several scripts as a dependency graph
+	Steps []StepDefinition `yaml:"steps,omitempty"`
+	// How many steps may run at the same time. Defaults to the number of CPUs.
+	Jobs int `yaml:"jobs,omitempty"`
+	// Keep running the steps that don't depend on a failed step, instead of stopping everything
+	ContinueOnError bool `yaml:"continue-on-error,omitempty"`
+	// How the output of steps is kept apart: `prefix` (the default) or `group`
+	StepOutput string `yaml:"step-output,omitempty"`
+	// Variables scripts get, rendered like scripts. Inherited by subcommands, which can override them.
+	Env map[string]string `yaml:"env,omitempty"`
+	// Dotenv files to load variables from, after the ones of the parent commands
+	EnvFiles []EnvFileDefinition `yaml:"env-files,omitempty"`
+	// Variables that must be set for the command to run, in addition to the ones of the parent commands
+	RequiredEnv []string `yaml:"required-env,omitempty"`
+	// Whether scripts get the CLI's environment. Defaults to the parent command's setting, or true.
+	InheritEnv *bool `yaml:"inherit-env,omitempty"`
+	// Variables scripts still get from the CLI's environment when `inherit-env` is false
+	AllowEnv []string `yaml:"allow-env,omitempty"`
+	// How long a script gets to exit after a forwarded signal before it is killed, e.g. `30s`. Defaults to 10s.
+	KillTimeout string `yaml:"kill-timeout,omitempty"`
+	// How long `start` may run before it is stopped, e.g. `5m`
+	Timeout string `yaml:"timeout,omitempty"`
+	// Run `start` again when it fails
+	Retry *RetryDefinition `yaml:"retry,omitempty"`
+	// Hand the terminal over to the start script, for editors, pagers and REPLs
+	Interactive bool `yaml:"interactive,omitempty"`
+	// Replace the CLI's process with the start script instead of running it as a child
+	Exec bool `yaml:"exec,omitempty"`
+	// Pass the positional arguments to the start script, e.g. as `"$@"`
+	PassArgs bool `yaml:"pass-args,omitempty"`
+	// Format of what the start script prints, which the CLI renders as set by `--output`. Only `json` for now.
+	Output string `yaml:"output,omitempty"`
+	// Columns of the table the output is rendered as, by default every field of the rows
+	Columns []ColumnDefinition `yaml:"columns,omitempty"`
+	// Scripts that run before and after `start`, and when the command fails
+	Hooks *HooksDefinition `yaml:"hooks,omitempty"`
 }
@@ -38,15 +38,44 @@ type CmdeagleConfig struct {
 
 	// Settings    Settings            `yaml:"settings,omitempty"`
 
-	Args       []ArgDefinition     `yaml:"args,omitempty"`
-	Flags      []FlagDefinition    `yaml:"flags,omitempty"`
-	Commands   []CommandDefinition `yaml:"commands"`
-	Requires   map[string]string   `yaml:"requires,omitempty"`
-	Includes   []string            `yaml:"includes,omitempty"`
-	Build      string              `yaml:"build,omitempty"`
-	Validate   string              `yaml:"validate,omitempty"`
-	Start      string              `yaml:"start,omitempty"`
-	Completion bool                `yaml:"completion`
+	Args            []ArgDefinition     `yaml:"args,omitempty"`
+	Flags           []FlagDefinition    `yaml:"flags,omitempty"`
+	Commands        []CommandDefinition `yaml:"commands"`
+	Requires        map[string]string   `yaml:"requires,omitempty"`
+	Includes        []IncludeDefinition `yaml:"includes,omitempty"`
+	Build           string              `yaml:"build,omitempty"`
+	Validate        string              `yaml:"validate,omitempty"`
+	Start           string              `yaml:"start,omitempty"`
+	Completion      bool                `yaml:"completion"`
+	Self            *SelfDefinition     `yaml:"self,omitempty"`
+	Update          *UpdateDefinition   `yaml:"update,omitempty"`
+	Extraction      string              `yaml:"extraction,omitempty"`
+	Compression     string              `yaml:"compression,omitempty"`
+	Shell           *ShellDefinition    `yaml:"shell,omitempty"`
+	Run             *RunDefinition      `yaml:"run,omitempty"`
+	Argv            []string            `yaml:"argv,omitempty"`
+	Call            []CallDefinition    `yaml:"call,omitempty"`
+	Steps           []StepDefinition    `yaml:"steps,omitempty"`
+	Jobs            int                 `yaml:"jobs,omitempty"`
+	ContinueOnError bool                `yaml:"continue-on-error,omitempty"`
+	StepOutput      string              `yaml:"step-output,omitempty"`
+	Env             map[string]string   `yaml:"env,omitempty"`
+	EnvFiles        []EnvFileDefinition `yaml:"env-files,omitempty"`
+	RequiredEnv     []string            `yaml:"required-env,omitempty"`
+	InheritEnv      *bool               `yaml:"inherit-env,omitempty"`
+	AllowEnv        []string            `yaml:"allow-env,omitempty"`
+	KillTimeout     string              `yaml:"kill-timeout,omitempty"`
+	Timeout         string              `yaml:"timeout,omitempty"`
+	Retry           *RetryDefinition    `yaml:"retry,omitempty"`
+	Interactive     bool                `yaml:"interactive,omitempty"`
+	Exec            bool                `yaml:"exec,omitempty"`
+	PassArgs        bool                `yaml:"pass-args,omitempty"`
+	Output          string              `yaml:"output,omitempty"`
+	Columns         []ColumnDefinition  `yaml:"columns,omitempty"`
+	Hooks           *HooksDefinition    `yaml:"hooks,omitempty"`
+
+	// Directory of bundled `<locale>.yaml` message catalogs used to localize validation errors.
+	Locales string `yaml:"locales,omitempty"`
 }
 
 // type Settings struct {
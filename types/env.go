@@ -1,6 +1,33 @@
 package types
 
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
 type EnvVar struct {
 	Name  string
 	Value string
 }
+
+// EnvFileDefinition is a dotenv file that variables are loaded from. In YAML it is either a path
+// (`env-files: [.env]`) or an object that marks the file as optional.
+type EnvFileDefinition struct {
+	Path string `yaml:"path"`
+	// Don't fail when the file doesn't exist
+	Optional bool `yaml:"optional,omitempty"`
+}
+
+func (def *EnvFileDefinition) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Decode(&def.Path)
+	case yaml.MappingNode:
+		// Decoding into an alias type skips this method
+		type envFileDefinition EnvFileDefinition
+		return node.Decode((*envFileDefinition)(def))
+	default:
+		return fmt.Errorf("line %d: env file must be a path or an object with a path", node.Line)
+	}
+}
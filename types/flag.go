@@ -5,6 +5,8 @@ type FlagDefinition struct {
 	Type          string              `yaml:"type"`
 	Required      bool                `yaml:"required,omitempty"`
 	Default       any                 `yaml:"default,omitempty"`
+	Env           string              `yaml:"env,omitempty"`
+	Secret        bool                `yaml:"secret,omitempty"`
 	Description   string              `yaml:"description,omitempty"`
 	Shorthand     string              `yaml:"short,omitempty"`
 	Hidden        bool                `yaml:"hidden,omitempty"`
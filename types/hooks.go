@@ -0,0 +1,19 @@
+package types
+
+// HooksDefinition holds scripts that run around a command's `start` script. The persistent variants also
+// run for every descendant of the command that declares them.
+type HooksDefinition struct {
+	// Runs before `start`. If it fails, `start` is skipped.
+	Before string `yaml:"before,omitempty"`
+	// Runs after `start` succeeded
+	After string `yaml:"after,omitempty"`
+	// Runs when the command failed at any stage, including validation
+	OnError string `yaml:"on-error,omitempty"`
+	// Always runs last, whether the command succeeded or not
+	Finally string `yaml:"finally,omitempty"`
+
+	PersistentBefore  string `yaml:"persistent-before,omitempty"`
+	PersistentAfter   string `yaml:"persistent-after,omitempty"`
+	PersistentOnError string `yaml:"persistent-on-error,omitempty"`
+	PersistentFinally string `yaml:"persistent-finally,omitempty"`
+}
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IncludeDefinition declares a file or directory bundled into the CLI. In YAML it is either the path of
+// the file (`includes: [./greet.sh]`) or an object with the path and how to install it.
+type IncludeDefinition struct {
+	Path string `yaml:"path"`
+	// Installs the file, or every file of the directory, as an executable, whatever its mode is on the
+	// build machine
+	Executable bool `yaml:"executable,omitempty"`
+}
+
+func (def *IncludeDefinition) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Decode(&def.Path)
+	case yaml.MappingNode:
+		// Decoding into an alias type skips this method
+		type includeDefinition IncludeDefinition
+		return node.Decode((*includeDefinition)(def))
+	default:
+		return fmt.Errorf("line %d: include must be a path or an object with a path", node.Line)
+	}
+}
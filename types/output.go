@@ -0,0 +1,31 @@
+package types
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ColumnDefinition declares a column of the table a command renders its output as. In YAML it is either
+// the field to show (`columns: [name, status]`) or an object that also gives its header and format.
+type ColumnDefinition struct {
+	// Path of the field in each row, with nested fields separated by dots, e.g. `owner.login`
+	Field string `yaml:"field"`
+	// Defaults to the field
+	Header string `yaml:"header,omitempty"`
+	// Go template that renders the value of the field, given as `.`, e.g. `{{printf "%.1f" .}}`
+	Format string `yaml:"format,omitempty"`
+}
+
+func (def *ColumnDefinition) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Decode(&def.Field)
+	case yaml.MappingNode:
+		// Decoding into an alias type skips this method
+		type columnDefinition ColumnDefinition
+		return node.Decode((*columnDefinition)(def))
+	default:
+		return fmt.Errorf("line %d: column must be a field or an object with a field, header and format", node.Line)
+	}
+}
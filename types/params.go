@@ -38,6 +38,9 @@ type ParamConstraints struct {
 	Nand ([]*ParamConstraints) `yaml:"nand,omitempty"`
 	Or   ([]*ParamConstraints) `yaml:"or,omitempty"`
 	Not  (*ParamConstraints)   `yaml:"not,omitempty"`
+
+	// Custom error message template. Has access to {{.Name}}, {{.Value}} and {{.Expected}}.
+	Message string `yaml:"message,omitempty"`
 }
 
 var ConstraintFileKeys = []string{"FileExists", "DirExists", "HasPermissions", "IsFileType"}
@@ -0,0 +1,14 @@
+package types
+
+// RetryDefinition controls how a failing `start` script is run again, e.g.
+// `retry: {attempts: 3, backoff: 2s, on-exit-codes: [75]}`.
+type RetryDefinition struct {
+	// Total number of runs, including the first
+	Attempts int `yaml:"attempts"`
+	// Delay before the second attempt, doubled before every attempt after that. Defaults to 1s.
+	Backoff string `yaml:"backoff,omitempty"`
+	// Upper bound for the delay. Defaults to 30s.
+	MaxDelay string `yaml:"max-delay,omitempty"`
+	// Only retry these exit codes. By default any failure is retried.
+	OnExitCodes []int `yaml:"on-exit-codes,omitempty"`
+}
@@ -0,0 +1,58 @@
+package types
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSelfName is the name of the built-in command that manages the installation of a CLI.
+const DefaultSelfName = "self"
+
+// SelfDefinition configures the built-in `self` command. In YAML it is `false` to leave the command out,
+// the name to give it (`self: manage`), or an object.
+type SelfDefinition struct {
+	Disabled bool   `yaml:"disabled,omitempty"`
+	Name     string `yaml:"name,omitempty"`
+	// Lists the command in the help of the CLI, which leaves it out by default
+	Visible bool `yaml:"visible,omitempty"`
+}
+
+func (def *SelfDefinition) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!bool" {
+			var enabled bool
+			if err := node.Decode(&enabled); err != nil {
+				return err
+			}
+			def.Disabled = !enabled
+			return nil
+		}
+		return node.Decode(&def.Name)
+	case yaml.MappingNode:
+		// Decoding into an alias type skips this method
+		type selfDefinition SelfDefinition
+		return node.Decode((*selfDefinition)(def))
+	default:
+		return fmt.Errorf("line %d: self must be false, a command name or an object", node.Line)
+	}
+}
+
+// Enabled reports whether the CLI has the `self` command.
+func (def *SelfDefinition) Enabled() bool {
+	return def == nil || !def.Disabled
+}
+
+// CommandName returns the name of the `self` command.
+func (def *SelfDefinition) CommandName() string {
+	if def == nil || def.Name == "" {
+		return DefaultSelfName
+	}
+	return def.Name
+}
+
+// Hidden reports whether the `self` command is left out of the help of the CLI.
+func (def *SelfDefinition) Hidden() bool {
+	return def == nil || !def.Visible
+}
@@ -0,0 +1,56 @@
+package types
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ShellDefinition selects the interpreter that runs a command's inline scripts. In YAML it is either the
+// name of a known shell or runtime (`shell: bash`) or a custom argv template (`shell: ["python3", "-c"]`)
+// that the script is appended to.
+type ShellDefinition struct {
+	Name string
+	Argv []string
+}
+
+func (def *ShellDefinition) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Decode(&def.Name)
+	case yaml.SequenceNode:
+		if err := node.Decode(&def.Argv); err != nil {
+			return err
+		}
+		if len(def.Argv) == 0 {
+			return fmt.Errorf("line %d: shell argv template cannot be empty", node.Line)
+		}
+		return nil
+	default:
+		return fmt.Errorf("line %d: shell must be a name or a list of arguments", node.Line)
+	}
+}
+
+// RunDefinition is the shorthand for starting a command by running a bundled file with a runtime, written
+// as `run: {node: greet.js}`.
+type RunDefinition struct {
+	Runtime string
+	File    string
+}
+
+func (def *RunDefinition) UnmarshalYAML(node *yaml.Node) error {
+	entries := map[string]string{}
+	if err := node.Decode(&entries); err != nil {
+		return fmt.Errorf("line %d: run must map a runtime to a file, e.g. `run: {node: greet.js}`", node.Line)
+	}
+	if len(entries) != 1 {
+		return fmt.Errorf("line %d: run must have exactly one runtime, got %d", node.Line, len(entries))
+	}
+
+	for runtime, file := range entries {
+		def.Runtime = runtime
+		def.File = file
+	}
+
+	return nil
+}
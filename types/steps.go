@@ -0,0 +1,16 @@
+package types
+
+// StepDefinition is one of the scripts of a command that runs `steps` instead of a single `start` script.
+// Steps run in order unless they declare what they need, and consecutive steps marked `parallel` run at
+// the same time.
+type StepDefinition struct {
+	Name string `yaml:"name"`
+	// Inline script, run with the command's shell
+	Run string `yaml:"run"`
+	// Steps that must succeed before this one starts. Defaults to the step or parallel group before it.
+	Needs []string `yaml:"needs,omitempty"`
+	// Template condition such as `flags.full` or `eq args.env "prod"`. The step is skipped when it's false.
+	If string `yaml:"if,omitempty"`
+	// Run at the same time as the steps next to it that are also marked parallel
+	Parallel bool `yaml:"parallel,omitempty"`
+}
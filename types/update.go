@@ -0,0 +1,15 @@
+package types
+
+// UpdateDefinition declares where a CLI finds its releases, so users can update it with `self update`.
+type UpdateDefinition struct {
+	// URL of the release manifest
+	URL string `yaml:"url,omitempty"`
+	// Directory with the release manifest, such as a network share, used instead of a URL
+	Dir string `yaml:"dir,omitempty"`
+	// Ed25519 key the artifacts are signed with, either base64-encoded or as a PEM public key
+	PublicKey string `yaml:"public-key"`
+	// Tells users when a new version is available, at most once per `notify-interval`
+	Notify bool `yaml:"notify,omitempty"`
+	// How often to check for a new version, e.g. 12h. Defaults to 24h
+	NotifyInterval string `yaml:"notify-interval,omitempty"`
+}
@@ -0,0 +1,58 @@
+package update
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+// CheckFileName is the file in the data directory of a CLI whose time records when it last checked for a
+// new version.
+const CheckFileName = "update-check"
+
+// DefaultNotifyInterval is how often CLIs check for a new version, unless `notify-interval` says otherwise.
+const DefaultNotifyInterval = 24 * time.Hour
+
+// ParseNotifyInterval returns how often the CLI checks for a new version.
+func ParseNotifyInterval(def *types.UpdateDefinition) (time.Duration, error) {
+	if def.NotifyInterval == "" {
+		return DefaultNotifyInterval, nil
+	}
+
+	interval, err := time.ParseDuration(def.NotifyInterval)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("invalid notify-interval %q: must be a positive duration such as 24h", def.NotifyInterval)
+	}
+	return interval, nil
+}
+
+// CheckForNotice returns the latest release when it's newer than the running version, so users can be told
+// about it. It only checks once per interval, and returns nil otherwise. The time of the check is recorded
+// before it starts, so that a source that's unreachable isn't retried on every run.
+func (updater *Updater) CheckForNotice(ctx context.Context, appDataDir string, interval time.Duration) (*Release, error) {
+	path := filepath.Join(appDataDir, CheckFileName)
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < interval {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(appDataDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		return nil, err
+	}
+
+	release, err := updater.Source.FetchRelease(ctx)
+	if err != nil {
+		return nil, err
+	}
+	newer, err := release.IsNewer(updater.Version)
+	if err != nil || !newer {
+		return nil, err
+	}
+	return release, nil
+}
@@ -0,0 +1,393 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/log"
+	"github.com/hashicorp/go-version"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+//go:embed *
+var PackageFS embed.FS
+
+// ManifestFileName is the release manifest in the directory of an `update` setting with `dir`.
+const ManifestFileName = "release.json"
+
+// Limits on what's read from a source, so a broken or compromised server can't exhaust memory
+const (
+	maxManifestSize   = 1 << 20
+	maxExecutableSize = 512 << 20
+)
+
+// Release is the latest release of a CLI, as described by its release manifest.
+type Release struct {
+	Version string `json:"version"`
+	// Not covered by the signatures of the artifacts, so only shown through DisplayNotes
+	Notes     string     `json:"notes,omitempty"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Artifact is the executable of a release for one platform.
+type Artifact struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// Location of the executable, relative to the manifest unless it's a URL of its own
+	URL string `json:"url"`
+	// Hex-encoded SHA-256 hash of the executable
+	SHA256 string `json:"sha256"`
+	// Base64-encoded ed25519 signature of the artifact's SignedEntry
+	Signature string `json:"signature"`
+}
+
+// Source is where the releases of a CLI are published, which is either a URL or a directory.
+type Source struct {
+	URL    string
+	Dir    string
+	Client *http.Client
+}
+
+// NewSource returns the source an `update` setting declares.
+func NewSource(def *types.UpdateDefinition) (*Source, error) {
+	if (def.URL == "") == (def.Dir == "") {
+		return nil, fmt.Errorf("update must have either a url or a dir")
+	}
+	return &Source{URL: def.URL, Dir: def.Dir, Client: http.DefaultClient}, nil
+}
+
+// FetchRelease reads the release manifest.
+func (source *Source) FetchRelease(ctx context.Context) (*Release, error) {
+	content, err := source.read(ctx, source.manifestLocation(), maxManifestSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the release manifest: %w", err)
+	}
+
+	release := &Release{}
+	if err := json.Unmarshal(content, release); err != nil {
+		return nil, fmt.Errorf("invalid release manifest: %w", err)
+	}
+	if release.Version == "" {
+		return nil, fmt.Errorf("invalid release manifest: no version")
+	}
+	return release, nil
+}
+
+// Download reads the executable of an artifact.
+func (source *Source) Download(ctx context.Context, artifact *Artifact) ([]byte, error) {
+	location, err := source.resolve(artifact.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := source.read(ctx, location, maxExecutableSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", artifact.URL, err)
+	}
+	return content, nil
+}
+
+func (source *Source) manifestLocation() string {
+	if source.Dir != "" {
+		return filepath.Join(source.Dir, ManifestFileName)
+	}
+	return source.URL
+}
+
+// resolve returns where an artifact is, relative to the manifest.
+func (source *Source) resolve(location string) (string, error) {
+	if isURL(location) {
+		return location, nil
+	}
+	if source.Dir != "" {
+		if filepath.IsAbs(location) {
+			return location, nil
+		}
+		return filepath.Join(source.Dir, filepath.FromSlash(location)), nil
+	}
+
+	base, err := url.Parse(source.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid update url: %w", err)
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid artifact url %s: %w", location, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// read returns the content at location, which must be at most limit bytes.
+func (source *Source) read(ctx context.Context, location string, limit int64) ([]byte, error) {
+	if !isURL(location) {
+		file, err := os.Open(location)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return readAtMost(file, location, limit)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := source.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", location, response.Status)
+	}
+	return readAtMost(response.Body, location, limit)
+}
+
+func readAtMost(reader io.Reader, location string, limit int64) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", location, limit)
+	}
+	return content, nil
+}
+
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://")
+}
+
+// Artifact returns the artifact of the release for a platform, such as `runtime.GOOS` and `runtime.GOARCH`.
+func (release *Release) Artifact(goos string, goarch string) (*Artifact, error) {
+	for i := range release.Artifacts {
+		if release.Artifacts[i].OS == goos && release.Artifacts[i].Arch == goarch {
+			return &release.Artifacts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("release %s has no executable for %s/%s", release.Version, goos, goarch)
+}
+
+// DisplayNotes returns the notes of the release without control characters other than newlines and tabs,
+// since they aren't signed and could otherwise send escape sequences to the terminal.
+func (release *Release) DisplayNotes() string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, release.Notes)
+}
+
+// IsNewer reports whether the release is newer than the given version. Versions that aren't semantic
+// versions, such as `dev`, are older than any release.
+func (release *Release) IsNewer(current string) (bool, error) {
+	latest, err := version.NewVersion(release.Version)
+	if err != nil {
+		return false, fmt.Errorf("invalid release version %s: %w", release.Version, err)
+	}
+	installed, err := version.NewVersion(current)
+	if err != nil {
+		return true, nil
+	}
+	return latest.GreaterThan(installed), nil
+}
+
+// ParsePublicKey reads an ed25519 public key, either base64-encoded or as a PEM public key such as the
+// ones `openssl pkey -pubout` writes, with or without its BEGIN and END lines.
+func ParsePublicKey(key string) (ed25519.PublicKey, error) {
+	key = strings.TrimSpace(key)
+
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		return parsePKIXPublicKey(block.Bytes)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		if publicKey, err := parsePKIXPublicKey(raw); err == nil {
+			return publicKey, nil
+		}
+		return nil, fmt.Errorf("invalid public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+func parsePKIXPublicKey(der []byte) (ed25519.PublicKey, error) {
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	publicKey, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid public key: not an ed25519 key")
+	}
+	return publicKey, nil
+}
+
+// SignedEntry returns what the signature of an artifact covers: the version of its release, its platform
+// and its hash, as `key=value` lines. Since the signature covers more than the executable, a manifest
+// can't pass off a signed executable as another version or as one for another platform.
+func SignedEntry(version string, artifact *Artifact) []byte {
+	return []byte(fmt.Sprintf("version=%s\nos=%s\narch=%s\nsha256=%s\n", version, artifact.OS, artifact.Arch, strings.ToLower(artifact.SHA256)))
+}
+
+// Verify checks that an artifact is the executable of the release for the running platform, and checks the
+// executable against the artifact's hash, and the artifact's entry against its signature.
+func Verify(content []byte, release *Release, artifact *Artifact, publicKey ed25519.PublicKey) error {
+	if artifact.OS != runtime.GOOS || artifact.Arch != runtime.GOARCH {
+		return fmt.Errorf("%s is for %s/%s, not %s/%s", artifact.URL, artifact.OS, artifact.Arch, runtime.GOOS, runtime.GOARCH)
+	}
+
+	sum := sha256.Sum256(content)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), artifact.SHA256) {
+		return fmt.Errorf("the SHA-256 hash of %s doesn't match the release manifest", artifact.URL)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(artifact.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature of %s: %w", artifact.URL, err)
+	}
+	if !ed25519.Verify(publicKey, SignedEntry(release.Version, artifact), signature) {
+		return fmt.Errorf("the signature of %s is invalid", artifact.URL)
+	}
+	return nil
+}
+
+// ReplaceExecutable replaces the executable at path with new content, keeping its mode. The new executable
+// is written next to it and renamed over it, so the path never holds a partial executable.
+func ReplaceExecutable(path string, content []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-update-")
+	if err != nil {
+		return fmt.Errorf("failed to write the new executable: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = io.Copy(temp, bytes.NewReader(content))
+	if err == nil {
+		err = temp.Chmod(info.Mode().Perm())
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the new executable: %w", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		// A running executable can't be replaced on Windows, but it can be moved out of the way
+		old := replacedPath(path)
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return fmt.Errorf("failed to move the old executable: %w", err)
+		}
+	}
+
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace the executable: %w", err)
+	}
+	return nil
+}
+
+// RemoveReplacedExecutable removes the executable that ReplaceExecutable moved out of the way on Windows,
+// which can only be removed once it no longer runs, such as when the new executable starts.
+func RemoveReplacedExecutable(path string) {
+	if runtime.GOOS == "windows" {
+		removeReplaced(path)
+	}
+}
+
+func removeReplaced(path string) {
+	if err := os.Remove(replacedPath(path)); err != nil && !os.IsNotExist(err) {
+		log.Debug("Failed to remove the replaced executable", "path", replacedPath(path), "error", err)
+	}
+}
+
+func replacedPath(path string) string {
+	return path + ".old"
+}
+
+// Updater updates a CLI to the latest release of its source.
+type Updater struct {
+	Source    *Source
+	PublicKey ed25519.PublicKey
+	// Version of the running CLI
+	Version string
+	// Where the running CLI is
+	Executable string
+}
+
+// NewUpdater returns an updater for the CLI at executablePath, whose version is currentVersion.
+func NewUpdater(def *types.UpdateDefinition, currentVersion string, executablePath string) (*Updater, error) {
+	source, err := NewSource(def)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := ParsePublicKey(def.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Updater{Source: source, PublicKey: publicKey, Version: currentVersion, Executable: executablePath}, nil
+}
+
+// Update replaces the CLI with the latest release when it's newer, or whatever it is when force is set.
+// It returns the release, and whether the CLI was replaced.
+func (updater *Updater) Update(ctx context.Context, force bool) (*Release, bool, error) {
+	release, err := updater.Source.FetchRelease(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	newer, err := release.IsNewer(updater.Version)
+	if err != nil {
+		return nil, false, err
+	}
+	if !newer && !force {
+		return release, false, nil
+	}
+
+	artifact, err := release.Artifact(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return nil, false, err
+	}
+
+	log.Debug("Downloading release", "version", release.Version, "url", artifact.URL)
+	content, err := updater.Source.Download(ctx, artifact)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := Verify(content, release, artifact, updater.PublicKey); err != nil {
+		return nil, false, err
+	}
+
+	if err := ReplaceExecutable(updater.Executable, content); err != nil {
+		return nil, false, err
+	}
+	return release, true, nil
+}
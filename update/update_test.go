@@ -0,0 +1,316 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/migsc/cmdeagle/types"
+)
+
+// releaseServer serves a release manifest, and an executable for the current platform.
+type releaseServer struct {
+	*httptest.Server
+	publicKey ed25519.PublicKey
+	release   Release
+	content   []byte
+	requests  atomic.Int32
+}
+
+func newReleaseServer(t *testing.T, version string, content []byte) *releaseServer {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	server := &releaseServer{publicKey: publicKey, content: content}
+	server.release = Release{
+		Version: version,
+		Notes:   "Faster greetings",
+		Artifacts: []Artifact{
+			signedArtifact(version, runtime.GOOS, runtime.GOARCH, "bin/mycli", content, privateKey),
+			signedArtifact(version, "plan9", "mips", "bin/mycli-plan9", []byte("other"), privateKey),
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases/latest.json", func(w http.ResponseWriter, r *http.Request) {
+		server.requests.Add(1)
+		json.NewEncoder(w).Encode(server.release)
+	})
+	mux.HandleFunc("/releases/bin/mycli", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(server.content)
+	})
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func signedArtifact(version string, goos string, goarch string, url string, content []byte, privateKey ed25519.PrivateKey) Artifact {
+	sum := sha256.Sum256(content)
+	artifact := Artifact{OS: goos, Arch: goarch, URL: url, SHA256: hex.EncodeToString(sum[:])}
+	artifact.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, SignedEntry(version, &artifact)))
+	return artifact
+}
+
+func (server *releaseServer) updater(t *testing.T, currentVersion string) *Updater {
+	t.Helper()
+
+	executablePath := filepath.Join(t.TempDir(), "mycli")
+	require.NoError(t, os.WriteFile(executablePath, []byte("old executable"), 0755))
+
+	updater, err := NewUpdater(&types.UpdateDefinition{
+		URL:       server.URL + "/releases/latest.json",
+		PublicKey: base64.StdEncoding.EncodeToString(server.publicKey),
+	}, currentVersion, executablePath)
+	require.NoError(t, err)
+	return updater
+}
+
+func TestUpdate(t *testing.T) {
+	server := newReleaseServer(t, "1.3.0", []byte("new executable"))
+	updater := server.updater(t, "1.2.0")
+
+	release, updated, err := updater.Update(context.Background(), false)
+	require.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, "1.3.0", release.Version)
+
+	content, err := os.ReadFile(updater.Executable)
+	require.NoError(t, err)
+	assert.Equal(t, "new executable", string(content))
+
+	info, err := os.Stat(updater.Executable)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// Nothing is left next to the executable
+	entries, err := os.ReadDir(filepath.Dir(updater.Executable))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestUpdateWhenLatest(t *testing.T) {
+	server := newReleaseServer(t, "1.2.0", []byte("new executable"))
+	updater := server.updater(t, "1.2.0")
+
+	_, updated, err := updater.Update(context.Background(), false)
+	require.NoError(t, err)
+	assert.False(t, updated)
+
+	content, err := os.ReadFile(updater.Executable)
+	require.NoError(t, err)
+	assert.Equal(t, "old executable", string(content))
+
+	// Unless forced
+	_, updated, err = updater.Update(context.Background(), true)
+	require.NoError(t, err)
+	assert.True(t, updated)
+}
+
+func TestUpdateRejectsTamperedExecutables(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(server *releaseServer)
+		err    string
+	}{
+		{
+			name:   "content",
+			tamper: func(server *releaseServer) { server.content = []byte("evil executable") },
+			err:    "SHA-256 hash",
+		},
+		{
+			name: "hash and content",
+			tamper: func(server *releaseServer) {
+				server.content = []byte("evil executable")
+				sum := sha256.Sum256(server.content)
+				server.release.Artifacts[0].SHA256 = hex.EncodeToString(sum[:])
+			},
+			err: "signature",
+		},
+		{
+			// An older executable, signed for its own version, passed off as a newer one
+			name:   "version",
+			tamper: func(server *releaseServer) { server.release.Version = "9.0.0" },
+			err:    "signature",
+		},
+		{
+			// The executable of another platform, passed off as one for this platform
+			name: "platform",
+			tamper: func(server *releaseServer) {
+				other := server.release.Artifacts[1]
+				other.OS, other.Arch, other.URL = runtime.GOOS, runtime.GOARCH, "bin/mycli"
+				server.content = []byte("other")
+				server.release.Artifacts[0] = other
+			},
+			err: "signature",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newReleaseServer(t, "1.3.0", []byte("new executable"))
+			tt.tamper(server)
+			updater := server.updater(t, "1.2.0")
+
+			_, updated, err := updater.Update(context.Background(), false)
+			assert.ErrorContains(t, err, tt.err)
+			assert.False(t, updated)
+
+			content, err := os.ReadFile(updater.Executable)
+			require.NoError(t, err)
+			assert.Equal(t, "old executable", string(content))
+		})
+	}
+}
+
+func TestUpdateWithoutArtifactForPlatform(t *testing.T) {
+	server := newReleaseServer(t, "1.3.0", []byte("new executable"))
+	server.release.Artifacts = server.release.Artifacts[1:]
+	updater := server.updater(t, "1.2.0")
+
+	_, _, err := updater.Update(context.Background(), false)
+	assert.ErrorContains(t, err, "no executable for "+runtime.GOOS+"/"+runtime.GOARCH)
+}
+
+func TestUpdateFromDir(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	content := []byte("new executable")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "mycli"), content, 0644))
+	manifest, err := json.Marshal(Release{
+		Version:   "2.0.0",
+		Artifacts: []Artifact{signedArtifact("2.0.0", runtime.GOOS, runtime.GOARCH, "bin/mycli", content, privateKey)},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ManifestFileName), manifest, 0644))
+
+	executablePath := filepath.Join(t.TempDir(), "mycli")
+	require.NoError(t, os.WriteFile(executablePath, []byte("old executable"), 0755))
+
+	// The key can also be given as a PEM public key
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	updater, err := NewUpdater(&types.UpdateDefinition{
+		Dir:       dir,
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}, "dev", executablePath)
+	require.NoError(t, err)
+
+	release, updated, err := updater.Update(context.Background(), false)
+	require.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, "2.0.0", release.Version)
+
+	// Or as just the base64 line of the PEM public key
+	parsed, err := ParsePublicKey(base64.StdEncoding.EncodeToString(der))
+	require.NoError(t, err)
+	assert.Equal(t, publicKey, parsed)
+}
+
+func TestVerifyRejectsOtherPlatforms(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	release := &Release{Version: "1.3.0"}
+	artifact := signedArtifact("1.3.0", "plan9", "mips", "bin/mycli-plan9", []byte("other"), privateKey)
+	assert.ErrorContains(t, Verify([]byte("other"), release, &artifact, publicKey), "is for plan9/mips")
+}
+
+func TestReadAtMost(t *testing.T) {
+	content, err := readAtMost(strings.NewReader("12345"), "bin/mycli", 5)
+	require.NoError(t, err)
+	assert.Equal(t, "12345", string(content))
+
+	_, err = readAtMost(strings.NewReader("123456"), "bin/mycli", 5)
+	assert.ErrorContains(t, err, "bin/mycli is larger than 5 bytes")
+}
+
+func TestNewUpdaterErrors(t *testing.T) {
+	_, err := NewUpdater(&types.UpdateDefinition{PublicKey: "x"}, "1.0.0", "mycli")
+	assert.ErrorContains(t, err, "either a url or a dir")
+
+	_, err = NewUpdater(&types.UpdateDefinition{URL: "https://example.com/latest.json", PublicKey: "c2hvcnQ="}, "1.0.0", "mycli")
+	assert.ErrorContains(t, err, "expected 32 bytes")
+}
+
+func TestCheckForNotice(t *testing.T) {
+	server := newReleaseServer(t, "1.3.0", []byte("new executable"))
+	updater := server.updater(t, "1.2.0")
+	appDataDir := t.TempDir()
+
+	release, err := updater.CheckForNotice(context.Background(), appDataDir, time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, release)
+	assert.Equal(t, "1.3.0", release.Version)
+
+	// Checked at most once per interval
+	release, err = updater.CheckForNotice(context.Background(), appDataDir, time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, release)
+	assert.Equal(t, int32(1), server.requests.Load())
+
+	longAgo := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(appDataDir, CheckFileName), longAgo, longAgo))
+	release, err = updater.CheckForNotice(context.Background(), appDataDir, time.Hour)
+	require.NoError(t, err)
+	assert.NotNil(t, release)
+	assert.Equal(t, int32(2), server.requests.Load())
+
+	// Nothing to tell about when the CLI is up to date
+	server.release.Version = "1.2.0"
+	require.NoError(t, os.Chtimes(filepath.Join(appDataDir, CheckFileName), longAgo, longAgo))
+	release, err = updater.CheckForNotice(context.Background(), appDataDir, time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, release)
+}
+
+func TestParseNotifyInterval(t *testing.T) {
+	interval, err := ParseNotifyInterval(&types.UpdateDefinition{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultNotifyInterval, interval)
+
+	interval, err = ParseNotifyInterval(&types.UpdateDefinition{NotifyInterval: "12h"})
+	require.NoError(t, err)
+	assert.Equal(t, 12*time.Hour, interval)
+
+	_, err = ParseNotifyInterval(&types.UpdateDefinition{NotifyInterval: "daily"})
+	assert.Error(t, err)
+}
+
+func TestDisplayNotes(t *testing.T) {
+	release := &Release{Notes: "Faster \x1b[31mgreetings\x1b[0m\r\n\t- fixes\u009b2J\x07"}
+	assert.Equal(t, "Faster [31mgreetings[0m\n\t- fixes2J", release.DisplayNotes())
+}
+
+func TestRemoveReplaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mycli.exe")
+	require.NoError(t, os.WriteFile(replacedPath(path), []byte("old"), 0755))
+
+	removeReplaced(path)
+	assert.NoFileExists(t, replacedPath(path))
+	// Nothing to remove is fine too
+	removeReplaced(path)
+}